@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/microscaling/microscaling/demand"
 	"github.com/microscaling/microscaling/metric"
@@ -9,37 +10,72 @@ import (
 	"github.com/microscaling/microscaling/utils"
 )
 
-// AppsMessage is the json that arrives from /apps/<userID>
+// AppsMessage is the json that arrives from /apps/<userID>. The same format is used (as json or yaml) for file config
 type AppsMessage struct {
-	UserID        string           `json:"name"`
-	MaxContainers int              `json:"maxContainers"`
-	Apps          []AppDescription `json:"apps"`
+	UserID        string           `json:"name" yaml:"name"`
+	MaxContainers int              `json:"maxContainers" yaml:"maxContainers"`
+	Apps          []AppDescription `json:"apps" yaml:"apps"`
 }
 
 // AppDescription is the json describing an individual app
 type AppDescription struct {
-	Name              string          `json:"name"`
-	Priority          int             `json:"priority"` // 1 is the highest, 0 means it's not scalable
-	MinContainers     int             `json:"minContainers"`
-	MaxContainers     int             `json:"maxContainers"`
-	TargetQueueLength int             `json:"targetValue"`
-	RuleType          string          `json:"ruleType"`
-	AppType           string          `json:"appType"`
-	MetricType        string          `json:"metricType"`
-	Config            DockerAppConfig `json:"config"`
+	Name              string          `json:"name" yaml:"name"`
+	Priority          int             `json:"priority" yaml:"priority"` // 1 is the highest, 0 means it's not scalable
+	MinContainers     int             `json:"minContainers" yaml:"minContainers"`
+	MaxContainers     int             `json:"maxContainers" yaml:"maxContainers"`
+	MaxDelta          int             `json:"maxDelta" yaml:"maxDelta"` // defaults to maxContainers - minContainers
+	TargetQueueLength int             `json:"targetValue" yaml:"targetValue"`
+	RuleType          string          `json:"ruleType" yaml:"ruleType"`
+	AppType           string          `json:"appType" yaml:"appType"`
+	MetricType        string          `json:"metricType" yaml:"metricType"`
+	ShutdownPolicy    string          `json:"shutdownPolicy" yaml:"shutdownPolicy"`
+	CPU               float64         `json:"cpu" yaml:"cpu"`                               // cores requested by each container
+	Memory            int64           `json:"memory" yaml:"memory"`                         // MB requested by each container
+	FailSafe          *int            `json:"failSafeContainers" yaml:"failSafeContainers"` // containers to run if the metric fails
+	Kind              string          `json:"kind" yaml:"kind"`                             // Kubernetes workload kind, defaults to Deployment
+	APIVersion        string          `json:"apiVersion" yaml:"apiVersion"`                 // Kubernetes API group and version of the workload
+	Resource          string          `json:"resource" yaml:"resource"`                     // Kubernetes plural resource name, for custom resources
+	Config            DockerAppConfig `json:"config" yaml:"config"`
 }
 
 // DockerAppConfig is the json describing parameters that need to be passed into Docker when starting this app
 // TODO!! This is not really just Docker-specific as we have some target info in here too
 type DockerAppConfig struct {
-	Image           string `json:"image"`
-	Command         string `json:"command"`
-	PublishAllPorts bool   `json:"publishAllPorts"`
-	QueueLength     int    `json:"targetQueueLength"`
-	QueueName       string `json:"queueName"`
-	TopicName       string `json:"topicName"`
-	ChannelName     string `json:"channelName"`
-	QueueURL        string `json:"queueURL"`
+	Image           string `json:"image" yaml:"image"`
+	Command         string `json:"command" yaml:"command"`
+	PublishAllPorts bool   `json:"publishAllPorts" yaml:"publishAllPorts"`
+	QueueLength     int    `json:"targetQueueLength" yaml:"targetQueueLength"`
+	QueueName       string `json:"queueName" yaml:"queueName"`
+	TopicName       string `json:"topicName" yaml:"topicName"`
+	ChannelName     string `json:"channelName" yaml:"channelName"`
+	QueueURL        string `json:"queueURL" yaml:"queueURL"`
+	Query           string `json:"query" yaml:"query"` // PromQL query for the Prometheus metric
+	Vhost           string `json:"vhost" yaml:"vhost"` // RabbitMQ virtual host, defaults to /
+	IncludeUnacked  bool   `json:"includeUnacked" yaml:"includeUnacked"`
+	ConsumerGroup   string `json:"consumerGroup" yaml:"consumerGroup"` // Kafka or Redis stream consumer group
+	RedisCommand    string `json:"redisCommand" yaml:"redisCommand"`   // LLEN (default), XLEN, XPENDING or ZCARD
+	Key             string `json:"key" yaml:"key"`                     // Redis key
+
+	// Container settings, used by the Docker scheduler
+	MemoryLimit   int64             `json:"memoryLimit" yaml:"memoryLimit"` // MB
+	CPULimit      float64           `json:"cpuLimit" yaml:"cpuLimit"`       // cores
+	Ports         []string          `json:"ports" yaml:"ports"`             // e.g. 8080:80 or 127.0.0.1::53/udp
+	Volumes       []string          `json:"volumes" yaml:"volumes"`         // source:target[:options]
+	Labels        map[string]string `json:"labels" yaml:"labels"`
+	User          string            `json:"user" yaml:"user"`
+	LogDriver     string            `json:"logDriver" yaml:"logDriver"`
+	LogOptions    map[string]string `json:"logOptions" yaml:"logOptions"`
+	RestartPolicy string            `json:"restartPolicy" yaml:"restartPolicy"` // no, always, unless-stopped or on-failure[:retries]
+
+	// Credentials for pulling the image from a private registry
+	RegistryUsername string `json:"registryUsername" yaml:"registryUsername"`
+	RegistryPassword string `json:"registryPassword" yaml:"registryPassword"`
+
+	// Stopping containers gracefully
+	StopTimeout int    `json:"stopTimeout" yaml:"stopTimeout"` // seconds
+	StopSignal  string `json:"stopSignal" yaml:"stopSignal"`
+	PreStopHTTP string `json:"preStopHTTP" yaml:"preStopHTTP"` // port/path on the container, e.g. 8080/drain
+	PreStopExec string `json:"preStopExec" yaml:"preStopExec"` // command run in the container
 }
 
 func appsFromResponse(b []byte) (tasks []*demand.Task, maxContainers int, err error) {
@@ -53,61 +89,164 @@ func appsFromResponse(b []byte) (tasks []*demand.Task, maxContainers int, err er
 	maxContainers = appsMessage.MaxContainers
 
 	for _, a := range appsMessage.Apps {
-		task := demand.Task{
-			Name:          a.Name,
-			Image:         a.Config.Image,
-			Command:       a.Config.Command,
-			Priority:      a.Priority,
-			MinContainers: a.MinContainers,
-			MaxContainers: a.MaxContainers,
-			MaxDelta:      (a.MaxContainers - a.MinContainers),
-			IsScalable:    true,
-
-			// TODO!! Settings that need to be made configurable via the API.
-			// Default PublishAllPorts to true.
-			PublishAllPorts: true,
-			// Set Network mode to host only. This won't work for load balancer metrics.
-			NetworkMode: "host",
+		task, err := NewTask(a)
+		if err != nil {
+			return tasks, maxContainers, err
 		}
 
-		switch a.RuleType {
-		case "Queue":
-			task.Target = target.NewQueueLengthTarget(a.Config.QueueLength)
-		case "SimpleQueue":
-			task.Target = target.NewSimpleQueueLengthTarget(a.Config.QueueLength)
-		default:
-			task.Target = target.NewRemainderTarget(a.MaxContainers)
-			task.Metric = metric.NewNullMetric()
-		}
+		tasks = append(tasks, task)
+	}
+
+	if err != nil {
+		log.Debugf("Apps message: %v", appsMessage)
+	}
+
+	return
+}
+
+// NewTask builds a task, including its target and metric, from an app description
+func NewTask(a AppDescription) (*demand.Task, error) {
+	maxDelta := a.MaxDelta
+	if maxDelta == 0 {
+		maxDelta = a.MaxContainers - a.MinContainers
+	}
+
+	shutdownPolicy, err := demand.ParseShutdownPolicy(a.ShutdownPolicy)
+	if err != nil {
+		log.Errorf("Bad shutdown policy for %s: %v", a.Name, err)
+		return nil, err
+	}
+
+	task := demand.Task{
+		Name:          a.Name,
+		Image:         a.Config.Image,
+		Command:       a.Config.Command,
+		Priority:      a.Priority,
+		MinContainers: a.MinContainers,
+		MaxContainers: a.MaxContainers,
+		MaxDelta:      maxDelta,
+		IsScalable:    true,
+
+		ShutdownPolicy: shutdownPolicy,
+		Resources: demand.Resources{
+			CPU:    a.CPU,
+			Memory: a.Memory,
+		},
+		Workload: demand.Workload{
+			Kind:       a.Kind,
+			APIVersion: a.APIVersion,
+			Resource:   a.Resource,
+		},
+
+		// TODO!! Settings that need to be made configurable via the API.
+		// Default PublishAllPorts to true.
+		PublishAllPorts: true,
+		// Set Network mode to host only. This won't work for load balancer metrics.
+		NetworkMode: "host",
+	}
+
+	if a.FailSafe != nil {
+		task.FailSafe = true
+		task.FailSafeContainers = *a.FailSafe
+	}
+
+	task.Container, err = NewContainerSpec(a.Config)
+	if err != nil {
+		log.Errorf("Bad container config for %s: %v", a.Name, err)
+		return nil, err
+	}
+
+	switch a.RuleType {
+	case "Queue":
+		task.Target = target.NewQueueLengthTarget(a.Config.QueueLength)
+	case "SimpleQueue":
+		task.Target = target.NewSimpleQueueLengthTarget(a.Config.QueueLength)
+	default:
+		task.Target = target.NewRemainderTarget(a.MaxContainers)
+		task.Metric = metric.NewNullMetric()
+	}
 
-		if a.RuleType == "Queue" || a.RuleType == "SimpleQueue" {
-			switch a.MetricType {
-			case "AzureQueue":
-				task.Metric = metric.NewAzureQueueMetric(a.Config.QueueName)
-			case "NSQ":
-				task.Metric = metric.NewNSQMetric(a.Config.TopicName, a.Config.ChannelName)
-			case "SQS":
-				metric, err := metric.NewSQSMetric(a.Config.QueueURL)
-				if err != nil {
-					log.Errorf("Failed to create SQS metric: %v", err)
-					return tasks, maxContainers, err
-				}
-
-				task.Metric = metric
-
-			default:
-				log.Errorf("Unexpected queue metricType %s", a.MetricType)
+	if a.RuleType == "Queue" || a.RuleType == "SimpleQueue" {
+		switch a.MetricType {
+		case "AzureQueue":
+			task.Metric = metric.NewAzureQueueMetric(a.Config.QueueName)
+		case "NSQ":
+			task.Metric = metric.NewNSQMetric(a.Config.TopicName, a.Config.ChannelName)
+		case "SQS":
+			metric, err := metric.NewSQSMetric(a.Config.QueueURL)
+			if err != nil {
+				log.Errorf("Failed to create SQS metric: %v", err)
+				return nil, err
 			}
+
+			task.Metric = metric
+		case "RabbitMQ":
+			task.Metric = metric.NewRabbitMQMetric(a.Config.Vhost, a.Config.QueueName, a.Config.IncludeUnacked)
+		case "Redis":
+			metric, err := metric.NewRedisMetric(a.Config.RedisCommand, a.Config.Key, a.Config.ConsumerGroup)
+			if err != nil {
+				log.Errorf("Failed to create Redis metric: %v", err)
+				return nil, err
+			}
+
+			task.Metric = metric
+		case "Kafka":
+			task.Metric = metric.NewKafkaLagMetric(a.Config.TopicName, a.Config.ConsumerGroup)
+		case "Prometheus":
+			task.Metric = metric.NewPrometheusMetric(a.Config.Query)
+		default:
+			log.Errorf("Unexpected queue metricType %s", a.MetricType)
 		}
+	}
+
+	return &task, nil
+}
 
-		tasks = append(tasks, &task)
+// NewContainerSpec builds the container settings from an app's config
+func NewContainerSpec(c DockerAppConfig) (spec demand.ContainerSpec, err error) {
+	if c.MemoryLimit < 0 || c.CPULimit < 0 {
+		return spec, fmt.Errorf("memoryLimit and cpuLimit must not be negative")
 	}
 
-	if err != nil {
-		log.Debugf("Apps message: %v", appsMessage)
+	if c.StopTimeout < 0 {
+		return spec, fmt.Errorf("stopTimeout must not be negative")
 	}
 
-	return
+	spec = demand.ContainerSpec{
+		MemoryLimit: c.MemoryLimit,
+		CPULimit:    c.CPULimit,
+		Volumes:     c.Volumes,
+		Labels:      c.Labels,
+		User:        c.User,
+		LogDriver:   c.LogDriver,
+		LogOptions:  c.LogOptions,
+
+		RegistryUsername: c.RegistryUsername,
+		RegistryPassword: c.RegistryPassword,
+
+		StopTimeout: c.StopTimeout,
+		StopSignal:  c.StopSignal,
+		PreStopExec: c.PreStopExec,
+	}
+
+	if c.PreStopHTTP != "" {
+		spec.PreStopHTTP, err = demand.ParseHTTPHook(c.PreStopHTTP)
+		if err != nil {
+			return spec, err
+		}
+	}
+
+	for _, port := range c.Ports {
+		p, err := demand.ParsePortBinding(port)
+		if err != nil {
+			return spec, err
+		}
+
+		spec.Ports = append(spec.Ports, p)
+	}
+
+	spec.RestartPolicy, spec.MaxRetries, err = demand.ParseRestartPolicy(c.RestartPolicy)
+	return spec, err
 }
 
 // GetApps retrives the app definitions from the server for a given userID
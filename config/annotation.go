@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	kubeapi "k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+
+	"github.com/microscaling/microscaling/api"
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/utils"
+)
+
+// Deployments are managed if they have any annotations with this prefix
+const annotationPrefix = "com.microscaling."
+
+// KubeAnnotationConfig is used when we get task config from annotations on Kubernetes deployments, so we don't need
+// the Microscaling server or MicroBadger
+type KubeAnnotationConfig struct {
+	KubeConfig    string
+	KubeNamespace string // empty for all namespaces
+	clientset     *kubernetes.Clientset
+}
+
+// compile-time assert that we implement the right interface
+var _ Config = (*KubeAnnotationConfig)(nil)
+
+// NewKubeAnnotationConfig gets a new KubeAnnotationConfig. If the namespace is empty we look for deployments in all
+// namespaces.
+func NewKubeAnnotationConfig(KubeConfig string, KubeNamespace string) *KubeAnnotationConfig {
+	return &KubeAnnotationConfig{
+		KubeConfig:    KubeConfig,
+		KubeNamespace: KubeNamespace,
+	}
+}
+
+// GetApps builds a task for each deployment with com.microscaling annotations. Deployments with bad config are left
+// out, so they don't stop us scaling the others. The maximum number of containers is the total of the tasks' maximums.
+func (ka *KubeAnnotationConfig) GetApps(userID string) (tasks []*demand.Task, maxContainers int, err error) {
+	if ka.clientset == nil {
+		ka.clientset, err = utils.NewKubeClientset(ka.KubeConfig, ka.KubeNamespace)
+		if err != nil {
+			log.Errorf("Error creating Kubernetes clientset: %v", err)
+			return
+		}
+	}
+
+	deployments, err := ka.clientset.Extensions().Deployments(ka.KubeNamespace).List(kubeapi.ListOptions{})
+	if err != nil {
+		log.Errorf("Error listing deployments: %v", err)
+		return
+	}
+
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		if !hasAnnotations(d.Annotations) {
+			continue
+		}
+
+		task, err := ka.taskFromDeployment(d)
+		if err != nil {
+			log.Errorf("Ignoring deployment %s/%s: %v", d.Namespace, d.Name, err)
+			continue
+		}
+
+		tasks = append(tasks, task)
+		maxContainers += task.MaxContainers
+	}
+
+	return tasks, maxContainers, nil
+}
+
+func hasAnnotations(annotations map[string]string) bool {
+	for k := range annotations {
+		if strings.HasPrefix(strings.ToLower(k), annotationPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// taskFromDeployment reads the scaling parameters from the annotations. Tasks are named after their deployment, or
+// namespace/deployment if we're looking in all namespaces.
+func (ka *KubeAnnotationConfig) taskFromDeployment(d *v1beta1.Deployment) (*demand.Task, error) {
+	annotations := make(map[string]string, len(d.Annotations))
+	for k, v := range d.Annotations {
+		annotations[strings.ToLower(k)] = v
+	}
+
+	a := api.AppDescription{
+		Name:           d.Name,
+		RuleType:       annotations["com.microscaling.rule-type"],
+		MetricType:     annotations["com.microscaling.metric-type"],
+		ShutdownPolicy: annotations["com.microscaling.shutdown-policy"],
+		Config: api.DockerAppConfig{
+			QueueName:     annotations["com.microscaling.queue-name"],
+			TopicName:     annotations["com.microscaling.topic-name"],
+			ChannelName:   annotations["com.microscaling.channel-name"],
+			QueueURL:      annotations["com.microscaling.queue-url"],
+			Query:         annotations["com.microscaling.query"],
+			Vhost:         annotations["com.microscaling.vhost"],
+			ConsumerGroup: annotations["com.microscaling.consumer-group"],
+			RedisCommand:  annotations["com.microscaling.redis-command"],
+			Key:           annotations["com.microscaling.key"],
+		},
+	}
+
+	if ka.KubeNamespace == "" {
+		a.Name = d.Namespace + "/" + d.Name
+	}
+
+	// Annotations that are set must have valid values
+	ints := []struct {
+		key string
+		val *int
+	}{
+		{"com.microscaling.priority", &a.Priority},
+		{"com.microscaling.min-containers", &a.MinContainers},
+		{"com.microscaling.max-containers", &a.MaxContainers},
+		{"com.microscaling.max-delta", &a.MaxDelta},
+		{"com.microscaling.target", &a.Config.QueueLength},
+	}
+	for _, i := range ints {
+		val, err := parseIntAnnotation(annotations, i.key)
+		if err != nil {
+			return nil, err
+		}
+		*i.val = val
+	}
+
+	if _, ok := annotations["com.microscaling.fail-safe-containers"]; ok {
+		failSafe, err := parseIntAnnotation(annotations, "com.microscaling.fail-safe-containers")
+		if err != nil {
+			return nil, err
+		}
+		a.FailSafe = &failSafe
+	}
+
+	if includeUnacked, ok := annotations["com.microscaling.include-unacked"]; ok {
+		b, err := strconv.ParseBool(includeUnacked)
+		if err != nil {
+			return nil, fmt.Errorf("Bad value for annotation com.microscaling.include-unacked: %v", err)
+		}
+		a.Config.IncludeUnacked = b
+	}
+
+	// The resources requested by each pod are the total for its containers
+	podSpec := d.Spec.Template.Spec
+	for _, c := range podSpec.Containers {
+		if cpu, ok := c.Resources.Requests[v1.ResourceCPU]; ok {
+			a.CPU += float64(cpu.MilliValue()) / 1000
+		}
+
+		if memory, ok := c.Resources.Requests[v1.ResourceMemory]; ok {
+			a.Memory += memory.Value() / (1024 * 1024)
+		}
+	}
+
+	// Check the config the same way as for a config file
+	err := validateApp(a)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := api.NewTask(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.Metric == nil {
+		return nil, fmt.Errorf("Unknown metric type %s", a.MetricType)
+	}
+
+	if len(podSpec.Containers) > 0 {
+		task.Image = podSpec.Containers[0].Image
+	}
+
+	if isScalable, ok := annotations["com.microscaling.is-scalable"]; ok {
+		b, err := strconv.ParseBool(isScalable)
+		if err != nil {
+			return nil, fmt.Errorf("Bad value for annotation com.microscaling.is-scalable: %v", err)
+		}
+		task.IsScalable = b
+	}
+
+	task.Workload = demand.Workload{
+		Kind:      "Deployment",
+		Namespace: d.Namespace,
+		Name:      d.Name,
+	}
+
+	return task, nil
+}
+
+// parseIntAnnotation returns 0 if the annotation isn't set, and an error if it isn't an integer
+func parseIntAnnotation(annotations map[string]string, key string) (int, error) {
+	val, ok := annotations[key]
+	if !ok {
+		return 0, nil
+	}
+
+	intVal, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("Bad value for annotation %s: %v", key, err)
+	}
+
+	return intVal, nil
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/rest"
+
+	"github.com/microscaling/microscaling/target"
+)
+
+const testDeploymentList = `{
+  "kind": "DeploymentList",
+  "apiVersion": "extensions/v1beta1",
+  "metadata": {"resourceVersion": "1"},
+  "items": [
+    {
+      "metadata": {
+        "name": "consumer",
+        "namespace": "queues",
+        "annotations": {
+          "com.microscaling.priority": "1",
+          "com.microscaling.min-containers": "1",
+          "com.microscaling.max-containers": "10",
+          "com.microscaling.rule-type": "SimpleQueue",
+          "com.microscaling.target": "50",
+          "com.microscaling.metric-type": "NSQ",
+          "com.microscaling.topic-name": "microscaling-demo",
+          "com.microscaling.channel-name": "microscaling-demo",
+          "com.microscaling.Fail-Safe-Containers": "3"
+        }
+      },
+      "spec": {"template": {"spec": {"containers": [
+        {"name": "consumer", "image": "microscaling/queue-demo:latest", "resources": {"requests": {"cpu": "250m", "memory": "128Mi"}}},
+        {"name": "sidecar", "image": "sidecar", "resources": {"requests": {"cpu": "250m"}}}
+      ]}}}
+    },
+    {
+      "metadata": {
+        "name": "remainder",
+        "namespace": "queues",
+        "annotations": {"com.microscaling.priority": "2", "com.microscaling.max-containers": "5"}
+      },
+      "spec": {"template": {"spec": {"containers": [{"name": "remainder", "image": "microscaling/priority-2:latest"}]}}}
+    },
+    {
+      "metadata": {"name": "unmanaged", "namespace": "queues", "annotations": {"other": "annotation"}},
+      "spec": {"template": {"spec": {"containers": [{"name": "unmanaged", "image": "nginx"}]}}}
+    },
+    {
+      "metadata": {
+        "name": "bad",
+        "namespace": "queues",
+        "annotations": {"com.microscaling.rule-type": "Queue", "com.microscaling.metric-type": "Unknown"}
+      },
+      "spec": {"template": {"spec": {"containers": [{"name": "bad", "image": "nginx"}]}}}
+    },
+    {
+      "metadata": {
+        "name": "bad-number",
+        "namespace": "queues",
+        "annotations": {"com.microscaling.priority": "3", "com.microscaling.max-containers": "lots"}
+      },
+      "spec": {"template": {"spec": {"containers": [{"name": "bad-number", "image": "nginx"}]}}}
+    },
+    {
+      "metadata": {
+        "name": "invalid",
+        "namespace": "queues",
+        "annotations": {"com.microscaling.min-containers": "5", "com.microscaling.max-containers": "2"}
+      },
+      "spec": {"template": {"spec": {"containers": [{"name": "invalid", "image": "nginx"}]}}}
+    }
+  ]
+}`
+
+func TestKubeAnnotationConfig(t *testing.T) {
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testDeploymentList))
+	}))
+	defer server.Close()
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ka := NewKubeAnnotationConfig("", "queues")
+	ka.clientset = clientset
+
+	tasks, maxContainers, err := ka.GetApps("")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/apis/extensions/v1beta1/namespaces/queues/deployments" {
+		t.Errorf("Unexpected requests %v", paths)
+	}
+
+	// Deployments without annotations, or with bad config, are left out
+	if len(tasks) != 2 || maxContainers != 15 {
+		t.Fatalf("Expected 2 tasks with 15 max containers, got %d with %d", len(tasks), maxContainers)
+	}
+
+	consumer := tasks[0]
+	if consumer.Name != "consumer" || consumer.Priority != 1 || consumer.MinContainers != 1 || consumer.MaxContainers != 10 {
+		t.Errorf("Bad consumer task %+v", consumer)
+	}
+
+	if consumer.Image != "microscaling/queue-demo:latest" || !consumer.FailSafe || consumer.FailSafeContainers != 3 {
+		t.Errorf("Bad consumer image or fail-safe %+v", consumer)
+	}
+
+	if consumer.Resources.CPU != 0.5 || consumer.Resources.Memory != 128 {
+		t.Errorf("Expected resources for both containers, got %+v", consumer.Resources)
+	}
+
+	if queue, ok := consumer.Target.(*target.SimpleQueueLengthTarget); !ok || queue.Value() != 50 {
+		t.Errorf("Bad consumer target %#v", consumer.Target)
+	}
+
+	if consumer.Workload.Kind != "Deployment" || consumer.Workload.Namespace != "queues" || consumer.Workload.Name != "consumer" {
+		t.Errorf("Bad consumer workload %+v", consumer.Workload)
+	}
+
+	if tasks[1].Name != "remainder" || tasks[1].Priority != 2 || !tasks[1].IsRemainder() {
+		t.Errorf("Bad remainder task %+v", tasks[1])
+	}
+
+	// Across all namespaces, tasks include the namespace in their names
+	paths = nil
+	ka = NewKubeAnnotationConfig("", "")
+	ka.clientset = clientset
+
+	tasks, _, err = ka.GetApps("")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/apis/extensions/v1beta1/deployments" {
+		t.Errorf("Unexpected requests %v", paths)
+	}
+
+	if len(tasks) != 2 || tasks[0].Name != "queues/consumer" || tasks[0].Workload.Name != "consumer" {
+		t.Errorf("Expected tasks named with their namespace, got %+v", tasks)
+	}
+}
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/microscaling/microscaling/api"
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/metric"
+)
+
+// FileConfig is used when we read task config from a local YAML or JSON file. The file uses the same
+// format as the apps message from the Microscaling API, e.g.
+//
+//	maxContainers: 10
+//	apps:
+//	- name: consumer
+//	  priority: 1
+//	  minContainers: 1
+//	  maxContainers: 10
+//	  maxDelta: 5
+//	  ruleType: Queue
+//	  metricType: NSQ
+//	  config:
+//	    image: microscaling/queue-demo:latest
+//	    targetQueueLength: 50
+//	    topicName: microscaling-demo
+//	    channelName: microscaling-demo
+type FileConfig struct {
+	FilePath string
+}
+
+// compile-time assert that we implement the right interface
+var _ Config = (*FileConfig)(nil)
+
+// NewFileConfig gets a new FileConfig
+func NewFileConfig(filePath string) *FileConfig {
+	return &FileConfig{
+		FilePath: filePath,
+	}
+}
+
+// GetApps reads task config from the file
+func (f *FileConfig) GetApps(userID string) (tasks []*demand.Task, maxContainers int, err error) {
+	b, err := ioutil.ReadFile(f.FilePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to read config file: %v", err)
+	}
+
+	tasks, maxContainers, err = appsFromFile(b)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", f.FilePath, err)
+	}
+
+	return tasks, maxContainers, err
+}
+
+func appsFromFile(b []byte) (tasks []*demand.Task, maxContainers int, err error) {
+	var appsMessage api.AppsMessage
+
+	if isJSON(b) {
+		err = json.Unmarshal(b, &appsMessage)
+		if err != nil {
+			return nil, 0, jsonError(b, err)
+		}
+	} else {
+		// The yaml package includes line numbers in its errors
+		err = yaml.Unmarshal(b, &appsMessage)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	err = validateApps(b, appsMessage)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, a := range appsMessage.Apps {
+		task, err := api.NewTask(a)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", appPosition(b, a.Name, 1), err)
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, appsMessage.MaxContainers, nil
+}
+
+func validateApps(b []byte, appsMessage api.AppsMessage) error {
+	if appsMessage.MaxContainers <= 0 {
+		return fmt.Errorf("maxContainers must be greater than 0")
+	}
+
+	if len(appsMessage.Apps) == 0 {
+		return fmt.Errorf("No apps configured")
+	}
+
+	names := make(map[string]int, len(appsMessage.Apps))
+	for i, a := range appsMessage.Apps {
+		if a.Name == "" {
+			return fmt.Errorf("app %d: name is required", i+1)
+		}
+
+		names[a.Name]++
+
+		err := validateApp(a)
+		if err == nil && names[a.Name] > 1 {
+			err = fmt.Errorf("duplicate app name")
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", appPosition(b, a.Name, names[a.Name]), err)
+		}
+	}
+
+	return nil
+}
+
+func validateApp(a api.AppDescription) error {
+	if a.Priority < 0 {
+		return fmt.Errorf("priority must not be negative")
+	}
+
+	if a.MinContainers < 0 {
+		return fmt.Errorf("minContainers must not be negative")
+	}
+
+	if a.MaxContainers < a.MinContainers {
+		return fmt.Errorf("maxContainers %d is less than minContainers %d", a.MaxContainers, a.MinContainers)
+	}
+
+	if a.MaxDelta < 0 {
+		return fmt.Errorf("maxDelta must not be negative")
+	}
+
+	if a.FailSafe != nil && *a.FailSafe < 0 {
+		return fmt.Errorf("failSafeContainers must not be negative")
+	}
+
+	if a.CPU < 0 || a.Memory < 0 {
+		return fmt.Errorf("cpu and memory must not be negative")
+	}
+
+	if _, err := demand.ParseShutdownPolicy(a.ShutdownPolicy); err != nil {
+		return err
+	}
+
+	if _, err := api.NewContainerSpec(a.Config); err != nil {
+		return err
+	}
+
+	switch a.RuleType {
+	case "Queue", "SimpleQueue":
+		// Validated below
+	case "", "Remainder":
+		return nil
+	default:
+		return fmt.Errorf("unexpected ruleType %s", a.RuleType)
+	}
+
+	if a.Config.QueueLength <= 0 {
+		return fmt.Errorf("targetQueueLength must be greater than 0 for ruleType %s", a.RuleType)
+	}
+
+	switch a.MetricType {
+	case "AzureQueue", "RabbitMQ":
+		if a.Config.QueueName == "" {
+			return fmt.Errorf("queueName is required for metricType %s", a.MetricType)
+		}
+	case "NSQ":
+		if a.Config.TopicName == "" || a.Config.ChannelName == "" {
+			return fmt.Errorf("topicName and channelName are required for metricType %s", a.MetricType)
+		}
+	case "Kafka":
+		if a.Config.TopicName == "" || a.Config.ConsumerGroup == "" {
+			return fmt.Errorf("topicName and consumerGroup are required for metricType %s", a.MetricType)
+		}
+	case "Redis":
+		command, err := metric.ParseRedisCommand(a.Config.RedisCommand)
+		if err != nil {
+			return err
+		}
+
+		if a.Config.Key == "" {
+			return fmt.Errorf("key is required for metricType %s", a.MetricType)
+		}
+
+		if command == metric.RedisStreamPending && a.Config.ConsumerGroup == "" {
+			return fmt.Errorf("consumerGroup is required for redisCommand %s", command)
+		}
+	case "SQS":
+		if a.Config.QueueURL == "" {
+			return fmt.Errorf("queueURL is required for metricType %s", a.MetricType)
+		}
+	case "Prometheus":
+		if a.Config.Query == "" {
+			return fmt.Errorf("query is required for metricType %s", a.MetricType)
+		}
+	default:
+		return fmt.Errorf("unexpected metricType %s for ruleType %s", a.MetricType, a.RuleType)
+	}
+
+	return nil
+}
+
+// isJSON guesses whether the file is JSON rather than YAML by looking at the first character
+func isJSON(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte("{"))
+}
+
+// jsonError adds the line number to json decoding errors where we know the offset
+func jsonError(b []byte, err error) error {
+	var offset int64
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return err
+	}
+
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+
+	return fmt.Errorf("line %d: %v", bytes.Count(b[:offset], []byte("\n"))+1, err)
+}
+
+// appPosition describes where the app is defined in the file so we can include it in validation errors.
+// If more than one app has the same name, occurrence says which one we want.
+func appPosition(b []byte, name string, occurrence int) string {
+	line := lineOfApp(b, name, occurrence)
+	if line == 0 {
+		return fmt.Sprintf("app %s", name)
+	}
+
+	return fmt.Sprintf("line %d: app %s", line, name)
+}
+
+// lineOfApp finds the line where the app's name is defined, or 0 if we can't find it
+func lineOfApp(b []byte, name string, occurrence int) int {
+	re := regexp.MustCompile(`(^|[\s{,-])"?name"?\s*:\s*["']?` + regexp.QuoteMeta(name) + `["']?\s*(,|}|$|#)`)
+
+	found := 0
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		if re.Match(line) {
+			found++
+			if found == occurrence {
+				return i + 1
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testYAMLConfig = `
+maxContainers: 10
+apps:
+- name: consumer
+  priority: 1
+  minContainers: 1
+  maxContainers: 10
+  maxDelta: 3
+  failSafeContainers: 4
+  kind: StatefulSet
+  ruleType: Queue
+  metricType: NSQ
+  config:
+    image: microscaling/queue-demo:latest
+    command: /run.sh
+    targetQueueLength: 50
+    topicName: microscaling-demo
+    channelName: microscaling-demo
+    memoryLimit: 256
+    ports:
+    - 8080:80
+    volumes:
+    - /data:/data:ro
+    labels:
+      team: payments
+    restartPolicy: on-failure:3
+    stopTimeout: 30
+    preStopHTTP: 8080/drain
+- name: remainder
+  priority: 2
+  minContainers: 1
+  maxContainers: 10
+  config:
+    image: microscaling/priority-2:latest
+`
+
+const testJSONConfig = `{
+  "maxContainers": 5,
+  "apps": [
+    {
+      "name": "consumer",
+      "priority": 1,
+      "maxContainers": 5,
+      "ruleType": "SimpleQueue",
+      "metricType": "NSQ",
+      "config": {
+        "image": "microscaling/queue-demo:latest",
+        "targetQueueLength": 20,
+        "topicName": "test",
+        "channelName": "test"
+      }
+    }
+  ]
+}`
+
+func TestFileConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "microscaling-config")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	f.Write([]byte(testYAMLConfig))
+	f.Close()
+
+	c := NewFileConfig(f.Name())
+	tasks, maxC, err := c.GetApps("hello")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if maxC != 10 {
+		t.Fatalf("Expected max containers 10, got %d", maxC)
+	}
+
+	if len(tasks) != 2 {
+		t.Fatalf("Expected two tasks, got %d", len(tasks))
+	}
+
+	consumer := tasks[0]
+	if consumer.Name != "consumer" || consumer.Image != "microscaling/queue-demo:latest" || consumer.Command != "/run.sh" {
+		t.Errorf("Bad consumer task %v", consumer)
+	}
+
+	if consumer.Priority != 1 || consumer.MinContainers != 1 || consumer.MaxContainers != 10 || consumer.MaxDelta != 3 {
+		t.Errorf("Bad consumer scaling config %v", consumer)
+	}
+
+	if !consumer.FailSafe || consumer.FailSafeContainers != 4 {
+		t.Errorf("Expected fail-safe of 4 containers")
+	}
+
+	spec := consumer.Container
+	if spec.MemoryLimit != 256 || len(spec.Ports) != 1 || spec.Ports[0].HostPort != 8080 || len(spec.Volumes) != 1 ||
+		spec.Labels["team"] != "payments" || spec.RestartPolicy != "on-failure" || spec.MaxRetries != 3 {
+		t.Errorf("Bad consumer container spec %+v", spec)
+	}
+
+	if consumer.Workload.Kind != "StatefulSet" {
+		t.Errorf("Expected consumer workload kind StatefulSet, got %s", consumer.Workload.Kind)
+	}
+
+	if spec.StopTimeout != 30 || spec.PreStopHTTP == nil || spec.PreStopHTTP.Port != 8080 || spec.PreStopHTTP.Path != "/drain" {
+		t.Errorf("Bad consumer stop settings %+v", spec)
+	}
+
+	if reflect.TypeOf(consumer.Target).String() != "*target.QueueLengthTarget" {
+		t.Errorf("Bad consumer target %T", consumer.Target)
+	}
+
+	if reflect.TypeOf(consumer.Metric).String() != "*metric.NSQMetric" {
+		t.Errorf("Bad consumer metric %T", consumer.Metric)
+	}
+
+	remainder := tasks[1]
+	if remainder.MaxDelta != 9 {
+		t.Errorf("Expected max delta to default to 9, got %d", remainder.MaxDelta)
+	}
+
+	if !remainder.IsRemainder() {
+		t.Errorf("Expected a remainder task")
+	}
+
+	c = NewFileConfig("/no/such/file")
+	_, _, err = c.GetApps("hello")
+	if err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestFileConfigJSON(t *testing.T) {
+	tasks, maxC, err := appsFromFile([]byte(testJSONConfig))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if maxC != 5 || len(tasks) != 1 {
+		t.Fatalf("Expected one task with max containers 5")
+	}
+
+	if reflect.TypeOf(tasks[0].Target).String() != "*target.SimpleQueueLengthTarget" {
+		t.Errorf("Bad target %T", tasks[0].Target)
+	}
+}
+
+func TestFileConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		expErr string
+	}{
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  maxContainers: [\n",
+			expErr: "line 4",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  maxContainers: lots\n",
+			expErr: "line 4",
+		},
+		{
+			config: "{\n  \"maxContainers\": 10,\n  \"apps\": \"none\"\n}",
+			expErr: "line 3",
+		},
+		{
+			config: "apps:\n- name: a\n",
+			expErr: "maxContainers must be greater than 0",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  maxContainers: 2\n- name: b\n  minContainers: 3\n  maxContainers: 2\n",
+			expErr: "line 5: app b: maxContainers 2 is less than minContainers 3",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n- name: a\n",
+			expErr: "line 4: app a: duplicate app name",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  maxContainers: 2\n  ruleType: Queue\n  metricType: NSQ\n  config:\n    targetQueueLength: 5\n",
+			expErr: "line 3: app a: topicName and channelName are required",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  ruleType: Queue\n  metricType: Kestrel\n  config:\n    targetQueueLength: 5\n",
+			expErr: "unexpected metricType Kestrel",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  ruleType: SimpleQueue\n  metricType: Prometheus\n  config:\n    targetQueueLength: 100\n",
+			expErr: "line 3: app a: query is required",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  ruleType: Queue\n  metricType: Redis\n  config:\n    targetQueueLength: 5\n    key: jobs\n    redisCommand: XPENDING\n",
+			expErr: "line 3: app a: consumerGroup is required",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  ruleType: Queue\n  metricType: Redis\n  config:\n    targetQueueLength: 5\n    key: jobs\n    redisCommand: LRANGE\n",
+			expErr: "Unsupported Redis command LRANGE",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  maxContainers: 2\n  failSafeContainers: -1\n",
+			expErr: "line 3: app a: failSafeContainers must not be negative",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  config:\n    ports:\n    - 8080:http\n",
+			expErr: "line 3: app a: Bad container port in port 8080:http",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  config:\n    restartPolicy: sometimes\n",
+			expErr: "line 3: app a: Bad restart policy sometimes",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- name: a\n  config:\n    preStopHTTP: drain\n",
+			expErr: "line 3: app a: Bad port in HTTP hook drain",
+		},
+		{
+			config: "maxContainers: 10\napps:\n- priority: 1\n",
+			expErr: "app 1: name is required",
+		},
+	}
+
+	for i, test := range tests {
+		_, _, err := appsFromFile([]byte(test.config))
+		if err == nil {
+			t.Errorf("Test %d: expected an error", i)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.expErr) {
+			t.Errorf("Test %d: expected error containing %q, got %q", i, test.expErr, err.Error())
+		}
+	}
+}
@@ -10,4 +10,11 @@ type Config interface {
 	GetApps(userID string) (tasks []*demand.Task, maxContainers int, err error)
 }
 
+// Watcher is implemented by configs that can tell us as soon as the task config changes, so we can reload it
+type Watcher interface {
+	// Watch sends on the changed channel whenever the config changes, until StopWatch is called
+	Watch(changed chan<- struct{})
+	StopWatch()
+}
+
 var log = logging.MustGetLogger("mssconfig")
@@ -98,6 +98,14 @@ func parseLabels(task *demand.Task, labels map[string]string) {
 		}
 	}
 
+	if policy, ok := labels["com.microscaling.shutdown-policy"]; ok {
+		if p, err := demand.ParseShutdownPolicy(policy); err == nil {
+			task.ShutdownPolicy = p
+		} else {
+			log.Infof("Ignoring bad value for label com.microscaling.shutdown-policy")
+		}
+	}
+
 	v, err := parseIntLabel(labels, "com.microscaling.priority")
 	if err == nil {
 		task.Priority = v
@@ -0,0 +1,418 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+
+	"github.com/microscaling/microscaling/api"
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/target"
+	"github.com/microscaling/microscaling/utils"
+)
+
+const (
+	// The API server ends each watch after this long, and we start another one
+	constPolicyWatchTimeout = 5 * time.Minute
+	// How long to wait before listing again if the watch fails
+	constPolicyWatchRetryInterval = 5 * time.Second
+)
+
+// KubePolicyConfig gets task config from MicroscalingPolicy custom resources, and watches them so that changes take
+// effect straight away
+type KubePolicyConfig struct {
+	KubeConfig    string
+	KubeNamespace string // empty for all namespaces
+	clientset     *kubernetes.Clientset
+	// The generation of each policy, indexed by namespace/name. Status updates don't change the generation, so
+	// we can tell them apart from changes to the spec.
+	generations map[string]int64
+	stream      io.ReadCloser
+	stopped     bool
+	stop        chan struct{}
+	sync.Mutex
+}
+
+// compile-time assert that we implement the right interface
+var _ Config = (*KubePolicyConfig)(nil)
+var _ Watcher = (*KubePolicyConfig)(nil)
+
+// policy is a MicroscalingPolicy
+type policy struct {
+	Metadata struct {
+		Name       string `json:"name"`
+		Namespace  string `json:"namespace"`
+		Generation int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec policySpec `json:"spec"`
+}
+
+type policySpec struct {
+	// The workload to scale. Kind defaults to Deployment, and apiVersion and resource are only needed for custom
+	// resources.
+	TargetRef struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+		Resource   string `json:"resource"`
+		Name       string `json:"name"`
+	} `json:"targetRef"`
+	Priority           int          `json:"priority"`
+	MinContainers      int          `json:"minContainers"`
+	MaxContainers      int          `json:"maxContainers"`
+	MaxDelta           int          `json:"maxDelta"`
+	RuleType           string       `json:"ruleType"`
+	TargetValue        int          `json:"targetValue"`
+	FailSafeContainers *int         `json:"failSafeContainers"`
+	ShutdownPolicy     string       `json:"shutdownPolicy"`
+	CPU                float64      `json:"cpu"`    // cores requested by each pod
+	Memory             int64        `json:"memory"` // MB requested by each pod
+	Metric             policyMetric `json:"metric"`
+	Gains              *policyGains `json:"gains"`
+}
+
+// policyMetric is where we read the metric from, with the same parameters as the file-based config
+type policyMetric struct {
+	Type           string `json:"type"`
+	QueueName      string `json:"queueName"`
+	TopicName      string `json:"topicName"`
+	ChannelName    string `json:"channelName"`
+	QueueURL       string `json:"queueURL"`
+	Query          string `json:"query"`
+	Vhost          string `json:"vhost"`
+	IncludeUnacked bool   `json:"includeUnacked"`
+	ConsumerGroup  string `json:"consumerGroup"`
+	RedisCommand   string `json:"redisCommand"`
+	Key            string `json:"key"`
+}
+
+// policyGains override the PID controller constants for the Queue rule type. Any that aren't set come from the
+// environment as usual.
+type policyGains struct {
+	KP *float64 `json:"kP"`
+	KI *float64 `json:"kI"`
+	KD *float64 `json:"kD"`
+}
+
+type policyList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []policy `json:"items"`
+}
+
+type policyEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// NewKubePolicyConfig gets a new KubePolicyConfig. If the namespace is empty we look for policies in all namespaces.
+func NewKubePolicyConfig(KubeConfig string, KubeNamespace string) *KubePolicyConfig {
+	return &KubePolicyConfig{
+		KubeConfig:    KubeConfig,
+		KubeNamespace: KubeNamespace,
+		stop:          make(chan struct{}),
+	}
+}
+
+// GetApps builds a task for each MicroscalingPolicy. Policies with bad config are left out, so they don't stop us
+// scaling the others. The maximum number of containers is the total of the tasks' maximums.
+func (kp *KubePolicyConfig) GetApps(userID string) (tasks []*demand.Task, maxContainers int, err error) {
+	list, err := kp.listPolicies()
+	if err != nil {
+		log.Errorf("Error listing MicroscalingPolicies: %v", err)
+		return
+	}
+
+	for i := range list.Items {
+		p := &list.Items[i]
+
+		task, err := kp.taskFromPolicy(p)
+		if err != nil {
+			log.Errorf("Ignoring MicroscalingPolicy %s/%s: %v", p.Metadata.Namespace, p.Metadata.Name, err)
+			continue
+		}
+
+		tasks = append(tasks, task)
+		maxContainers += task.MaxContainers
+	}
+
+	return tasks, maxContainers, nil
+}
+
+// taskFromPolicy translates the policy's spec into a task. Tasks are named after their policy, or namespace/policy
+// if we're looking in all namespaces.
+func (kp *KubePolicyConfig) taskFromPolicy(p *policy) (*demand.Task, error) {
+	spec := p.Spec
+	if spec.TargetRef.Name == "" {
+		return nil, fmt.Errorf("targetRef name is required")
+	}
+
+	a := api.AppDescription{
+		Name:           p.Metadata.Name,
+		Priority:       spec.Priority,
+		MinContainers:  spec.MinContainers,
+		MaxContainers:  spec.MaxContainers,
+		MaxDelta:       spec.MaxDelta,
+		RuleType:       spec.RuleType,
+		MetricType:     spec.Metric.Type,
+		ShutdownPolicy: spec.ShutdownPolicy,
+		CPU:            spec.CPU,
+		Memory:         spec.Memory,
+		FailSafe:       spec.FailSafeContainers,
+		Kind:           spec.TargetRef.Kind,
+		APIVersion:     spec.TargetRef.APIVersion,
+		Resource:       spec.TargetRef.Resource,
+		Config: api.DockerAppConfig{
+			QueueLength:    spec.TargetValue,
+			QueueName:      spec.Metric.QueueName,
+			TopicName:      spec.Metric.TopicName,
+			ChannelName:    spec.Metric.ChannelName,
+			QueueURL:       spec.Metric.QueueURL,
+			Query:          spec.Metric.Query,
+			Vhost:          spec.Metric.Vhost,
+			IncludeUnacked: spec.Metric.IncludeUnacked,
+			ConsumerGroup:  spec.Metric.ConsumerGroup,
+			RedisCommand:   spec.Metric.RedisCommand,
+			Key:            spec.Metric.Key,
+		},
+	}
+
+	if kp.KubeNamespace == "" {
+		a.Name = p.Metadata.Namespace + "/" + p.Metadata.Name
+	}
+
+	// Check the config the same way as for a config file
+	err := validateApp(a)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := api.NewTask(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.Metric == nil {
+		return nil, fmt.Errorf("Unknown metric type %s", spec.Metric.Type)
+	}
+
+	if spec.Gains != nil {
+		q, ok := task.Target.(*target.QueueLengthTarget)
+		if !ok {
+			return nil, fmt.Errorf("PID gains can only be set for the Queue rule type")
+		}
+
+		g := q.Gains()
+		if spec.Gains.KP != nil {
+			g.KP = *spec.Gains.KP
+		}
+		if spec.Gains.KI != nil {
+			g.KI = *spec.Gains.KI
+		}
+		if spec.Gains.KD != nil {
+			g.KD = *spec.Gains.KD
+		}
+		q.SetGains(g)
+	}
+
+	task.Workload.Namespace = p.Metadata.Namespace
+	task.Workload.Name = spec.TargetRef.Name
+	task.Policy = demand.PolicyRef{
+		Namespace: p.Metadata.Namespace,
+		Name:      p.Metadata.Name,
+	}
+
+	return task, nil
+}
+
+// getClientset creates the clientset the first time we need it
+func (kp *KubePolicyConfig) getClientset() (*kubernetes.Clientset, error) {
+	kp.Lock()
+	defer kp.Unlock()
+
+	if kp.clientset == nil {
+		clientset, err := utils.NewKubeClientset(kp.KubeConfig, kp.KubeNamespace)
+		if err != nil {
+			return nil, err
+		}
+		kp.clientset = clientset
+	}
+
+	return kp.clientset, nil
+}
+
+func (kp *KubePolicyConfig) listPolicies() (list policyList, err error) {
+	clientset, err := kp.getClientset()
+	if err != nil {
+		return
+	}
+
+	b, err := clientset.Core().GetRESTClient().Get().AbsPath(utils.KubePolicyPath(kp.KubeNamespace, "")).Do().Raw()
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &list)
+	return
+}
+
+// Watch lists the policies and then watches them for changes, until StopWatch is called. If the watch fails we list
+// the policies again, as we may have missed changes.
+func (kp *KubePolicyConfig) Watch(changed chan<- struct{}) {
+	for {
+		resourceVersion, err := kp.syncGenerations(changed)
+		if err == nil {
+			err = kp.streamPolicies(resourceVersion, changed)
+		}
+
+		kp.Lock()
+		kp.stream = nil
+		stopped := kp.stopped
+		kp.Unlock()
+
+		if stopped {
+			return
+		}
+
+		// The API server ends the watch after the timeout, and we can carry straight on
+		if err == io.EOF {
+			continue
+		}
+
+		log.Errorf("Watch on MicroscalingPolicies failed: %v", err)
+
+		select {
+		case <-kp.stop:
+			return
+		case <-time.After(constPolicyWatchRetryInterval):
+		}
+	}
+}
+
+// StopWatch ends the watch
+func (kp *KubePolicyConfig) StopWatch() {
+	kp.Lock()
+	defer kp.Unlock()
+
+	if kp.stopped {
+		return
+	}
+
+	kp.stopped = true
+	close(kp.stop)
+	if kp.stream != nil {
+		kp.stream.Close()
+	}
+}
+
+// syncGenerations records the generation of each policy, and returns the resource version to watch from
+func (kp *KubePolicyConfig) syncGenerations(changed chan<- struct{}) (string, error) {
+	list, err := kp.listPolicies()
+	if err != nil {
+		return "", err
+	}
+
+	generations := make(map[string]int64, len(list.Items))
+	for _, p := range list.Items {
+		generations[p.Metadata.Namespace+"/"+p.Metadata.Name] = p.Metadata.Generation
+	}
+
+	kp.Lock()
+	previous := kp.generations
+	kp.generations = generations
+	kp.Unlock()
+
+	// We may have missed changes while we weren't watching
+	if !reflect.DeepEqual(previous, generations) {
+		notifyChanged(changed)
+	}
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+// streamPolicies lets us know about changes to policies until the watch ends
+func (kp *KubePolicyConfig) streamPolicies(resourceVersion string, changed chan<- struct{}) error {
+	clientset, err := kp.getClientset()
+	if err != nil {
+		return err
+	}
+
+	stream, err := clientset.Core().GetRESTClient().Get().AbsPath(utils.KubePolicyPath(kp.KubeNamespace, "")).
+		Param("watch", "true").
+		Param("resourceVersion", resourceVersion).
+		Param("timeoutSeconds", strconv.Itoa(int(constPolicyWatchTimeout/time.Second))).
+		Stream()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	kp.Lock()
+	if kp.stopped {
+		kp.Unlock()
+		return nil
+	}
+	kp.stream = stream
+	kp.Unlock()
+	log.Debugf("Watching MicroscalingPolicies")
+
+	decoder := json.NewDecoder(stream)
+	for {
+		var event policyEvent
+		err = decoder.Decode(&event)
+		if err != nil {
+			return err
+		}
+
+		// An error, such as the resource version being too old, means we need to list again
+		if event.Type == "ERROR" {
+			return fmt.Errorf("Watch error %s", string(event.Object))
+		}
+
+		var p policy
+		err = json.Unmarshal(event.Object, &p)
+		if err != nil {
+			return err
+		}
+
+		if kp.handlePolicyEvent(event.Type, &p) {
+			notifyChanged(changed)
+		}
+	}
+}
+
+// handlePolicyEvent returns true if a policy has been added or removed, or its spec has changed
+func (kp *KubePolicyConfig) handlePolicyEvent(eventType string, p *policy) bool {
+	name := p.Metadata.Namespace + "/" + p.Metadata.Name
+	log.Debugf("[watch] %s MicroscalingPolicy %s", eventType, name)
+
+	kp.Lock()
+	defer kp.Unlock()
+
+	generation, known := kp.generations[name]
+
+	switch eventType {
+	case "ADDED", "MODIFIED":
+		kp.generations[name] = p.Metadata.Generation
+		return !known || generation != p.Metadata.Generation
+	case "DELETED":
+		delete(kp.generations, name)
+		return known
+	}
+
+	return false
+}
+
+func notifyChanged(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+		// There's already a change waiting to be handled
+	}
+}
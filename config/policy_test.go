@@ -0,0 +1,240 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/rest"
+
+	"github.com/microscaling/microscaling/target"
+)
+
+const testPolicyList = `{
+  "kind": "MicroscalingPolicyList",
+  "apiVersion": "microscaling.com/v1alpha1",
+  "metadata": {"resourceVersion": "10"},
+  "items": [
+    {
+      "metadata": {"name": "consumer", "namespace": "queues", "generation": 2},
+      "spec": {
+        "targetRef": {"kind": "StatefulSet", "name": "consumer-set"},
+        "priority": 1,
+        "minContainers": 1,
+        "maxContainers": 10,
+        "ruleType": "Queue",
+        "targetValue": 50,
+        "failSafeContainers": 3,
+        "cpu": 0.5,
+        "metric": {"type": "NSQ", "topicName": "microscaling-demo", "channelName": "microscaling-demo"},
+        "gains": {"kP": 0.5}
+      }
+    },
+    {
+      "metadata": {"name": "remainder", "namespace": "queues", "generation": 1},
+      "spec": {"targetRef": {"name": "remainder"}, "priority": 2, "maxContainers": 5}
+    },
+    {
+      "metadata": {"name": "no-target", "namespace": "queues", "generation": 1},
+      "spec": {"priority": 2, "maxContainers": 5}
+    },
+    {
+      "metadata": {"name": "bad-gains", "namespace": "queues", "generation": 1},
+      "spec": {
+        "targetRef": {"name": "bad-gains"},
+        "ruleType": "SimpleQueue",
+        "targetValue": 10,
+        "metric": {"type": "NSQ", "topicName": "microscaling-demo", "channelName": "microscaling-demo"},
+        "gains": {"kP": 0.5}
+      }
+    },
+    {
+      "metadata": {"name": "invalid", "namespace": "queues", "generation": 1},
+      "spec": {"targetRef": {"name": "invalid"}, "minContainers": 5, "maxContainers": 2}
+    }
+  ]
+}`
+
+func TestKubePolicyConfig(t *testing.T) {
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testPolicyList))
+	}))
+	defer server.Close()
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	kp := NewKubePolicyConfig("", "queues")
+	kp.clientset = clientset
+
+	tasks, maxContainers, err := kp.GetApps("")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/apis/microscaling.com/v1alpha1/namespaces/queues/microscalingpolicies" {
+		t.Errorf("Unexpected requests %v", paths)
+	}
+
+	// Policies with bad config are left out
+	if len(tasks) != 2 || maxContainers != 15 {
+		t.Fatalf("Expected 2 tasks with 15 max containers, got %d with %d", len(tasks), maxContainers)
+	}
+
+	consumer := tasks[0]
+	if consumer.Name != "consumer" || consumer.Priority != 1 || consumer.MinContainers != 1 || consumer.MaxContainers != 10 {
+		t.Errorf("Bad consumer task %+v", consumer)
+	}
+
+	if !consumer.FailSafe || consumer.FailSafeContainers != 3 || consumer.Resources.CPU != 0.5 || consumer.Metric == nil {
+		t.Errorf("Bad consumer fail-safe, resources or metric %+v", consumer)
+	}
+
+	queue, ok := consumer.Target.(*target.QueueLengthTarget)
+	if !ok || queue.Value() != 50 {
+		t.Fatalf("Bad consumer target %#v", consumer.Target)
+	}
+
+	// Gains that aren't set in the policy keep their defaults
+	defaults := target.NewQueueLengthTarget(50).Gains()
+	if g := queue.Gains(); g.KP != 0.5 || g.KI != defaults.KI || g.KD != defaults.KD {
+		t.Errorf("Bad consumer gains %+v", g)
+	}
+
+	if w := consumer.Workload; w.Kind != "StatefulSet" || w.Namespace != "queues" || w.Name != "consumer-set" {
+		t.Errorf("Bad consumer workload %+v", w)
+	}
+
+	if consumer.Policy.Namespace != "queues" || consumer.Policy.Name != "consumer" {
+		t.Errorf("Bad consumer policy %+v", consumer.Policy)
+	}
+
+	if tasks[1].Name != "remainder" || !tasks[1].IsRemainder() || tasks[1].Workload.Name != "remainder" {
+		t.Errorf("Bad remainder task %+v", tasks[1])
+	}
+
+	// Across all namespaces, tasks include the namespace in their names
+	paths = nil
+	kp = NewKubePolicyConfig("", "")
+	kp.clientset = clientset
+
+	tasks, _, err = kp.GetApps("")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/apis/microscaling.com/v1alpha1/microscalingpolicies" {
+		t.Errorf("Unexpected requests %v", paths)
+	}
+
+	if len(tasks) != 2 || tasks[0].Name != "queues/consumer" || tasks[0].Policy.Name != "consumer" {
+		t.Errorf("Expected tasks named with their namespace, got %+v", tasks)
+	}
+}
+
+func TestKubePolicyEvents(t *testing.T) {
+	kp := NewKubePolicyConfig("", "queues")
+	kp.generations = map[string]int64{"queues/consumer": 2}
+
+	tests := []struct {
+		eventType  string
+		name       string
+		generation int64
+		changed    bool
+	}{
+		// Status updates don't change the generation
+		{eventType: "MODIFIED", name: "consumer", generation: 2, changed: false},
+		{eventType: "MODIFIED", name: "consumer", generation: 3, changed: true},
+		{eventType: "ADDED", name: "new", generation: 1, changed: true},
+		{eventType: "DELETED", name: "consumer", generation: 3, changed: true},
+		{eventType: "DELETED", name: "unknown", generation: 1, changed: false},
+	}
+
+	for _, test := range tests {
+		var p policy
+		p.Metadata.Namespace = "queues"
+		p.Metadata.Name = test.name
+		p.Metadata.Generation = test.generation
+
+		if changed := kp.handlePolicyEvent(test.eventType, &p); changed != test.changed {
+			t.Errorf("%s %s generation %d: expected changed %t", test.eventType, test.name, test.generation, test.changed)
+		}
+	}
+
+	if len(kp.generations) != 1 || kp.generations["queues/new"] != 1 {
+		t.Errorf("Unexpected generations %v", kp.generations)
+	}
+}
+
+func TestKubePolicyWatch(t *testing.T) {
+	proceed := make(chan struct{})
+	done := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") != "true" {
+			w.Write([]byte(testPolicyList))
+			return
+		}
+
+		if r.URL.Query().Get("resourceVersion") != "10" {
+			t.Errorf("Expected to watch from the list's resource version, got %s", r.URL.RawQuery)
+		}
+
+		select {
+		case <-proceed:
+		case <-done:
+			return
+		}
+
+		w.Write([]byte(`{"type": "MODIFIED", "object": {"metadata": {"name": "consumer", "namespace": "queues", "generation": 3}}}` + "\n"))
+		w.(http.Flusher).Flush()
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	kp := NewKubePolicyConfig("", "queues")
+	kp.clientset = clientset
+
+	changed := make(chan struct{}, 1)
+	returned := make(chan struct{})
+	go func() {
+		kp.Watch(changed)
+		close(returned)
+	}()
+
+	// We may have missed changes before the watch started
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a change after the first list")
+	}
+
+	close(proceed)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a change when the policy's generation changed")
+	}
+
+	kp.StopWatch()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the watch to stop")
+	}
+}
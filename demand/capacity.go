@@ -0,0 +1,67 @@
+package demand
+
+import (
+	"fmt"
+	"math"
+)
+
+// Resources describes an amount of CPU and memory. This might be what a single container of a task requests,
+// or the total available for running tasks.
+type Resources struct {
+	CPU    float64 // cores
+	Memory int64   // MB
+}
+
+func (r Resources) String() string {
+	return fmt.Sprintf("%.2f CPU, %d MB", r.CPU, r.Memory)
+}
+
+// Capacity keeps track of how much space we have for more containers. We always limit the total number of containers,
+// and we also limit CPU and memory if we know the total amount available.
+type Capacity struct {
+	Containers  int
+	Resources   Resources
+	limitCPU    bool
+	limitMemory bool
+}
+
+func (c Capacity) String() string {
+	s := fmt.Sprintf("%d containers", c.Containers)
+	if c.limitCPU {
+		s += fmt.Sprintf(", %.2f CPU", c.Resources.CPU)
+	}
+	if c.limitMemory {
+		s += fmt.Sprintf(", %d MB", c.Resources.Memory)
+	}
+	return s
+}
+
+// Fits returns the number of containers of this task we have space for. This can be negative if we are already
+// over capacity.
+func (c Capacity) Fits(t *Task) int {
+	n := c.Containers
+
+	if c.limitCPU && t.Resources.CPU > 0 {
+		// Allow a little leeway for floating point rounding
+		cpu := int(math.Floor(c.Resources.CPU/t.Resources.CPU + 1e-9))
+		if cpu < n {
+			n = cpu
+		}
+	}
+
+	if c.limitMemory && t.Resources.Memory > 0 {
+		memory := int(math.Floor(float64(c.Resources.Memory) / float64(t.Resources.Memory)))
+		if memory < n {
+			n = memory
+		}
+	}
+
+	return n
+}
+
+// Take uses up the space for n containers of this task. If n is negative the space is freed up.
+func (c *Capacity) Take(t *Task, n int) {
+	c.Containers -= n
+	c.Resources.CPU -= float64(n) * t.Resources.CPU
+	c.Resources.Memory -= int64(n) * t.Resources.Memory
+}
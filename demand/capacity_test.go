@@ -0,0 +1,63 @@
+package demand
+
+import (
+	"testing"
+)
+
+func TestCapacityResources(t *testing.T) {
+	tt := getTestTasks()
+	tt.Capacity = Resources{CPU: 4, Memory: 8192}
+
+	// Each of the 3 tasks has 2 requested
+	tt.Tasks[0].Resources = Resources{CPU: 0.5, Memory: 256}
+	tt.Tasks[1].Resources = Resources{CPU: 0.25, Memory: 1024}
+	tt.Tasks[2].Resources = Resources{}
+
+	c := tt.CheckCapacity()
+	if c.Containers != 4 {
+		t.Fatalf("Expected space for 4 containers, got %d", c.Containers)
+	}
+
+	if c.Resources.CPU != 2.5 || c.Resources.Memory != 5632 {
+		t.Fatalf("Unexpected resources remaining %v", c.Resources)
+	}
+
+	// Limited by the container count
+	if c.Fits(tt.Tasks[0]) != 4 {
+		t.Errorf("Expected 4 to fit, got %d", c.Fits(tt.Tasks[0]))
+	}
+
+	// Limited by memory
+	big := &Task{Resources: Resources{CPU: 0.1, Memory: 2048}}
+	if c.Fits(big) != 2 {
+		t.Errorf("Expected 2 to fit, got %d", c.Fits(big))
+	}
+
+	// Limited by CPU
+	busy := &Task{Resources: Resources{CPU: 1.25, Memory: 10}}
+	if c.Fits(busy) != 2 {
+		t.Errorf("Expected 2 to fit, got %d", c.Fits(busy))
+	}
+
+	c.Take(busy, 2)
+	if c.Fits(busy) != 0 || c.Containers != 2 {
+		t.Errorf("Expected no space left for busy, got %d", c.Fits(busy))
+	}
+
+	// Freeing up space
+	c.Take(tt.Tasks[0], -2)
+	if c.Resources.CPU != 1 {
+		t.Errorf("Expected 1 CPU after freeing, got %f", c.Resources.CPU)
+	}
+}
+
+func TestCapacityContainersOnly(t *testing.T) {
+	tt := getTestTasks()
+	tt.Tasks[0].Resources = Resources{CPU: 100, Memory: 100000}
+
+	// With no total capacity configured we only limit the number of containers
+	c := tt.CheckCapacity()
+	if c.Fits(tt.Tasks[0]) != 4 {
+		t.Errorf("Expected 4 to fit, got %d", c.Fits(tt.Tasks[0]))
+	}
+}
@@ -0,0 +1,156 @@
+package demand
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ContainerSpec has the settings for creating a task's containers, in addition to the image, command and environment
+type ContainerSpec struct {
+	// Limits for each container. 0 means no limit.
+	MemoryLimit int64   // MB
+	CPULimit    float64 // cores
+
+	Ports []PortBinding
+	// Bind mounts and named volumes, in the form source:target[:options]
+	Volumes []string
+	Labels  map[string]string
+	User    string
+
+	LogDriver  string
+	LogOptions map[string]string
+
+	// RestartPolicy is no, always, unless-stopped or on-failure. MaxRetries only applies to on-failure.
+	RestartPolicy string
+	MaxRetries    int
+
+	// Credentials for pulling the image, if they aren't in the Docker config file
+	RegistryUsername string
+	RegistryPassword string
+
+	// Containers are sent the stop signal (by default the image's, usually SIGTERM) and killed if they haven't exited
+	// after StopTimeout seconds. 0 means the default timeout.
+	StopTimeout int
+	StopSignal  string
+
+	// Hooks that run before a container is stopped, so it can finish in-flight work. They count towards the timeout.
+	PreStopHTTP *HTTPHook
+	PreStopExec string
+}
+
+// HTTPHook is a GET request to a port and path on the container
+type HTTPHook struct {
+	Port int
+	Path string
+}
+
+// ParseHTTPHook reads a hook in the form port/path, e.g. 8080/drain
+func ParseHTTPHook(hook string) (*HTTPHook, error) {
+	parts := strings.SplitN(hook, "/", 2)
+
+	port, err := parsePortNumber(parts[0])
+	if err != nil || port == 0 {
+		return nil, fmt.Errorf("Bad port in HTTP hook %s", hook)
+	}
+
+	h := &HTTPHook{Port: port, Path: "/"}
+	if len(parts) > 1 {
+		h.Path += parts[1]
+	}
+
+	return h, nil
+}
+
+// PortBinding publishes a container port. If HostPort is 0, the host port is chosen for us.
+type PortBinding struct {
+	HostIP        string
+	HostPort      int
+	ContainerPort int
+	Protocol      string // tcp or udp
+}
+
+// ParsePortBinding reads a port binding in the same form as docker run -p, e.g. 8080:80, 127.0.0.1:8080:80/tcp or 53/udp
+func ParsePortBinding(port string) (PortBinding, error) {
+	p := PortBinding{Protocol: "tcp"}
+
+	spec := port
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		p.Protocol = spec[i+1:]
+		spec = spec[:i]
+	}
+
+	if p.Protocol != "tcp" && p.Protocol != "udp" {
+		return p, fmt.Errorf("Bad protocol in port %s", port)
+	}
+
+	var hostPort, containerPort string
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		containerPort = parts[0]
+	case 2:
+		hostPort, containerPort = parts[0], parts[1]
+	case 3:
+		p.HostIP, hostPort, containerPort = parts[0], parts[1], parts[2]
+		if p.HostIP != "" && net.ParseIP(p.HostIP) == nil {
+			return p, fmt.Errorf("Bad host IP in port %s", port)
+		}
+	default:
+		return p, fmt.Errorf("Bad port %s", port)
+	}
+
+	var err error
+	p.ContainerPort, err = parsePortNumber(containerPort)
+	if err != nil || p.ContainerPort == 0 {
+		return p, fmt.Errorf("Bad container port in port %s", port)
+	}
+
+	if hostPort != "" {
+		p.HostPort, err = parsePortNumber(hostPort)
+		if err != nil {
+			return p, fmt.Errorf("Bad host port in port %s", port)
+		}
+	}
+
+	return p, nil
+}
+
+func parsePortNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 0 || n > 65535 {
+		return 0, fmt.Errorf("Port %d out of range", n)
+	}
+
+	return n, nil
+}
+
+// ParseRestartPolicy reads a restart policy in the same form as docker run --restart, e.g. always or on-failure:3.
+// An empty string means the containers aren't restarted.
+func ParseRestartPolicy(policy string) (name string, maxRetries int, err error) {
+	parts := strings.SplitN(policy, ":", 2)
+	name = parts[0]
+
+	switch name {
+	case "", "no", "always", "unless-stopped":
+		if len(parts) > 1 {
+			return "", 0, fmt.Errorf("Maximum retries can only be set for restart policy on-failure")
+		}
+	case "on-failure":
+		if len(parts) > 1 {
+			maxRetries, err = strconv.Atoi(parts[1])
+			if err != nil || maxRetries < 0 {
+				return "", 0, fmt.Errorf("Bad maximum retries in restart policy %s", policy)
+			}
+		}
+	default:
+		return "", 0, fmt.Errorf("Bad restart policy %s", policy)
+	}
+
+	return name, maxRetries, nil
+}
@@ -0,0 +1,97 @@
+package demand
+
+import (
+	"testing"
+)
+
+func TestParsePortBinding(t *testing.T) {
+	tests := []struct {
+		port     string
+		expected PortBinding
+		pass     bool
+	}{
+		{port: "80", expected: PortBinding{ContainerPort: 80, Protocol: "tcp"}, pass: true},
+		{port: "8080:80", expected: PortBinding{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}, pass: true},
+		{port: "127.0.0.1:8080:80/tcp", expected: PortBinding{HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}, pass: true},
+		{port: "127.0.0.1::53/udp", expected: PortBinding{HostIP: "127.0.0.1", ContainerPort: 53, Protocol: "udp"}, pass: true},
+		{port: "", pass: false},
+		{port: "80/sctp", pass: false},
+		{port: "http", pass: false},
+		{port: "8080:70000", pass: false},
+		{port: "localhost:8080:80", pass: false},
+		{port: "1:2:3:4", pass: false},
+	}
+
+	for _, test := range tests {
+		p, err := ParsePortBinding(test.port)
+		if err != nil && test.pass {
+			t.Errorf("Should have been able to parse %s: %v", test.port, err)
+		}
+		if err == nil && !test.pass {
+			t.Errorf("Should not have been able to parse %s", test.port)
+		}
+		if test.pass && p != test.expected {
+			t.Errorf("Expected %+v for %s, got %+v", test.expected, test.port, p)
+		}
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy     string
+		name       string
+		maxRetries int
+		pass       bool
+	}{
+		{policy: "", name: "", pass: true},
+		{policy: "no", name: "no", pass: true},
+		{policy: "always", name: "always", pass: true},
+		{policy: "unless-stopped", name: "unless-stopped", pass: true},
+		{policy: "on-failure", name: "on-failure", pass: true},
+		{policy: "on-failure:3", name: "on-failure", maxRetries: 3, pass: true},
+		{policy: "on-failure:-1", pass: false},
+		{policy: "always:3", pass: false},
+		{policy: "sometimes", pass: false},
+	}
+
+	for _, test := range tests {
+		name, maxRetries, err := ParseRestartPolicy(test.policy)
+		if err != nil && test.pass {
+			t.Errorf("Should have been able to parse %s: %v", test.policy, err)
+		}
+		if err == nil && !test.pass {
+			t.Errorf("Should not have been able to parse %s", test.policy)
+		}
+		if test.pass && (name != test.name || maxRetries != test.maxRetries) {
+			t.Errorf("Expected %s %d for %s, got %s %d", test.name, test.maxRetries, test.policy, name, maxRetries)
+		}
+	}
+}
+
+func TestParseHTTPHook(t *testing.T) {
+	tests := []struct {
+		hook     string
+		expected HTTPHook
+		pass     bool
+	}{
+		{hook: "8080/drain", expected: HTTPHook{Port: 8080, Path: "/drain"}, pass: true},
+		{hook: "80/admin/drain?wait=true", expected: HTTPHook{Port: 80, Path: "/admin/drain?wait=true"}, pass: true},
+		{hook: "8080", expected: HTTPHook{Port: 8080, Path: "/"}, pass: true},
+		{hook: "", pass: false},
+		{hook: "/drain", pass: false},
+		{hook: "http://localhost/drain", pass: false},
+	}
+
+	for _, test := range tests {
+		h, err := ParseHTTPHook(test.hook)
+		if err != nil && test.pass {
+			t.Errorf("Should have been able to parse %s: %v", test.hook, err)
+		}
+		if err == nil && !test.pass {
+			t.Errorf("Should not have been able to parse %s", test.hook)
+		}
+		if test.pass && err == nil && *h != test.expected {
+			t.Errorf("Expected %+v for %s, got %+v", test.expected, test.hook, *h)
+		}
+	}
+}
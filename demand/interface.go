@@ -3,6 +3,7 @@ package demand
 
 import (
 	"sync"
+	"time"
 
 	"github.com/op/go-logging"
 
@@ -14,6 +15,10 @@ import (
 type Tasks struct {
 	Tasks         []*Task
 	MaxContainers int
+	// Total resources available for running tasks. We don't limit CPU or memory if they are 0.
+	Capacity Resources
+	// Number of times the scheduler has returned an error
+	SchedulerErrors int
 	sync.RWMutex
 }
 
@@ -28,6 +33,9 @@ type Task struct {
 	Demand    int
 	Requested int
 	Running   int
+	// Healthy is how many of the running containers aren't failing their health check. Containers with no health
+	// check, or whose health check is still starting, count as healthy.
+	Healthy int
 
 	// Container config info
 	FamilyName      string
@@ -36,6 +44,11 @@ type Task struct {
 	PublishAllPorts bool
 	NetworkMode     string
 	Env             []string
+	Container       ContainerSpec
+	Workload        Workload
+
+	// The Kubernetes MicroscalingPolicy this task was created from, if any
+	Policy PolicyRef
 
 	// Scaling config
 	IsScalable    bool
@@ -44,14 +57,39 @@ type Task struct {
 	MinContainers int
 	MaxContainers int
 
+	// Resources requested by each container
+	Resources Resources
+
 	// The target we're aiming for
 	Target target.Target
 
 	// Measurements
 	Metric metric.Metric
 
+	// When the metric was last read successfully, and whether it's currently failing or too old to scale on
+	MetricSampled time.Time
+	MetricFailing bool
+	// The error from the latest attempt to read the metric, if it failed
+	MetricError string
+
+	// While the metric is failing we scale to the fail-safe number of containers if one is set, or leave the task alone
+	FailSafe           bool
+	FailSafeContainers int
+
 	// Scaling calculation of the ideal number of containers we'd have if there were no other tasks
 	IdealContainers int
+
+	// Number of times we've asked the scheduler to scale this task up or down
+	ScaleUps   int
+	ScaleDowns int
+	LastScaled time.Time
+
+	// What to do with this task's containers when we exit, and how many were running when we started
+	ShutdownPolicy ShutdownPolicy
+	InitialCount   int
+
+	// Retiring is set when this task has been removed from the config, and we're waiting for its shutdown policy to be applied
+	Retiring bool
 }
 
 var log = logging.MustGetLogger("mssdemand")
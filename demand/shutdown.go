@@ -0,0 +1,46 @@
+package demand
+
+import (
+	"fmt"
+)
+
+// ShutdownPolicy determines what we do with a task's containers when microscaling exits, or when the task
+// is removed from the config
+type ShutdownPolicy string
+
+const (
+	// ScaleToZero stops all the containers for the task. This is the default if no policy is set.
+	ScaleToZero ShutdownPolicy = "scale-to-zero"
+	// ScaleToMin leaves the task running with its minimum number of containers
+	ScaleToMin ShutdownPolicy = "scale-to-min"
+	// LeaveAsIs doesn't touch the task's containers at all
+	LeaveAsIs ShutdownPolicy = "leave-as-is"
+	// RestoreInitial scales back to the number of containers that were running when we started managing the task
+	RestoreInitial ShutdownPolicy = "restore-initial"
+)
+
+// ParseShutdownPolicy checks that the string is a valid shutdown policy. An empty string is allowed, and means
+// the default policy applies.
+func ParseShutdownPolicy(policy string) (ShutdownPolicy, error) {
+	switch ShutdownPolicy(policy) {
+	case "", ScaleToZero, ScaleToMin, LeaveAsIs, RestoreInitial:
+		return ShutdownPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("Bad shutdown policy %s", policy)
+}
+
+// ShutdownDemand tells us how many containers this task should be left with under its shutdown policy.
+// If the policy is to leave the task alone, scale is false.
+func (t *Task) ShutdownDemand() (demand int, scale bool) {
+	switch t.ShutdownPolicy {
+	case LeaveAsIs:
+		return t.Requested, false
+	case ScaleToMin:
+		return t.MinContainers, true
+	case RestoreInitial:
+		return t.InitialCount, true
+	default:
+		return 0, true
+	}
+}
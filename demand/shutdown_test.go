@@ -0,0 +1,103 @@
+package demand
+
+import (
+	"testing"
+)
+
+func TestParseShutdownPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		pass   bool
+	}{
+		{policy: "", pass: true},
+		{policy: "scale-to-zero", pass: true},
+		{policy: "scale-to-min", pass: true},
+		{policy: "leave-as-is", pass: true},
+		{policy: "restore-initial", pass: true},
+		{policy: "scale-to-one", pass: false},
+	}
+
+	for _, test := range tests {
+		_, err := ParseShutdownPolicy(test.policy)
+		if err != nil && test.pass {
+			t.Errorf("Should have been able to parse %s", test.policy)
+		}
+		if err == nil && !test.pass {
+			t.Errorf("Should not have been able to parse %s", test.policy)
+		}
+	}
+}
+
+func TestShutdownDemand(t *testing.T) {
+	tests := []struct {
+		policy ShutdownPolicy
+		demand int
+		scale  bool
+	}{
+		{policy: "", demand: 0, scale: true},
+		{policy: ScaleToZero, demand: 0, scale: true},
+		{policy: ScaleToMin, demand: 1, scale: true},
+		{policy: LeaveAsIs, demand: 5, scale: false},
+		{policy: RestoreInitial, demand: 3, scale: true},
+	}
+
+	for _, test := range tests {
+		task := Task{
+			ShutdownPolicy: test.policy,
+			MinContainers:  1,
+			InitialCount:   3,
+			Requested:      5,
+		}
+
+		demand, scale := task.ShutdownDemand()
+		if demand != test.demand || scale != test.scale {
+			t.Errorf("Policy %s: expected %d, %t but got %d, %t", test.policy, test.demand, test.scale, demand, scale)
+		}
+	}
+}
+
+func TestShutdownExited(t *testing.T) {
+	tt := getTestTasks()
+	tt.Tasks[0].ShutdownPolicy = LeaveAsIs
+	tt.Tasks[1].ShutdownPolicy = ScaleToMin
+	tt.Tasks[1].MinContainers = 1
+	tt.Tasks[1].Demand = 1
+	tt.Tasks[2].Running = 0
+
+	if tt.Exited() {
+		t.Fatal("Unexpectedly exited while still scaling to min")
+	}
+
+	tt.Tasks[1].Running = 1
+	if !tt.Exited() {
+		t.Fatal("Unexpectedly not exited")
+	}
+}
+
+func TestShutdownRetire(t *testing.T) {
+	tt := getTestTasks()
+	tt.Tasks[1].ShutdownPolicy = LeaveAsIs
+	tt.Tasks[2].ShutdownPolicy = ScaleToMin
+	tt.Tasks[2].MinContainers = 1
+
+	_, retired := tt.Update([]*Task{&Task{Name: "Zero"}}, 10)
+	if len(retired) != 2 {
+		t.Fatalf("Expected two tasks to be retired, got %d", len(retired))
+	}
+
+	// The leave-as-is task is removed straight away
+	if _, err := tt.GetTask("One"); err == nil {
+		t.Fatal("Expected One to be removed")
+	}
+
+	two, err := tt.GetTask("Two")
+	if err != nil || !two.Retiring || two.Demand != 1 {
+		t.Fatalf("Expected Two to be retiring to its minimum: %v", two)
+	}
+
+	two.Requested = 1
+	two.Running = 1
+	if removed := tt.RemoveRetired(); len(removed) != 1 {
+		t.Fatal("Expected Two to be removed once it has scaled to its minimum")
+	}
+}
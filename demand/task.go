@@ -3,6 +3,7 @@ package demand
 import (
 	"reflect"
 
+	"github.com/microscaling/microscaling/metric"
 	"github.com/microscaling/microscaling/target"
 )
 
@@ -13,13 +14,46 @@ func (t *Task) IsRemainder() bool {
 	return ruleType == remainderType
 }
 
+// MaxUsefulContainers is the most containers it's worth running for this task. This is MaxContainers unless the metric
+// sets a lower limit, but it's never less than MinContainers.
+func (t *Task) MaxUsefulContainers() int {
+	max := t.MaxContainers
+
+	if l, ok := t.Metric.(metric.ContainerLimiter); ok {
+		if limit := l.MaxContainers(); limit > 0 && limit < max {
+			max = limit
+		}
+	}
+
+	if max < t.MinContainers {
+		max = t.MinContainers
+	}
+
+	return max
+}
+
+// FailSafeDemand is the number of containers we want while the metric is failing, within the task's limits
+func (t *Task) FailSafeDemand() int {
+	demand := t.FailSafeContainers
+
+	if max := t.MaxUsefulContainers(); demand > max {
+		demand = max
+	}
+
+	if demand < t.MinContainers {
+		demand = t.MinContainers
+	}
+
+	return demand
+}
+
 // ScaleUpCount tells us how many containers to scale up by
 // Call this after IdealContainers has been updated
 func (t *Task) ScaleUpCount() (delta int) {
 	if t.Target.Meeting(t.Metric.Current()) {
 		delta = 0
 	} else {
-		delta = t.IdealContainers - t.Requested
+		delta = t.IdealContainers - t.HealthyRequested()
 		log.Debugf("Meeting -> delta %d", delta)
 	}
 
@@ -29,14 +63,15 @@ func (t *Task) ScaleUpCount() (delta int) {
 	}
 
 	// Make sure we do always have at least the minimum
-	if t.Requested+delta < t.MinContainers {
-		delta = t.MinContainers - t.Requested
+	if healthy := t.HealthyRequested(); healthy+delta < t.MinContainers {
+		delta = t.MinContainers - healthy
 		log.Debugf("Need minimum -> delta %d", delta)
 	}
 
 	// But make sure this won't exceed the maximum
-	if t.Requested+delta > t.MaxContainers {
-		delta = t.MaxContainers - t.Requested
+	max := t.MaxUsefulContainers()
+	if t.Requested+delta > max {
+		delta = max - t.Requested
 		log.Debugf("Can't exceed max -> delta %d", delta)
 	}
 
@@ -53,7 +88,7 @@ func (t *Task) ScaleUpCount() (delta int) {
 func (t *Task) ScaleDownCount() (delta int) {
 
 	if t.Target.Exceeding(t.Metric.Current()) {
-		delta = t.IdealContainers - t.Requested
+		delta = t.IdealContainers - t.HealthyRequested()
 		log.Debugf("Exceeding -> delta %d", delta)
 	} else {
 		delta = 0
@@ -65,14 +100,15 @@ func (t *Task) ScaleDownCount() (delta int) {
 	}
 
 	// Make sure we do always have at least the minimum
-	if t.Requested+delta < t.MinContainers {
-		delta = t.MinContainers - t.Requested
+	if healthy := t.HealthyRequested(); healthy+delta < t.MinContainers {
+		delta = t.MinContainers - healthy
 		log.Debugf("Need minimum -> delta %d", delta)
 	}
 
 	// Make sure this won't exceed the maximum
-	if t.Requested+delta > t.MaxContainers {
-		delta = t.MaxContainers - t.Requested
+	max := t.MaxUsefulContainers()
+	if t.Requested+delta > max {
+		delta = max - t.Requested
 		log.Debugf("Can't exceed max -> delta %d", delta)
 	}
 
@@ -84,6 +120,20 @@ func (t *Task) ScaleDownCount() (delta int) {
 	return
 }
 
+// Unhealthy returns the number of running containers that are failing their health check
+func (t *Task) Unhealthy() int {
+	if t.Healthy >= t.Running {
+		return 0
+	}
+	return t.Running - t.Healthy
+}
+
+// HealthyRequested is how many of the containers we've asked for are providing capacity. Unhealthy containers still
+// take up space, but they don't do any work, so they're left out of the ideal number of containers and the minimum.
+func (t *Task) HealthyRequested() int {
+	return t.Requested - t.Unhealthy()
+}
+
 // CanScaleDown returns the number we could scale down by
 func (t *Task) CanScaleDown() int {
 	if !t.IsScalable {
@@ -95,3 +145,35 @@ func (t *Task) CanScaleDown() int {
 	}
 	return t.Requested - t.MinContainers
 }
+
+// updateConfig takes the configuration from a newly loaded version of this task, keeping our scheduler state
+func (t *Task) updateConfig(nt *Task) {
+	t.FamilyName = nt.FamilyName
+	t.Image = nt.Image
+	t.Command = nt.Command
+	t.PublishAllPorts = nt.PublishAllPorts
+	t.NetworkMode = nt.NetworkMode
+	t.Env = nt.Env
+	t.Container = nt.Container
+	t.Workload = nt.Workload
+	t.Policy = nt.Policy
+
+	t.IsScalable = nt.IsScalable
+	t.Priority = nt.Priority
+	t.MaxDelta = nt.MaxDelta
+	t.MinContainers = nt.MinContainers
+	t.MaxContainers = nt.MaxContainers
+	t.Resources = nt.Resources
+	t.ShutdownPolicy = nt.ShutdownPolicy
+	t.FailSafe = nt.FailSafe
+	t.FailSafeContainers = nt.FailSafeContainers
+	t.Retiring = false
+
+	// Keep the existing target if we can, as it may be holding state such as PID controller history
+	if t.Target == nil || !t.Target.Update(nt.Target) {
+		t.Target = nt.Target
+	}
+
+	// The metric gets a new reading before it's next used, so we can simply replace it
+	t.Metric = nt.Metric
+}
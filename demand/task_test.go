@@ -128,6 +128,45 @@ func TestScaleDownCount(t *testing.T) {
 	}
 }
 
+func TestScaleUpUnhealthy(t *testing.T) {
+	_, testTask := getTestTask()
+	testTask.MinContainers = 2
+
+	// Unhealthy containers don't count towards the minimum
+	testTask.IdealContainers = 2
+	testTask.Requested = 2
+	testTask.Running = 2
+	testTask.Healthy = 1
+	if testTask.Unhealthy() != 1 {
+		t.Fatalf("Expected 1 unhealthy container")
+	}
+
+	if testTask.ScaleUpCount() != 1 {
+		t.Fatalf("Unexpected scale up count with an unhealthy container")
+	}
+
+	// Or the minimum when scaling down
+	testTask.IdealContainers = 1
+	testTask.Requested = 3
+	testTask.Running = 3
+	testTask.Healthy = 2
+	if testTask.HealthyRequested() != 2 {
+		t.Fatalf("Expected 2 healthy containers requested")
+	}
+
+	if testTask.ScaleDownCount() != 0 {
+		t.Fatalf("Unexpected scale down count with an unhealthy container")
+	}
+
+	// But we still don't exceed the maximum
+	testTask.Requested = 5
+	testTask.Running = 5
+	testTask.Healthy = 0
+	if testTask.ScaleUpCount() != 0 {
+		t.Fatalf("Unexpected scale up count at the maximum")
+	}
+}
+
 func TestCanScaleDown(t *testing.T) {
 	testTask := &Task{
 		IsScalable:    false,
@@ -149,3 +188,58 @@ func TestCanScaleDown(t *testing.T) {
 		t.Fatalf("Can't scale down if requested is already at minimum")
 	}
 }
+
+type limitedMetric struct {
+	metric.ToyMetric
+	limit int
+}
+
+func (m *limitedMetric) MaxContainers() int {
+	return m.limit
+}
+
+func TestMaxUsefulContainers(t *testing.T) {
+	_, testTask := getTestTask()
+	if testTask.MaxUsefulContainers() != 5 {
+		t.Fatalf("Expected max containers without a limit")
+	}
+
+	m := &limitedMetric{limit: 3}
+	m.SettableCurrent = 100
+	testTask.Metric = m
+	if testTask.MaxUsefulContainers() != 3 {
+		t.Fatalf("Expected the metric's limit")
+	}
+
+	// Never scale beyond the limit
+	testTask.IdealContainers = 10
+	testTask.Requested = 2
+	if testTask.ScaleUpCount() != 1 {
+		t.Fatalf("Unexpected scale up count with limit")
+	}
+
+	// Scale down if we're over the limit
+	testTask.Requested = 5
+	m.SettableCurrent = 0
+	if testTask.ScaleDownCount() != -2 {
+		t.Fatalf("Unexpected scale down count with limit")
+	}
+
+	// The limit doesn't apply if it's zero, or if it's above max containers
+	m.limit = 0
+	if testTask.MaxUsefulContainers() != 5 {
+		t.Fatalf("Expected max containers with no limit")
+	}
+
+	m.limit = 8
+	if testTask.MaxUsefulContainers() != 5 {
+		t.Fatalf("Expected max containers with a high limit")
+	}
+
+	// We always allow min containers
+	m.limit = 1
+	testTask.MinContainers = 2
+	if testTask.MaxUsefulContainers() != 2 {
+		t.Fatalf("Expected min containers")
+	}
+}
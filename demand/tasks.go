@@ -3,16 +3,21 @@ package demand
 import (
 	"fmt"
 	"sort"
+	"time"
 )
 
-// Exited returns whether tasks have all drained down to 0 so we can quit microscaling
+// Exited returns whether tasks have all reached the demand set by their shutdown policy so we can quit microscaling
 func (tasks *Tasks) Exited() (done bool) {
 	tasks.RLock()
 	defer tasks.RUnlock()
 
 	done = true
 	for _, task := range tasks.Tasks {
-		if task.Running > 0 {
+		if _, scale := task.ShutdownDemand(); !scale {
+			continue
+		}
+
+		if task.Running != task.Demand {
 			done = false
 			log.Debugf("Waiting for %s, still %d running, %d requested", task.Name, task.Running, task.Requested)
 		}
@@ -21,16 +26,23 @@ func (tasks *Tasks) Exited() (done bool) {
 	return done
 }
 
-// CheckCapacity returns number of containers we have space for
-func (tasks *Tasks) CheckCapacity() int {
-	// TODO!! For now we are simply going to say there is a maximum total number of containers this deployment can handle
-	// TODO!! It should really look at the available CPU / mem / bw in / out
-	totalRequested := 0
+// CheckCapacity returns the space we have left for more containers. There is a maximum total number of containers
+// this deployment can handle, and if we know the CPU and memory available we also take into account what each
+// container requests.
+// TODO!! It could also look at bandwidth in / out
+func (tasks *Tasks) CheckCapacity() Capacity {
+	c := Capacity{
+		Containers:  tasks.MaxContainers,
+		Resources:   tasks.Capacity,
+		limitCPU:    tasks.Capacity.CPU > 0,
+		limitMemory: tasks.Capacity.Memory > 0,
+	}
+
 	for _, t := range tasks.Tasks {
-		totalRequested += t.Requested
+		c.Take(t, t.Requested)
 	}
 
-	return tasks.MaxContainers - totalRequested
+	return c
 }
 
 // implements sort.Interface tasks based on priority
@@ -59,3 +71,125 @@ func (tasks *Tasks) GetTask(name string) (task *Task, err error) {
 
 	return nil, fmt.Errorf("No Task with name %s", name)
 }
+
+// Update applies a new set of task config. Tasks we already know about keep their scheduler state (and any state
+// held by their target) but take on the new settings. New tasks are added, and tasks that are no longer configured
+// are retired by applying their shutdown policy. Any new tasks should already be initialized with the scheduler.
+func (tasks *Tasks) Update(newTasks []*Task, maxContainers int) (added []*Task, retired []*Task) {
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	configured := make(map[string]bool, len(newTasks))
+	for _, nt := range newTasks {
+		configured[nt.Name] = true
+
+		t, err := tasks.GetTask(nt.Name)
+		if err != nil {
+			tasks.Tasks = append(tasks.Tasks, nt)
+			added = append(added, nt)
+			continue
+		}
+
+		t.updateConfig(nt)
+	}
+
+	remaining := tasks.Tasks[:0]
+	for _, t := range tasks.Tasks {
+		if configured[t.Name] || t.Retiring {
+			remaining = append(remaining, t)
+			continue
+		}
+
+		retired = append(retired, t)
+
+		// If we're leaving the containers alone we can stop managing this task straight away
+		demand, scale := t.ShutdownDemand()
+		if scale {
+			t.Retiring = true
+			t.IsScalable = false
+			t.Demand = demand
+			remaining = append(remaining, t)
+		}
+	}
+
+	tasks.Tasks = remaining
+
+	tasks.MaxContainers = maxContainers
+	return added, retired
+}
+
+// NewTasks returns those tasks that we don't already know about
+func (tasks *Tasks) NewTasks(newTasks []*Task) (added []*Task) {
+	tasks.RLock()
+	defer tasks.RUnlock()
+
+	for _, nt := range newTasks {
+		if _, err := tasks.GetTask(nt.Name); err != nil {
+			added = append(added, nt)
+		}
+	}
+
+	return added
+}
+
+// RemoveRetired removes any retiring tasks that have finished scaling to their shutdown demand
+func (tasks *Tasks) RemoveRetired() (removed []*Task) {
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	remaining := tasks.Tasks[:0]
+	for _, t := range tasks.Tasks {
+		if t.Retiring && t.Running == t.Demand && t.Requested == t.Demand {
+			removed = append(removed, t)
+		} else {
+			remaining = append(remaining, t)
+		}
+	}
+
+	tasks.Tasks = remaining
+	return removed
+}
+
+// RequestedCounts returns the number of containers currently requested for each task
+func (tasks *Tasks) RequestedCounts() map[string]int {
+	tasks.RLock()
+	defer tasks.RUnlock()
+
+	requested := make(map[string]int, len(tasks.Tasks))
+	for _, t := range tasks.Tasks {
+		requested[t.Name] = t.Requested
+	}
+
+	return requested
+}
+
+// RecordScaling counts the scale up and down actions the scheduler has made, by comparing the requested counts
+// with those from before scaling
+func (tasks *Tasks) RecordScaling(before map[string]int) {
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	now := time.Now()
+	for _, t := range tasks.Tasks {
+		requested, ok := before[t.Name]
+		if !ok {
+			continue
+		}
+
+		if t.Requested > requested {
+			t.ScaleUps++
+			t.LastScaled = now
+		} else if t.Requested < requested {
+			t.ScaleDowns++
+			t.LastScaled = now
+		}
+	}
+}
+
+// RecordSchedulerError counts errors from the scheduler
+func (tasks *Tasks) RecordSchedulerError() {
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	tasks.SchedulerErrors++
+}
@@ -2,6 +2,8 @@ package demand
 
 import (
 	"testing"
+
+	"github.com/microscaling/microscaling/target"
 )
 
 func getTestTasks() Tasks {
@@ -39,7 +41,7 @@ func TestCheckCapacity(t *testing.T) {
 	tt := getTestTasks()
 
 	// Max of 10, currently 6 requested
-	if tt.CheckCapacity() != 4 {
+	if tt.CheckCapacity().Containers != 4 {
 		t.Fatalf("Bad capcity check")
 	}
 }
@@ -93,3 +95,105 @@ func TestExited(t *testing.T) {
 		t.Fatal("Unexpectedly not exited")
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	tt := getTestTasks()
+
+	q := target.NewQueueLengthTarget(10)
+	tt.Tasks[0].Target = q
+
+	newTasks := []*Task{
+		&Task{Name: "Zero", Priority: 3, MaxContainers: 8, Target: target.NewQueueLengthTarget(20)},
+		&Task{Name: "One", Priority: 1, MaxContainers: 4, Target: target.NewRemainderTarget(4)},
+		&Task{Name: "Three", Priority: 2, MaxContainers: 6, Target: target.NewRemainderTarget(6)},
+	}
+
+	added := tt.NewTasks(newTasks)
+	if len(added) != 1 || added[0].Name != "Three" {
+		t.Fatalf("Expected Three to be new, got %v", added)
+	}
+
+	added, retired := tt.Update(newTasks, 20)
+	if len(added) != 1 || added[0].Name != "Three" {
+		t.Fatalf("Expected Three to be added, got %v", added)
+	}
+
+	if len(retired) != 1 || retired[0].Name != "Two" {
+		t.Fatalf("Expected Two to be retired, got %v", retired)
+	}
+
+	if tt.MaxContainers != 20 {
+		t.Fatalf("Max containers not updated")
+	}
+
+	zero, _ := tt.GetTask("Zero")
+	if zero.Priority != 3 || zero.MaxContainers != 8 {
+		t.Fatalf("Config not updated: %v", zero)
+	}
+
+	if zero.Requested != 2 || zero.Running != 2 {
+		t.Fatalf("Scheduler state not preserved: %v", zero)
+	}
+
+	if zero.Target != q {
+		t.Fatalf("Expected the queue target to be updated in place")
+	}
+
+	two, _ := tt.GetTask("Two")
+	if !two.Retiring || two.IsScalable || two.Demand != 0 {
+		t.Fatalf("Two should be retiring: %v", two)
+	}
+
+	// Still running so shouldn't be removed yet
+	if removed := tt.RemoveRetired(); len(removed) != 0 {
+		t.Fatalf("Unexpectedly removed %v", removed)
+	}
+
+	two.Requested = 0
+	two.Running = 0
+	if removed := tt.RemoveRetired(); len(removed) != 1 {
+		t.Fatalf("Expected Two to be removed")
+	}
+
+	if len(tt.Tasks) != 3 {
+		t.Fatalf("Expected 3 tasks, have %d", len(tt.Tasks))
+	}
+
+	if _, err := tt.GetTask("Two"); err == nil {
+		t.Fatalf("Two should have gone")
+	}
+}
+
+func TestRecordScaling(t *testing.T) {
+	tt := getTestTasks()
+
+	before := tt.RequestedCounts()
+	if before["One"] != 2 {
+		t.Fatalf("Unexpected requested count %d", before["One"])
+	}
+
+	tt.Tasks[0].Requested = 4
+	tt.Tasks[1].Requested = 1
+	tt.RecordScaling(before)
+
+	if tt.Tasks[0].ScaleUps != 1 || tt.Tasks[0].ScaleDowns != 0 {
+		t.Errorf("Expected one scale up for Zero")
+	}
+
+	if tt.Tasks[1].ScaleUps != 0 || tt.Tasks[1].ScaleDowns != 1 {
+		t.Errorf("Expected one scale down for One")
+	}
+
+	if tt.Tasks[2].ScaleUps != 0 || tt.Tasks[2].ScaleDowns != 0 {
+		t.Errorf("Expected no scaling for Two")
+	}
+
+	if tt.Tasks[0].LastScaled.IsZero() || tt.Tasks[1].LastScaled.IsZero() || !tt.Tasks[2].LastScaled.IsZero() {
+		t.Errorf("Expected scaling times for Zero and One only")
+	}
+
+	tt.RecordSchedulerError()
+	if tt.SchedulerErrors != 1 {
+		t.Errorf("Expected one scheduler error")
+	}
+}
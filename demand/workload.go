@@ -0,0 +1,20 @@
+package demand
+
+// Workload identifies the Kubernetes object that a task scales. Any kind with a /scale subresource will do.
+type Workload struct {
+	// Deployment (the default), StatefulSet, ReplicaSet, ReplicationController, or a custom resource kind
+	Kind string
+	// The API group and version, e.g. apps/v1. This is needed for custom resources.
+	APIVersion string
+	// The plural resource name used in API paths. For custom resources this defaults to the lower case kind plus s.
+	Resource string
+	// Where to find the object, if it isn't the task name in the scheduler's namespace
+	Namespace string
+	Name      string
+}
+
+// PolicyRef identifies the Kubernetes MicroscalingPolicy that a task was created from
+type PolicyRef struct {
+	Namespace string
+	Name      string
+}
@@ -14,6 +14,7 @@ const constGetDemandSleep = 500
 
 // LocalEngine calculates demand locally
 type LocalEngine struct {
+	maxMetricAge time.Duration
 }
 
 // compile-time assert that we implement the right interface
@@ -21,9 +22,12 @@ var _ engine.Engine = (*LocalEngine)(nil)
 
 var log = logging.MustGetLogger("mssengine")
 
-// NewEngine initializes the local engine
-func NewEngine() *LocalEngine {
-	de := LocalEngine{}
+// NewEngine initializes the local engine. We stop scaling a task on its metric if the metric fails, or its
+// latest sample is older than maxMetricAge.
+func NewEngine(maxMetricAge time.Duration) *LocalEngine {
+	de := LocalEngine{
+		maxMetricAge: maxMetricAge,
+	}
 	return &de
 }
 
@@ -42,7 +46,8 @@ func (de *LocalEngine) GetDemand(tasks *demand.Tasks, demandUpdate chan struct{}
 			go func(task *demand.Task) {
 				defer gettingMetrics.Done()
 				log.Debugf("Getting metric for %s", task.Name)
-				task.Metric.UpdateCurrent()
+				sampled, err := task.Metric.UpdateCurrent()
+				updateMetricStatus(task, sampled, err, de.maxMetricAge, time.Now())
 			}(task)
 		}
 
@@ -57,6 +62,25 @@ func (de *LocalEngine) GetDemand(tasks *demand.Tasks, demandUpdate chan struct{}
 	}
 }
 
+// updateMetricStatus records whether we can rely on the task's metric for scaling
+func updateMetricStatus(task *demand.Task, sampled time.Time, err error, maxAge time.Duration, now time.Time) {
+	if err == nil {
+		task.MetricSampled = sampled
+		task.MetricError = ""
+	} else {
+		task.MetricError = err.Error()
+	}
+
+	failing := err != nil || task.MetricSampled.IsZero() || now.Sub(task.MetricSampled) > maxAge
+	if failing && !task.MetricFailing {
+		log.Errorf("Not scaling %s on its metric, last sampled %v: %v", task.Name, task.MetricSampled, err)
+	} else if !failing && task.MetricFailing {
+		log.Infof("Metric for %s has recovered", task.Name)
+	}
+
+	task.MetricFailing = failing
+}
+
 // StopDemand is called when we want to shut down
 func (de *LocalEngine) StopDemand(demandUpdate chan struct{}) {
 	close(demandUpdate)
@@ -0,0 +1,49 @@
+package localEngine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+func TestUpdateMetricStatus(t *testing.T) {
+	now := time.Now()
+	maxAge := 30 * time.Second
+	task := &demand.Task{Name: "test"}
+
+	// A good sample
+	updateMetricStatus(task, now.Add(-time.Second), nil, maxAge, now)
+	if task.MetricFailing {
+		t.Errorf("Expected metric to be OK")
+	}
+
+	// Errors mean the metric is failing, but we remember when we last had a good sample
+	updateMetricStatus(task, time.Time{}, errors.New("broken"), maxAge, now)
+	if !task.MetricFailing || !task.MetricSampled.Equal(now.Add(-time.Second)) {
+		t.Errorf("Expected metric to be failing with the previous sample time")
+	}
+
+	if task.MetricError != "broken" {
+		t.Errorf("Expected the metric error, got %q", task.MetricError)
+	}
+
+	updateMetricStatus(task, now, nil, maxAge, now)
+	if task.MetricFailing || task.MetricError != "" {
+		t.Errorf("Expected metric to recover")
+	}
+
+	// Old samples are stale
+	updateMetricStatus(task, now.Add(-time.Minute), nil, maxAge, now)
+	if !task.MetricFailing {
+		t.Errorf("Expected a stale metric to be failing")
+	}
+
+	// We need at least one sample
+	task = &demand.Task{Name: "new"}
+	updateMetricStatus(task, time.Time{}, errors.New("broken"), maxAge, now)
+	if !task.MetricFailing {
+		t.Errorf("Expected metric with no samples to be failing")
+	}
+}
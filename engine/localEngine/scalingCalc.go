@@ -8,19 +8,54 @@ func scalingCalculation(tasks *demand.Tasks) (demandChanged bool) {
 	delta := 0
 	demandChanged = false
 
-	// Work out the ideal scale for all the services
+	// Work out the ideal scale for all the services. Unhealthy containers aren't doing any work, so the ideal is the
+	// number of healthy containers we need.
 	for _, t := range tasks.Tasks {
-		t.IdealContainers = t.Running + t.Target.Delta(t.Metric.Current())
-		log.Debugf("  [scale] ideal for %s priority %d would be %d. %d running, %d requested", t.Name, t.Priority, t.IdealContainers, t.Running, t.Requested)
+		healthy := t.Running - t.Unhealthy()
+		if t.MetricFailing {
+			t.IdealContainers = healthy
+			continue
+		}
+
+		t.IdealContainers = healthy + t.Target.Delta(t.Metric.Current())
+		log.Debugf("  [scale] ideal for %s priority %d would be %d. %d running, %d healthy, %d requested", t.Name, t.Priority, t.IdealContainers, t.Running, healthy, t.Requested)
 	}
 
 	available := tasks.CheckCapacity()
-	log.Debugf("  [scale] available space: %d", available)
+	log.Debugf("  [scale] available space: %v", available)
+
+	// Tasks whose metric is failing are frozen, unless they have a fail-safe number of containers to scale to
+	tasks.PrioritySort(false)
+	for _, t := range tasks.Tasks {
+		if !t.MetricFailing || !t.FailSafe || !t.IsScalable || t.Running != t.Requested {
+			continue
+		}
+
+		delta = t.FailSafeDemand() - t.HealthyRequested()
+		if max := t.MaxUsefulContainers(); t.Requested+delta > max {
+			delta = max - t.Requested
+		}
+
+		if fits := available.Fits(t); delta > fits {
+			// Only scale up as far as there's space for
+			delta = fits
+			if delta < 0 {
+				delta = 0
+			}
+		}
+
+		if delta != 0 {
+			t.Demand = t.Running + delta
+			demandChanged = true
+			available.Take(t, delta)
+			log.Infof("  [scale] metric for %s is failing, scaling by %d to fail-safe", t.Name, delta)
+		}
+	}
 
 	// Look for services we could scale down, in reverse priority order
 	tasks.PrioritySort(true)
 	for _, t := range tasks.Tasks {
-		if !t.IsScalable || t.Requested == t.MinContainers {
+		if !t.IsScalable || t.Requested == t.MinContainers || t.MetricFailing {
 			// Can't scale this service down
 			continue
 		}
@@ -36,7 +71,7 @@ func scalingCalculation(tasks *demand.Tasks) (demandChanged bool) {
 		if delta < 0 {
 			t.Demand = t.Running + delta
 			demandChanged = true
-			available += (-delta)
+			available.Take(t, delta)
 			log.Debugf("  [scale] scaling %s down by %d", t.Name, delta)
 		}
 	}
@@ -44,7 +79,7 @@ func scalingCalculation(tasks *demand.Tasks) (demandChanged bool) {
 	// Now look for tasks we need to scale up
 	tasks.PrioritySort(false)
 	for p, t := range tasks.Tasks {
-		if !t.IsScalable {
+		if !t.IsScalable || t.MetricFailing {
 			continue
 		}
 
@@ -59,46 +94,57 @@ func scalingCalculation(tasks *demand.Tasks) (demandChanged bool) {
 			continue
 		}
 
-		log.Debugf("  [scale]  would like to scale up %s by %d - available %d", t.Name, delta, available)
+		fits := available.Fits(t)
+		log.Debugf("  [scale]  would like to scale up %s by %d - space for %d", t.Name, delta, fits)
 
-		if available < delta {
+		if fits < delta {
 			// If this is a task that fills the remainder, there's no need to exceed capacity
 			if !t.IsRemainder() {
-				log.Debugf("  [scale] looking for %d additional capacity by scaling down:", delta-available)
+				log.Debugf("  [scale] looking for space for %d more by scaling down:", delta-fits)
 				index := len(tasks.Tasks)
 				freedCapacity := available
-				for index > p+1 && freedCapacity < delta {
+				for index > p+1 && freedCapacity.Fits(t) < delta {
 					// Kill off lower priority services if we need to
 					index--
 					lowerPriorityService := tasks.Tasks[index]
-					if lowerPriorityService.Priority > t.Priority {
+					if lowerPriorityService.Priority > t.Priority && !lowerPriorityService.MetricFailing {
 						log.Debugf("  [scale] looking for capacity from %s: running %d requested %d demand %d", lowerPriorityService.Name, lowerPriorityService.Running, lowerPriorityService.Requested, lowerPriorityService.Demand)
-						scaleDownBy := lowerPriorityService.CanScaleDown()
-						if scaleDownBy > 0 {
-							if scaleDownBy > (delta - freedCapacity) {
-								scaleDownBy = delta - freedCapacity
-							}
+						canScaleDown := lowerPriorityService.CanScaleDown()
+
+						// There's no point scaling down a service that doesn't free up the resources we're short of
+						trial := freedCapacity
+						trial.Take(lowerPriorityService, -canScaleDown)
+						if trial.Fits(t) <= freedCapacity.Fits(t) {
+							continue
+						}
 
+						// Only scale down by as many as we need to make space, which depends on the resources they use
+						scaleDownBy := 0
+						for scaleDownBy < canScaleDown && freedCapacity.Fits(t) < delta {
+							freedCapacity.Take(lowerPriorityService, -1)
+							scaleDownBy++
+						}
+
+						if scaleDownBy > 0 {
 							lowerPriorityService.Demand = lowerPriorityService.Running - scaleDownBy
 							demandChanged = true
 							log.Debugf("  [scale] Service %s priority %d scaling down %d", lowerPriorityService.Name, lowerPriorityService.Priority, -scaleDownBy)
-							freedCapacity = freedCapacity + scaleDownBy
 						}
 					}
 				}
 			}
 
 			// We might still not have enough capacity and we haven't waited for scale down to complete, so just scale up what's available now
-			delta = available
+			delta = fits
 			log.Debugf("  [scale] Can only scale %s by %d", t.Name, delta)
 		}
 
 		if delta > 0 {
 			demandChanged = true
-			available -= delta
-			if t.Demand >= t.MaxContainers {
-				log.Errorf("  [scale ] Limiting %s to its configured max %d", t.Name, t.MaxContainers)
-				t.Demand = t.MaxContainers
+			available.Take(t, delta)
+			if max := t.MaxUsefulContainers(); t.Demand >= max {
+				log.Errorf("  [scale ] Limiting %s to its max %d", t.Name, max)
+				t.Demand = max
 			} else {
 				log.Debugf("  [scale] Service %s scaling up %d", t.Name, delta)
 				t.Demand = t.Running + delta
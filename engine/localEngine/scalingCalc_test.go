@@ -0,0 +1,219 @@
+package localEngine
+
+import (
+	"testing"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/metric"
+	"github.com/microscaling/microscaling/target"
+)
+
+func TestScalingCalculationResources(t *testing.T) {
+	m := metric.NewToyMetric()
+	m.SettableCurrent = 100
+
+	tasks := &demand.Tasks{
+		MaxContainers: 10,
+		Capacity:      demand.Resources{CPU: 2, Memory: 4096},
+	}
+
+	high := &demand.Task{
+		Name:          "high",
+		Priority:      1,
+		IsScalable:    true,
+		MinContainers: 1,
+		MaxContainers: 5,
+		MaxDelta:      2,
+		Resources:     demand.Resources{CPU: 1, Memory: 512},
+		Target:        target.NewSimpleQueueLengthTarget(10),
+		Metric:        m,
+	}
+
+	low := &demand.Task{
+		Name:          "low",
+		Priority:      2,
+		IsScalable:    true,
+		MaxContainers: 5,
+		MaxDelta:      5,
+		Resources:     demand.Resources{CPU: 0.5, Memory: 128},
+		Target:        target.NewRemainderTarget(5),
+		Metric:        metric.NewNullMetric(),
+	}
+
+	// This task doesn't use any CPU, so scaling it down won't help
+	tiny := &demand.Task{
+		Name:          "tiny",
+		Priority:      3,
+		IsScalable:    true,
+		MaxContainers: 2,
+		MaxDelta:      2,
+		Target:        target.NewRemainderTarget(2),
+		Metric:        metric.NewNullMetric(),
+	}
+
+	tasks.Tasks = []*demand.Task{high, low, tiny}
+	for _, task := range tasks.Tasks {
+		task.Running = 2
+		task.Healthy = 2
+		task.Requested = 2
+		task.Demand = 2
+	}
+	high.Running = 1
+	high.Requested = 1
+	high.Demand = 1
+
+	// We're using all the CPU, so to scale up the high priority task we need to free up a whole CPU from the low priority one
+	if !scalingCalculation(tasks) {
+		t.Fatalf("Expected demand to change")
+	}
+
+	if low.Demand != 0 {
+		t.Errorf("Expected low to scale down to 0, demand is %d", low.Demand)
+	}
+
+	if tiny.Demand != 2 {
+		t.Errorf("Expected tiny to be left alone, demand is %d", tiny.Demand)
+	}
+
+	// We don't scale up until the scale down has happened
+	if high.Demand != 1 {
+		t.Errorf("Expected high to wait for capacity, demand is %d", high.Demand)
+	}
+
+	low.Running = 0
+	low.Requested = 0
+	scalingCalculation(tasks)
+
+	if high.Demand != 2 {
+		t.Errorf("Expected high to scale up by one, demand is %d", high.Demand)
+	}
+}
+
+func TestScalingCalculationMetricFailing(t *testing.T) {
+	m := metric.NewToyMetric()
+	m.SettableCurrent = 100
+
+	tasks := &demand.Tasks{
+		MaxContainers: 10,
+	}
+
+	frozen := &demand.Task{
+		Name:          "frozen",
+		Priority:      1,
+		IsScalable:    true,
+		MinContainers: 1,
+		MaxContainers: 8,
+		MaxDelta:      2,
+		Target:        target.NewSimpleQueueLengthTarget(10),
+		Metric:        m,
+		MetricFailing: true,
+	}
+
+	failSafe := &demand.Task{
+		Name:               "failsafe",
+		Priority:           2,
+		IsScalable:         true,
+		MinContainers:      1,
+		MaxContainers:      8,
+		MaxDelta:           2,
+		Target:             target.NewSimpleQueueLengthTarget(10),
+		Metric:             m,
+		MetricFailing:      true,
+		FailSafe:           true,
+		FailSafeContainers: 5,
+	}
+
+	// This would like to scale up into the whole space, but has lower priority than the fail-safe task
+	remainder := &demand.Task{
+		Name:          "remainder",
+		Priority:      3,
+		IsScalable:    true,
+		MaxContainers: 10,
+		MaxDelta:      10,
+		Target:        target.NewRemainderTarget(10),
+		Metric:        metric.NewNullMetric(),
+	}
+
+	tasks.Tasks = []*demand.Task{frozen, failSafe, remainder}
+	for _, task := range tasks.Tasks {
+		task.Running = 2
+		task.Healthy = 2
+		task.Requested = 2
+		task.Demand = 2
+	}
+
+	if !scalingCalculation(tasks) {
+		t.Fatalf("Expected demand to change")
+	}
+
+	if frozen.Demand != 2 {
+		t.Errorf("Expected frozen task not to scale, demand %d", frozen.Demand)
+	}
+
+	if failSafe.Demand != 5 {
+		t.Errorf("Expected fail-safe task to scale to 5, demand %d", failSafe.Demand)
+	}
+
+	if remainder.Demand != 3 {
+		t.Errorf("Expected remainder to fill the space left, demand %d", remainder.Demand)
+	}
+
+	// Once the metric recovers the task scales on its metric again
+	for _, task := range tasks.Tasks {
+		task.Running = task.Demand
+		task.Requested = task.Demand
+	}
+	frozen.MetricFailing = false
+	failSafe.MetricFailing = false
+	m.SettableCurrent = 0
+
+	scalingCalculation(tasks)
+	if frozen.Demand != 1 || failSafe.Demand != 4 {
+		t.Errorf("Expected tasks to scale down on their metrics, demand %d and %d", frozen.Demand, failSafe.Demand)
+	}
+}
+
+func TestScalingCalculationUnhealthy(t *testing.T) {
+	tasks := &demand.Tasks{
+		MaxContainers: 10,
+	}
+
+	failSafe := &demand.Task{
+		Name:               "failsafe",
+		IsScalable:         true,
+		MinContainers:      1,
+		MaxContainers:      5,
+		MaxDelta:           2,
+		Target:             target.NewSimpleQueueLengthTarget(10),
+		Metric:             metric.NewToyMetric(),
+		MetricFailing:      true,
+		FailSafe:           true,
+		FailSafeContainers: 4,
+		Running:            4,
+		Healthy:            3,
+		Requested:          4,
+		Demand:             4,
+	}
+	tasks.Tasks = []*demand.Task{failSafe}
+
+	// Unhealthy containers don't count towards the ideal, so we start another to make up the fail-safe number
+	if !scalingCalculation(tasks) {
+		t.Fatalf("Expected demand to change")
+	}
+
+	if failSafe.IdealContainers != 3 {
+		t.Errorf("Expected ideal to be the 3 healthy containers, got %d", failSafe.IdealContainers)
+	}
+
+	if failSafe.Demand != 5 {
+		t.Errorf("Expected to scale up to 5, demand is %d", failSafe.Demand)
+	}
+
+	// But not beyond the maximum
+	failSafe.Running = 5
+	failSafe.Requested = 5
+	failSafe.Demand = 5
+	if scalingCalculation(tasks) {
+		t.Errorf("Expected to stay at the maximum, demand is %d", failSafe.Demand)
+	}
+}
@@ -38,7 +38,8 @@ func updateTasks(dp api.DemandPayload, tasks *demand.Tasks) (demandChanged bool)
 	for _, taskFromServer := range dp.Demand.Tasks {
 		name := taskFromServer.App
 
-		if existingTask, err := tasks.GetTask(name); err == nil {
+		// Tasks that are being retired stay scaled down whatever the server says
+		if existingTask, err := tasks.GetTask(name); err == nil && !existingTask.Retiring {
 			if existingTask.Demand != taskFromServer.DemandCount {
 				demandChanged = true
 			}
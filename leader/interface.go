@@ -0,0 +1,18 @@
+// Package leader lets us run more than one microscaling agent, with only the leader scaling tasks
+package leader
+
+import (
+	"github.com/op/go-logging"
+)
+
+// Elector decides which of several agents is the leader
+type Elector interface {
+	// Run campaigns to be the leader until Stop is called. It calls startedLeading when we become the leader, and
+	// stoppedLeading if we can't renew our lease in time, after which it returns.
+	Run(startedLeading func(), stoppedLeading func())
+	IsLeader() bool
+	// Stop ends the campaign. If we're the leader we release the lock, so another agent can take over straight away.
+	Stop()
+}
+
+var log = logging.MustGetLogger("mssleader")
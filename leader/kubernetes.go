@@ -0,0 +1,242 @@
+package leader
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/errors"
+
+	"github.com/microscaling/microscaling/utils"
+)
+
+// Kinds of object we can use as the lock
+const (
+	ConfigMapLock = "CONFIGMAP"
+	LeaseLock     = "LEASE"
+)
+
+// KubeElector elects a leader using a lock object in Kubernetes. The leader renews its lease regularly, and if it
+// stops doing so another agent takes over once the lease has expired.
+type KubeElector struct {
+	identity      string
+	lock          resourceLock
+	leaseDuration time.Duration
+	// The leader gives up if it hasn't managed to renew its lease for this long
+	renewDeadline time.Duration
+	// How often we try to acquire or renew the lease
+	retryPeriod time.Duration
+
+	// We time other agents' leases by our own clock, from when we first saw their latest record, so we don't
+	// depend on the clocks being in sync
+	observed     leaderRecord
+	observedTime time.Time
+
+	leading bool
+	renewed time.Time
+	running bool
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+	sync.Mutex
+}
+
+// compile-time assert that we implement the right interface
+var _ Elector = (*KubeElector)(nil)
+
+// NewKubeElector creates an elector that uses a ConfigMap or Lease with the given name as the lock. The identity
+// needs to be different for every agent.
+func NewKubeElector(kubeConfig string, namespace string, lockType string, lockName string, identity string, leaseDuration time.Duration) (*KubeElector, error) {
+	clientset, err := utils.NewKubeClientset(kubeConfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKubeElector(clientset, namespace, lockType, lockName, identity, leaseDuration)
+}
+
+func newKubeElector(clientset *kubernetes.Clientset, namespace string, lockType string, lockName string, identity string, leaseDuration time.Duration) (*KubeElector, error) {
+	if identity == "" {
+		return nil, fmt.Errorf("Leader election needs an identity for this agent")
+	}
+
+	e := &KubeElector{
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		renewDeadline: leaseDuration * 2 / 3,
+		retryPeriod:   leaseDuration / 7,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	switch lockType {
+	case ConfigMapLock:
+		e.lock = &configMapLock{clientset: clientset, namespace: namespace, name: lockName}
+	case LeaseLock:
+		e.lock = &leaseLock{clientset: clientset, namespace: namespace, name: lockName}
+	default:
+		return nil, fmt.Errorf("Unknown leader election lock type %s", lockType)
+	}
+
+	return e, nil
+}
+
+// Run tries to acquire the lock, and then keeps renewing it while we're the leader
+func (e *KubeElector) Run(startedLeading func(), stoppedLeading func()) {
+	e.Lock()
+	if e.stopped {
+		e.Unlock()
+		return
+	}
+	e.running = true
+	e.Unlock()
+	defer close(e.done)
+
+	log.Infof("Campaigning to be the leader as %s, using %s", e.identity, e.lock.describe())
+
+	for {
+		acquired := e.tryAcquireOrRenew()
+		now := time.Now()
+
+		e.Lock()
+		wasLeading := e.leading
+		if acquired {
+			e.leading = true
+			e.renewed = now
+		} else if wasLeading && now.Sub(e.renewed) > e.renewDeadline {
+			e.leading = false
+		}
+		leading := e.leading
+		e.Unlock()
+
+		if leading && !wasLeading {
+			log.Infof("Became the leader as %s", e.identity)
+			startedLeading()
+		} else if wasLeading && !leading {
+			log.Errorf("Failed to renew the lease on %s", e.lock.describe())
+			stoppedLeading()
+			return
+		}
+
+		select {
+		case <-e.stop:
+			e.release()
+			return
+		case <-time.After(e.retryPeriod):
+		}
+	}
+}
+
+// IsLeader tells us whether we currently hold the lock
+func (e *KubeElector) IsLeader() bool {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.leading
+}
+
+// Stop ends the campaign, and waits for the lock to be released if we hold it
+func (e *KubeElector) Stop() {
+	e.Lock()
+	if e.stopped {
+		e.Unlock()
+		return
+	}
+	e.stopped = true
+	close(e.stop)
+	running := e.running
+	e.Unlock()
+
+	if running {
+		<-e.done
+	}
+}
+
+// tryAcquireOrRenew returns true if we hold the lock. We can take it if it's free, or the holder hasn't renewed
+// their lease in time.
+func (e *KubeElector) tryAcquireOrRenew() bool {
+	now := time.Now()
+	record := leaderRecord{
+		HolderIdentity:       e.identity,
+		LeaseDurationSeconds: int(e.leaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	old, err := e.lock.get()
+	if errors.IsNotFound(err) {
+		err = e.lock.create(record)
+		if err != nil {
+			log.Errorf("Failed to create %s: %v", e.lock.describe(), err)
+			return false
+		}
+
+		e.observe(record, now)
+		return true
+	}
+
+	if err != nil {
+		log.Errorf("Failed to get %s: %v", e.lock.describe(), err)
+		return false
+	}
+
+	if !reflect.DeepEqual(old, e.observed) {
+		e.observe(old, now)
+	}
+
+	leaseDuration := time.Duration(old.LeaseDurationSeconds) * time.Second
+	if old.HolderIdentity != "" && old.HolderIdentity != e.identity && now.Before(e.observedTime.Add(leaseDuration)) {
+		log.Debugf("%s is the leader", old.HolderIdentity)
+		return false
+	}
+
+	if old.HolderIdentity == e.identity {
+		record.AcquireTime = old.AcquireTime
+		record.LeaderTransitions = old.LeaderTransitions
+	} else {
+		record.LeaderTransitions = old.LeaderTransitions + 1
+	}
+
+	// This fails with a conflict if another agent has updated the lock since we got it
+	err = e.lock.update(record)
+	if err != nil {
+		log.Errorf("Failed to update %s: %v", e.lock.describe(), err)
+		return false
+	}
+
+	e.observe(record, now)
+	return true
+}
+
+func (e *KubeElector) observe(record leaderRecord, now time.Time) {
+	e.observed = record
+	e.observedTime = now
+}
+
+// release gives up the lock with a short lease, so another agent can take it straight away
+func (e *KubeElector) release() {
+	e.Lock()
+	leading := e.leading
+	e.leading = false
+	e.Unlock()
+
+	if !leading {
+		return
+	}
+
+	now := time.Now()
+	err := e.lock.update(leaderRecord{
+		LeaseDurationSeconds: 1,
+		AcquireTime:          now,
+		RenewTime:            now,
+		LeaderTransitions:    e.observed.LeaderTransitions,
+	})
+	if err != nil {
+		log.Errorf("Failed to release %s: %v", e.lock.describe(), err)
+		return
+	}
+
+	log.Infof("Released %s", e.lock.describe())
+}
@@ -0,0 +1,215 @@
+package leader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/rest"
+)
+
+const testLeaseDuration = time.Second
+
+// testAPIServer stores objects by path, and rejects updates with an out of date resource version
+type testAPIServer struct {
+	objects         map[string]map[string]interface{}
+	resourceVersion int
+	failing         bool
+	sync.Mutex
+}
+
+func (s *testAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if s.failing {
+		writeStatus(w, http.StatusInternalServerError, "InternalError")
+		return
+	}
+
+	var obj map[string]interface{}
+	if r.Method == "POST" || r.Method == "PUT" {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &obj)
+	}
+
+	path := r.URL.Path
+	switch r.Method {
+	case "GET":
+		if existing, ok := s.objects[path]; ok {
+			json.NewEncoder(w).Encode(existing)
+		} else {
+			writeStatus(w, http.StatusNotFound, "NotFound")
+		}
+	case "POST":
+		path += "/" + metadata(obj)["name"].(string)
+		if _, ok := s.objects[path]; ok {
+			writeStatus(w, http.StatusConflict, "AlreadyExists")
+			return
+		}
+		s.store(w, path, obj)
+	case "PUT":
+		existing, ok := s.objects[path]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, "NotFound")
+			return
+		}
+		if metadata(obj)["resourceVersion"] != metadata(existing)["resourceVersion"] {
+			writeStatus(w, http.StatusConflict, "Conflict")
+			return
+		}
+		s.store(w, path, obj)
+	}
+}
+
+func (s *testAPIServer) store(w http.ResponseWriter, path string, obj map[string]interface{}) {
+	s.resourceVersion++
+	metadata(obj)["resourceVersion"] = strconv.Itoa(s.resourceVersion)
+	s.objects[path] = obj
+	json.NewEncoder(w).Encode(obj)
+}
+
+func metadata(obj map[string]interface{}) map[string]interface{} {
+	m, _ := obj["metadata"].(map[string]interface{})
+	return m
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason string) {
+	w.WriteHeader(code)
+	w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "` + reason + `", "code": ` + strconv.Itoa(code) + `}`))
+}
+
+// holder reads the leader record from the stored lock
+func (s *testAPIServer) holder(path string) (holder string, transitions int) {
+	s.Lock()
+	defer s.Unlock()
+
+	obj := s.objects[path]
+	if spec, ok := obj["spec"].(map[string]interface{}); ok {
+		holder, _ = spec["holderIdentity"].(string)
+		t, _ := spec["leaseTransitions"].(float64)
+		return holder, int(t)
+	}
+
+	var record leaderRecord
+	annotations, _ := metadata(obj)["annotations"].(map[string]interface{})
+	annotation, _ := annotations[constLeaderAnnotation].(string)
+	json.NewDecoder(strings.NewReader(annotation)).Decode(&record)
+	return record.HolderIdentity, record.LeaderTransitions
+}
+
+type testCampaign struct {
+	elector *KubeElector
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func startCampaign(t *testing.T, server *httptest.Server, lockType string, identity string) *testCampaign {
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	e, err := newKubeElector(clientset, "default", lockType, "microscaling", identity, testLeaseDuration)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	c := &testCampaign{
+		elector: e,
+		started: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.Run(func() { close(c.started) }, func() { close(c.stopped) })
+	return c
+}
+
+func waitFor(t *testing.T, ch chan struct{}, timeout time.Duration, what string) {
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		t.Fatalf("Timed out waiting for %s", what)
+	}
+}
+
+func TestKubeElector(t *testing.T) {
+	tests := []struct {
+		lockType string
+		path     string
+	}{
+		{lockType: ConfigMapLock, path: "/api/v1/namespaces/default/configmaps/microscaling"},
+		{lockType: LeaseLock, path: "/apis/coordination.k8s.io/v1/namespaces/default/leases/microscaling"},
+	}
+
+	for _, test := range tests {
+		api := &testAPIServer{objects: make(map[string]map[string]interface{})}
+		server := httptest.NewServer(api)
+
+		// The first agent creates the lock
+		a := startCampaign(t, server, test.lockType, "agent-a")
+		waitFor(t, a.started, time.Second, test.lockType+" agent-a to lead")
+		if !a.elector.IsLeader() {
+			t.Errorf("%s: expected agent-a to be the leader", test.lockType)
+		}
+
+		if holder, _ := api.holder(test.path); holder != "agent-a" {
+			t.Errorf("%s: expected agent-a to hold the lock, got %q", test.lockType, holder)
+		}
+
+		// Standbys wait while the leader keeps renewing its lease
+		b := startCampaign(t, server, test.lockType, "agent-b")
+		time.Sleep(testLeaseDuration + a.elector.retryPeriod)
+		if b.elector.IsLeader() {
+			t.Errorf("%s: agent-b shouldn't lead while agent-a is renewing", test.lockType)
+		}
+
+		// When the leader stops it releases the lock, and a standby takes over straight away
+		a.elector.Stop()
+		if a.elector.IsLeader() {
+			t.Errorf("%s: agent-a should have stopped leading", test.lockType)
+		}
+
+		waitFor(t, b.started, testLeaseDuration/2, test.lockType+" agent-b to take over")
+		if holder, transitions := api.holder(test.path); holder != "agent-b" || transitions != 1 {
+			t.Errorf("%s: expected agent-b to hold the lock after 1 transition, got %q after %d", test.lockType, holder, transitions)
+		}
+
+		// If the leader can't renew its lease it stops leading
+		api.Lock()
+		api.failing = true
+		api.Unlock()
+
+		waitFor(t, b.stopped, testLeaseDuration*2, test.lockType+" agent-b to stop leading")
+		if b.elector.IsLeader() {
+			t.Errorf("%s: agent-b should have stopped leading", test.lockType)
+		}
+
+		api.Lock()
+		api.failing = false
+		api.Unlock()
+
+		// If the leader disappears without releasing the lock, a standby takes over once the lease has expired
+		c := startCampaign(t, server, test.lockType, "agent-c")
+		time.Sleep(testLeaseDuration / 2)
+		if c.elector.IsLeader() {
+			t.Errorf("%s: agent-c shouldn't lead before agent-b's lease expires", test.lockType)
+		}
+
+		waitFor(t, c.started, testLeaseDuration*2, test.lockType+" agent-c to take over")
+		if holder, transitions := api.holder(test.path); holder != "agent-c" || transitions != 2 {
+			t.Errorf("%s: expected agent-c to hold the lock after 2 transitions, got %q after %d", test.lockType, holder, transitions)
+		}
+
+		b.elector.Stop()
+		c.elector.Stop()
+		server.Close()
+	}
+}
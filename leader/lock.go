@@ -0,0 +1,212 @@
+package leader
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const (
+	// The ConfigMap annotation holding the leader record, as used by Kubernetes' own controllers
+	constLeaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+	// Lease times are in microseconds
+	constMicroTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// leaderRecord is who holds the lock, and for how long
+type leaderRecord struct {
+	HolderIdentity       string    `json:"holderIdentity"`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	AcquireTime          time.Time `json:"acquireTime"`
+	RenewTime            time.Time `json:"renewTime"`
+	LeaderTransitions    int       `json:"leaderTransitions"`
+}
+
+// resourceLock keeps the leader record in a Kubernetes object. We keep the object we last got, so updates fail with a
+// conflict if someone else has changed it since.
+type resourceLock interface {
+	get() (leaderRecord, error)
+	create(record leaderRecord) error
+	update(record leaderRecord) error
+	describe() string
+}
+
+// configMapLock keeps the leader record in an annotation on a ConfigMap
+type configMapLock struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	name      string
+	configMap *v1.ConfigMap
+}
+
+func (l *configMapLock) get() (record leaderRecord, err error) {
+	cm, err := l.clientset.Core().ConfigMaps(l.namespace).Get(l.name)
+	if err != nil {
+		return
+	}
+	l.configMap = cm
+
+	if s, ok := cm.Annotations[constLeaderAnnotation]; ok {
+		err = json.Unmarshal([]byte(s), &record)
+	}
+
+	return
+}
+
+func (l *configMapLock) create(record leaderRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.configMap, err = l.clientset.Core().ConfigMaps(l.namespace).Create(&v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        l.name,
+			Namespace:   l.namespace,
+			Annotations: map[string]string{constLeaderAnnotation: string(b)},
+		},
+	})
+	return err
+}
+
+func (l *configMapLock) update(record leaderRecord) error {
+	if l.configMap == nil {
+		return fmt.Errorf("ConfigMap %s/%s hasn't been read yet", l.namespace, l.name)
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if l.configMap.Annotations == nil {
+		l.configMap.Annotations = make(map[string]string)
+	}
+	l.configMap.Annotations[constLeaderAnnotation] = string(b)
+
+	l.configMap, err = l.clientset.Core().ConfigMaps(l.namespace).Update(l.configMap)
+	return err
+}
+
+func (l *configMapLock) describe() string {
+	return "ConfigMap " + l.namespace + "/" + l.name
+}
+
+// leaseLock keeps the leader record in the spec of a coordination.k8s.io Lease. Our client library doesn't know
+// about Leases, so we use the REST API directly.
+type leaseLock struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	name      string
+	lease     map[string]interface{}
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+func (l *leaseLock) collection() string {
+	return "/apis/coordination.k8s.io/v1/namespaces/" + l.namespace + "/leases"
+}
+
+func (l *leaseLock) get() (record leaderRecord, err error) {
+	b, err := l.clientset.Core().GetRESTClient().Get().AbsPath(l.collection(), l.name).Do().Raw()
+	if err != nil {
+		return
+	}
+
+	err = l.store(b)
+	if err != nil {
+		return
+	}
+
+	var lease struct {
+		Spec leaseSpec `json:"spec"`
+	}
+	err = json.Unmarshal(b, &lease)
+	if err != nil {
+		return
+	}
+
+	// Times we can't parse are left as zero
+	record.HolderIdentity = lease.Spec.HolderIdentity
+	record.LeaseDurationSeconds = lease.Spec.LeaseDurationSeconds
+	record.AcquireTime, _ = time.Parse(constMicroTimeFormat, lease.Spec.AcquireTime)
+	record.RenewTime, _ = time.Parse(constMicroTimeFormat, lease.Spec.RenewTime)
+	record.LeaderTransitions = lease.Spec.LeaseTransitions
+	return
+}
+
+func (l *leaseLock) create(record leaderRecord) error {
+	b, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "coordination.k8s.io/v1",
+		"kind":       "Lease",
+		"metadata": map[string]string{
+			"name":      l.name,
+			"namespace": l.namespace,
+		},
+		"spec": specFromRecord(record),
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err = l.clientset.Core().GetRESTClient().Post().AbsPath(l.collection()).Body(b).Do().Raw()
+	if err != nil {
+		return err
+	}
+
+	return l.store(b)
+}
+
+func (l *leaseLock) update(record leaderRecord) error {
+	if l.lease == nil {
+		return fmt.Errorf("Lease %s/%s hasn't been read yet", l.namespace, l.name)
+	}
+
+	l.lease["spec"] = specFromRecord(record)
+	b, err := json.Marshal(l.lease)
+	if err != nil {
+		return err
+	}
+
+	b, err = l.clientset.Core().GetRESTClient().Put().AbsPath(l.collection(), l.name).Body(b).Do().Raw()
+	if err != nil {
+		return err
+	}
+
+	return l.store(b)
+}
+
+// store keeps the lease we got back from the API server, including its resource version, for the next update
+func (l *leaseLock) store(b []byte) error {
+	var lease map[string]interface{}
+	err := json.Unmarshal(b, &lease)
+	if err != nil {
+		return err
+	}
+
+	l.lease = lease
+	return nil
+}
+
+func (l *leaseLock) describe() string {
+	return "Lease " + l.namespace + "/" + l.name
+}
+
+func specFromRecord(record leaderRecord) leaseSpec {
+	return leaseSpec{
+		HolderIdentity:       record.HolderIdentity,
+		LeaseDurationSeconds: record.LeaseDurationSeconds,
+		AcquireTime:          record.AcquireTime.UTC().Format(constMicroTimeFormat),
+		RenewTime:            record.RenewTime.UTC().Format(constMicroTimeFormat),
+		LeaseTransitions:     record.LeaderTransitions,
+	}
+}
@@ -23,6 +23,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -31,6 +32,8 @@ import (
 	"github.com/op/go-logging"
 
 	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/leader"
+	"github.com/microscaling/microscaling/monitor"
 	"github.com/microscaling/microscaling/scheduler"
 	"github.com/microscaling/microscaling/utils"
 )
@@ -46,21 +49,137 @@ func init() {
 	initLogging()
 }
 
-// cleanup resets demand for all tasks to 0 before we quit
+// cleanup applies each task's shutdown policy before we quit
 func cleanup(s scheduler.Scheduler, tasks *demand.Tasks) {
+	scale := false
+
 	tasks.Lock()
 	for _, task := range tasks.Tasks {
-		task.Demand = 0
+		if demand, ok := task.ShutdownDemand(); ok {
+			task.Demand = demand
+			scale = true
+		}
 	}
 	tasks.Unlock()
 
-	log.Debugf("Reset tasks to 0 for cleanup")
+	if !scale {
+		log.Debugf("Leaving tasks as they are for cleanup")
+		return
+	}
+
+	log.Debugf("Reset tasks to their shutdown demand for cleanup")
 	err := s.StopStartTasks(tasks)
 	if err != nil {
 		log.Errorf("Failed to cleanup tasks. %v", err)
 	}
 }
 
+// isLeader is true if we're the leader, or we're not using leader election
+func isLeader(elector leader.Elector) bool {
+	return elector == nil || elector.IsLeader()
+}
+
+// takeOver picks up from the number of containers the previous leader left running
+func takeOver(tasks *demand.Tasks) {
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	for _, task := range tasks.Tasks {
+		task.Requested = task.Running
+	}
+}
+
+// reloadTasks gets the latest task config and applies it to the tasks we're already scaling
+func reloadTasks(st settings, s scheduler.Scheduler, tasks *demand.Tasks) (changed bool, err error) {
+	newTasks, err := getTasks(st)
+	if err != nil {
+		return false, err
+	}
+
+	// New tasks need to be known to the scheduler, and we need to know how many are already running,
+	// before the demand engine gets to see them
+	added := tasks.NewTasks(newTasks.Tasks)
+	for _, task := range added {
+		err = s.InitScheduler(task)
+		if err != nil {
+			return false, fmt.Errorf("Failed to start task %s: %v", task.Name, err)
+		}
+	}
+
+	if len(added) > 0 {
+		err = s.CountAllTasks(&demand.Tasks{Tasks: added})
+		if err != nil {
+			return false, fmt.Errorf("Failed to count containers for new tasks: %v", err)
+		}
+
+		for _, task := range added {
+			task.Requested = task.Running
+			task.InitialCount = task.Running
+		}
+	}
+
+	added, retired := tasks.Update(newTasks.Tasks, newTasks.MaxContainers)
+	for _, task := range added {
+		log.Infof("Added task %s", task.Name)
+	}
+
+	for _, task := range retired {
+		log.Infof("Retiring task %s", task.Name)
+	}
+
+	return len(retired) > 0, nil
+}
+
+// stopStartTasks asks the scheduler to scale the tasks, keeping count of scaling actions and errors
+func stopStartTasks(s scheduler.Scheduler, tasks *demand.Tasks) error {
+	before := tasks.RequestedCounts()
+
+	err := s.StopStartTasks(tasks)
+	if err != nil {
+		tasks.RecordSchedulerError()
+	}
+
+	tasks.RecordScaling(before)
+	return err
+}
+
+// updateCapacity finds out what resources we have available for running tasks
+func updateCapacity(st settings, s scheduler.Scheduler, tasks *demand.Tasks) error {
+	capacity, err := getCapacity(st, s)
+	if err != nil {
+		return err
+	}
+
+	tasks.Lock()
+	tasks.Capacity = capacity
+	tasks.Unlock()
+
+	log.Debugf("Capacity %v", capacity)
+	return nil
+}
+
+// handleReload reloads the task config and triggers a demand update if there are retired tasks to scale down
+func handleReload(st settings, s scheduler.Scheduler, tasks *demand.Tasks, demandUpdate chan struct{}) {
+	changed, err := reloadTasks(st, s, tasks)
+	if err != nil {
+		log.Errorf("Failed to reload config, carrying on with the current config. %v", err)
+	}
+
+	// The resources available may have changed too
+	err = updateCapacity(st, s, tasks)
+	if err != nil {
+		log.Errorf("Failed to update capacity. %v", err)
+	}
+
+	if changed {
+		select {
+		case demandUpdate <- struct{}{}:
+		default:
+			// There's already a demand update waiting to be handled
+		}
+	}
+}
+
 // For this simple prototype, Microscaling sits in a loop checking for demand changes every X milliseconds
 func main() {
 	var err error
@@ -77,6 +196,12 @@ func main() {
 		return
 	}
 
+	elector, err := getElector(st)
+	if err != nil {
+		log.Errorf("Failed to set up leader election: %v", err)
+		return
+	}
+
 	tasks, err = getTasks(st)
 	if err != nil {
 		log.Errorf("Failed to get tasks: %v", err)
@@ -92,6 +217,12 @@ func main() {
 		}
 	}
 
+	err = updateCapacity(st, s, tasks)
+	if err != nil {
+		log.Errorf("Failed to get capacity: %v", err)
+		return
+	}
+
 	// Check if there are already any of these containers running
 	err = s.CountAllTasks(tasks)
 	if err != nil {
@@ -101,6 +232,7 @@ func main() {
 	// Set the initial requested counts to match what's running
 	for name, task := range tasks.Tasks {
 		task.Requested = task.Running
+		task.InitialCount = task.Running
 		tasks.Tasks[name] = task
 	}
 
@@ -122,19 +254,38 @@ func main() {
 		return
 	}
 
-	go de.GetDemand(tasks, demandUpdate)
+	// With leader election only the leader calculates demand and scales tasks. Standbys keep counting tasks so
+	// they're ready to take over.
+	if elector == nil {
+		go de.GetDemand(tasks, demandUpdate)
+	} else {
+		go elector.Run(func() {
+			takeOver(tasks)
+			go de.GetDemand(tasks, demandUpdate)
+		}, func() {
+			// Another agent may already be scaling the tasks, so we mustn't carry on or clean up
+			log.Errorf("Lost leadership, exiting")
+			os.Exit(1)
+		})
+	}
 
 	// Handle demand updates
 	go func() {
 		for range demandUpdate {
-			err = s.StopStartTasks(tasks)
+			if !isLeader(elector) {
+				continue
+			}
+
+			err = stopStartTasks(s, tasks)
 			if err != nil {
 				log.Errorf("Failed to stop / start tasks. %v", err)
 			}
 		}
 
 		// When the demandUpdate channel is closed, it's time to scale everything down to 0
-		cleanup(s, tasks)
+		if isLeader(elector) {
+			cleanup(s, tasks)
+		}
 	}()
 
 	// Periodically read the current state of tasks
@@ -144,8 +295,14 @@ func main() {
 			// Find out how many instances of each task are running
 			err = s.CountAllTasks(tasks)
 			if err != nil {
+				tasks.RecordSchedulerError()
 				log.Errorf("Failed to count containers. %v", err)
 			}
+
+			// Tasks that were removed from the config can go once they have scaled down
+			for _, task := range tasks.RemoveRetired() {
+				log.Infof("Removed task %s", task.Name)
+			}
 		}
 	}()
 
@@ -155,7 +312,16 @@ func main() {
 		sendMetricsTimeout := time.NewTicker(constSendMetricsTimeout * time.Millisecond)
 		go func() {
 			for _ = range sendMetricsTimeout.C {
+				// Standbys only send metrics to monitors that can tell they aren't the leader
+				leading := isLeader(elector)
 				for _, m := range monitors {
+					lr, ok := m.(monitor.LeaderReporter)
+					if ok {
+						lr.SetLeader(leading)
+					} else if !leading {
+						continue
+					}
+
 					err = m.SendMetrics(tasks)
 					if err != nil {
 						log.Errorf("Failed to send metrics. %v", err)
@@ -165,20 +331,71 @@ func main() {
 		}()
 	}
 
+	// Reload task config as soon as it changes, if the config can tell us
+	configChanged := make(chan struct{}, 1)
+	watcher := getConfigWatcher(st)
+	if watcher != nil {
+		go watcher.Watch(configChanged)
+	}
+
+	// Reload task config when we receive a SIGHUP, and optionally at a regular interval
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	var reloadTimeout <-chan time.Time
+	if st.configReload > 0 {
+		reloadTimeout = time.NewTicker(time.Duration(st.configReload) * time.Second).C
+	}
+
 	// When we're asked to close down, we don't want to handle demand updates any more
-	<-closedown
+closing:
+	for {
+		select {
+		case <-reload:
+			log.Info("Reloading config")
+			handleReload(st, s, tasks, demandUpdate)
+		case <-reloadTimeout:
+			handleReload(st, s, tasks, demandUpdate)
+		case <-configChanged:
+			log.Info("Config changed, reloading")
+			handleReload(st, s, tasks, demandUpdate)
+		case <-closedown:
+			break closing
+		}
+	}
+
 	log.Info("Clean up when ready")
-	// Give the scheduler a chance to do any necessary cleanup
+	// We don't need to hear about config changes any more
+	if watcher != nil {
+		watcher.StopWatch()
+	}
+	// Give the scheduler a chance to do any necessary cleanup, including stopping anything that triggers demand updates
 	s.Cleanup()
 	// The demand engine is responsible for closing the demandUpdate channel so that we stop
 	// doing scaling operations
 	de.StopDemand(demandUpdate)
 
-	exitWaitTimeout := time.NewTicker(constGetMetricsTimeout * time.Millisecond)
-	for _ = range exitWaitTimeout.C {
-		if tasks.Exited() {
-			log.Info("All finished")
-			break
+	// Standbys leave the tasks to the leader
+	if isLeader(elector) {
+		exitWaitTimeout := time.NewTicker(constGetMetricsTimeout * time.Millisecond)
+		for _ = range exitWaitTimeout.C {
+			if tasks.Exited() {
+				log.Info("All finished")
+				break
+			}
 		}
 	}
+
+	// Some schedulers have more to do once the shutdown policies have been applied
+	if sh, ok := s.(scheduler.ShutdownHandler); ok {
+		err := sh.Shutdown()
+		if err != nil {
+			log.Errorf("Failed to shut down scheduler. %v", err)
+		}
+	}
+
+	// Release the lock so a standby can take over straight away
+	if elector != nil {
+		elector.Stop()
+	}
 }
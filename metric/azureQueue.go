@@ -3,6 +3,7 @@ package metric
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
 )
@@ -57,13 +58,20 @@ func NewAzureQueueMetric(queueName string) *AzureQueueMetric {
 }
 
 // UpdateCurrent calls the Azure Storage API to get the queue length and stores the value in the metric.
-func (aqm *AzureQueueMetric) UpdateCurrent() {
+func (aqm *AzureQueueMetric) UpdateCurrent() (sampled time.Time, err error) {
+	if !azureInitialized {
+		return sampled, fmt.Errorf("Azure client not initialized")
+	}
+
 	metadata, err := azureQueueClient.GetMetadata(aqm.azureQueueName)
 	if err != nil {
 		log.Errorf("Error getting Azure queue info: %v", err)
+		return sampled, err
 	}
+
 	aqm.currentVal = metadata.ApproximateMessageCount
 	log.Debugf("Queue name %s length %d", aqm.azureQueueName, aqm.currentVal)
+	return time.Now(), nil
 }
 
 // Current reads out the value of the current queue length
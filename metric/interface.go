@@ -2,13 +2,23 @@
 package metric
 
 import (
+	"time"
+
 	"github.com/op/go-logging"
 )
 
 // Metric is something we measure. Each task is associated with a Metric and a Target that we want the Metric to stay close to.
+// UpdateCurrent takes a new reading and returns when it was sampled. If it fails it returns an error and Current keeps the
+// previous value, which shouldn't be relied on for scaling.
 type Metric interface {
-	UpdateCurrent()
+	UpdateCurrent() (sampled time.Time, err error)
 	Current() int
 }
 
+// ContainerLimiter is implemented by metrics that limit how many containers it's useful to run, for example because a Kafka
+// consumer group can't have more active consumers than there are partitions. MaxContainers returns 0 if there's no limit.
+type ContainerLimiter interface {
+	MaxContainers() int
+}
+
 var log = logging.MustGetLogger("mssmetric")
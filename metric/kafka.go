@@ -0,0 +1,200 @@
+package metric
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const constKafkaBrokers string = "127.0.0.1:9092"
+
+// compile-time assert that we implement the right interfaces
+var _ Metric = (*KafkaLagMetric)(nil)
+var _ ContainerLimiter = (*KafkaLagMetric)(nil)
+
+// KafkaLagMetric measures how far a consumer group is behind the end of a Kafka topic, summed over all the partitions.
+type KafkaLagMetric struct {
+	currentVal int
+	partitions int
+	topicName  string
+	groupID    string
+	brokers    []string
+}
+
+var (
+	kafkaBrokers     []string
+	kafkaInitialized = false
+)
+
+// KafkaInit sets up the list of brokers we use to bootstrap connections to the cluster.
+func KafkaInit() {
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		brokers = constKafkaBrokers
+	}
+
+	kafkaBrokers = nil
+	for _, b := range strings.Split(brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			kafkaBrokers = append(kafkaBrokers, b)
+		}
+	}
+
+	kafkaInitialized = true
+	return
+}
+
+// NewKafkaLagMetric creates the metric for a consumer group reading from a topic.
+func NewKafkaLagMetric(topicName string, groupID string) *KafkaLagMetric {
+	if !kafkaInitialized {
+		KafkaInit()
+	}
+
+	return &KafkaLagMetric{
+		topicName: topicName,
+		groupID:   groupID,
+		brokers:   kafkaBrokers,
+	}
+}
+
+// UpdateCurrent sets the current lag.
+func (km *KafkaLagMetric) UpdateCurrent() (sampled time.Time, err error) {
+	lag, partitions, err := km.getLag()
+	if err != nil {
+		log.Errorf("Error getting Kafka lag for topic %s group %s: %v", km.topicName, km.groupID, err)
+		return sampled, err
+	}
+
+	km.currentVal = lag
+	km.partitions = partitions
+	log.Debugf("Topic: %s Group: %s Partitions: %d Lag: %d", km.topicName, km.groupID, km.partitions, km.currentVal)
+	return time.Now(), nil
+}
+
+// Current returns the lag.
+func (km *KafkaLagMetric) Current() int {
+	return km.currentVal
+}
+
+// MaxContainers returns the number of partitions, as a consumer group can't have more active consumers than this.
+func (km *KafkaLagMetric) MaxContainers() int {
+	return km.partitions
+}
+
+func (km *KafkaLagMetric) getLag() (lag int, partitions int, err error) {
+	conn, err := km.dialAny()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	brokers, topicPartitions, err := conn.metadata(km.topicName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The log start and end offsets have to come from the leader of each partition
+	byLeader := make(map[int32][]int32)
+	var ids []int32
+	for _, p := range topicPartitions {
+		byLeader[p.leader] = append(byLeader[p.leader], p.id)
+		ids = append(ids, p.id)
+	}
+
+	startOffsets := make(map[int32]int64)
+	endOffsets := make(map[int32]int64)
+	for leader, leaderPartitions := range byLeader {
+		broker, ok := brokers[leader]
+		if !ok {
+			return 0, 0, fmt.Errorf("No leader available for some partitions of topic %s", km.topicName)
+		}
+
+		starts, ends, err := getLogOffsets(broker.addr, km.topicName, leaderPartitions)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for p, o := range starts {
+			startOffsets[p] = o
+		}
+		for p, o := range ends {
+			endOffsets[p] = o
+		}
+	}
+
+	coordinator, err := conn.groupCoordinator(km.groupID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	committed, err := getCommittedOffsets(coordinator, km.groupID, km.topicName, ids)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var total int64
+	for _, p := range ids {
+		c, ok := committed[p]
+		if !ok || c < 0 {
+			// The group hasn't committed an offset for this partition yet, so all the messages still in the log are
+			// waiting to be read
+			c = startOffsets[p]
+		}
+
+		if end := endOffsets[p]; end > c {
+			total += end - c
+		}
+	}
+
+	return int(total), len(topicPartitions), nil
+}
+
+// dialAny connects to the first of our bootstrap brokers that's available
+func (km *KafkaLagMetric) dialAny() (conn *kafkaConn, err error) {
+	if len(km.brokers) == 0 {
+		return nil, fmt.Errorf("No Kafka brokers configured")
+	}
+
+	for _, b := range km.brokers {
+		conn, err = dialKafka(b)
+		if err == nil {
+			return conn, nil
+		}
+
+		log.Debugf("Failed to connect to Kafka broker %s: %v", b, err)
+	}
+
+	return nil, err
+}
+
+// getLogOffsets gets the earliest and latest offsets for partitions led by this broker
+func getLogOffsets(addr string, topic string, partitions []int32) (starts map[int32]int64, ends map[int32]int64, err error) {
+	conn, err := dialKafka(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	starts, err = conn.listOffsets(topic, partitions, kafkaEarliestOffset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ends, err = conn.listOffsets(topic, partitions, kafkaLatestOffset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return starts, ends, nil
+}
+
+func getCommittedOffsets(addr string, group string, topic string, partitions []int32) (map[int32]int64, error) {
+	conn, err := dialKafka(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.committedOffsets(group, topic, partitions)
+}
@@ -0,0 +1,509 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Just enough of the Kafka protocol (https://kafka.apache.org/protocol) to measure consumer group lag. We ask each
+// broker which versions of the requests it supports, and send the newest one we know. Brokers from Kafka 4.0 onwards
+// have dropped the oldest versions, and brokers before 0.10 don't support ApiVersions so we can't talk to them.
+const (
+	kafkaListOffsetsKey      int16 = 2
+	kafkaMetadataKey         int16 = 3
+	kafkaOffsetFetchKey      int16 = 9
+	kafkaGroupCoordinatorKey int16 = 10
+	kafkaAPIVersionsKey      int16 = 18
+
+	kafkaLatestOffset    int64 = -1
+	kafkaEarliestOffset  int64 = -2
+	kafkaClientID              = "microscaling"
+	kafkaTimeout               = 10 * time.Second
+	kafkaMaxResponseSize       = 100 * 1024 * 1024
+)
+
+// kafkaVersions are the versions of each request that we can send, oldest first. None of them use the flexible
+// encoding with tagged fields.
+var kafkaVersions = map[int16][]int16{
+	kafkaListOffsetsKey:      {0, 1},
+	kafkaMetadataKey:         {0, 4},
+	kafkaOffsetFetchKey:      {1, 3},
+	kafkaGroupCoordinatorKey: {0, 1},
+}
+
+// kafkaConn is a connection to a single broker
+type kafkaConn struct {
+	conn          net.Conn
+	correlationID int32
+	versions      map[int16]int16 // the version of each request we send to this broker
+}
+
+type kafkaBroker struct {
+	nodeID int32
+	addr   string
+}
+
+type kafkaPartition struct {
+	id     int32
+	leader int32
+}
+
+func dialKafka(addr string) (*kafkaConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, kafkaTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &kafkaConn{conn: conn}
+	err = c.negotiateVersions()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *kafkaConn) Close() error {
+	return c.conn.Close()
+}
+
+// request sends a request and returns the body of the response
+func (c *kafkaConn) request(apiKey int16, apiVersion int16, body []byte) (*kafkaDecoder, error) {
+	c.correlationID++
+
+	var e kafkaEncoder
+	e.putInt16(apiKey)
+	e.putInt16(apiVersion)
+	e.putInt32(c.correlationID)
+	e.putString(kafkaClientID)
+	e.buf.Write(body)
+
+	msg := make([]byte, 4, 4+e.buf.Len())
+	binary.BigEndian.PutUint32(msg, uint32(e.buf.Len()))
+	msg = append(msg, e.buf.Bytes()...)
+
+	c.conn.SetDeadline(time.Now().Add(kafkaTimeout))
+	if _, err := c.conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var size int32
+	if err := binary.Read(c.conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+
+	if size < 4 || size > kafkaMaxResponseSize {
+		return nil, fmt.Errorf("Bad Kafka response size %d", size)
+	}
+
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+
+	d := &kafkaDecoder{b: resp}
+	if id := d.int32(); id != c.correlationID {
+		return nil, fmt.Errorf("Kafka response has correlation ID %d, expected %d", id, c.correlationID)
+	}
+
+	return d, nil
+}
+
+// negotiateVersions asks the broker which versions of each request it supports, and picks the newest one we can send
+func (c *kafkaConn) negotiateVersions() error {
+	// Every broker that supports ApiVersions answers version 0
+	d, err := c.request(kafkaAPIVersionsKey, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	errCode := d.int16()
+	c.versions = make(map[int16]int16)
+	for i := d.arrayLen(); i > 0; i-- {
+		apiKey := d.int16()
+		minVersion := d.int16()
+		maxVersion := d.int16()
+
+		for _, v := range kafkaVersions[apiKey] {
+			if v >= minVersion && v <= maxVersion {
+				c.versions[apiKey] = v
+			}
+		}
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+
+	if errCode != 0 {
+		return fmt.Errorf("Kafka API versions error %d", errCode)
+	}
+
+	return nil
+}
+
+// version gets the version of the request to send, or an error if the broker doesn't support any that we can send
+func (c *kafkaConn) version(apiKey int16) (int16, error) {
+	v, ok := c.versions[apiKey]
+	if !ok {
+		return 0, fmt.Errorf("Kafka broker doesn't support any version of request %d that we can send", apiKey)
+	}
+
+	return v, nil
+}
+
+// metadata finds the brokers in the cluster, and the partitions of the topic and their leaders
+func (c *kafkaConn) metadata(topic string) (brokers map[int32]kafkaBroker, partitions []kafkaPartition, err error) {
+	v, err := c.version(kafkaMetadataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var e kafkaEncoder
+	e.putArrayLen(1)
+	e.putString(topic)
+	if v >= 4 {
+		e.putInt8(0) // don't create the topic if it doesn't exist
+	}
+
+	d, err := c.request(kafkaMetadataKey, v, e.buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if v >= 3 {
+		d.int32() // throttle time
+	}
+
+	brokers = make(map[int32]kafkaBroker)
+	for i := d.arrayLen(); i > 0; i-- {
+		b := kafkaBroker{nodeID: d.int32()}
+		host := d.string()
+		port := d.int32()
+		if v >= 1 {
+			d.string() // rack
+		}
+		b.addr = net.JoinHostPort(host, fmt.Sprintf("%d", port))
+		brokers[b.nodeID] = b
+	}
+
+	if v >= 2 {
+		d.string() // cluster ID
+	}
+	if v >= 1 {
+		d.int32() // controller ID
+	}
+
+	for i := d.arrayLen(); i > 0; i-- {
+		errCode := d.int16()
+		name := d.string()
+		if v >= 1 {
+			d.int8() // internal topic
+		}
+		var topicPartitions []kafkaPartition
+
+		for j := d.arrayLen(); j > 0; j-- {
+			d.int16() // partition error, e.g. replica not available, doesn't matter to us as long as there is a leader
+			p := kafkaPartition{id: d.int32(), leader: d.int32()}
+			d.skipInt32Array() // replicas
+			d.skipInt32Array() // in sync replicas
+			topicPartitions = append(topicPartitions, p)
+		}
+
+		if name != topic {
+			continue
+		}
+
+		if errCode != 0 {
+			return nil, nil, fmt.Errorf("Kafka metadata error %d for topic %s", errCode, topic)
+		}
+
+		partitions = topicPartitions
+	}
+
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+
+	if len(partitions) == 0 {
+		return nil, nil, fmt.Errorf("Kafka topic %s has no partitions", topic)
+	}
+
+	return brokers, partitions, nil
+}
+
+// listOffsets gets the latest or earliest offset for each of the partitions, which must all be led by this broker
+func (c *kafkaConn) listOffsets(topic string, partitions []int32, timestamp int64) (offsets map[int32]int64, err error) {
+	v, err := c.version(kafkaListOffsetsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var e kafkaEncoder
+	e.putInt32(-1) // replica ID
+	e.putArrayLen(1)
+	e.putString(topic)
+	e.putArrayLen(len(partitions))
+	for _, p := range partitions {
+		e.putInt32(p)
+		e.putInt64(timestamp)
+		if v == 0 {
+			e.putInt32(1) // max number of offsets
+		}
+	}
+
+	d, err := c.request(kafkaListOffsetsKey, v, e.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	offsets = make(map[int32]int64)
+	for i := d.arrayLen(); i > 0; i-- {
+		name := d.string()
+		for j := d.arrayLen(); j > 0; j-- {
+			partition := d.int32()
+			errCode := d.int16()
+
+			// Version 0 returns a list of offsets, and later versions return just one
+			var offset int64
+			n := 1
+			if v == 0 {
+				n = d.arrayLen()
+				for k := 0; k < n; k++ {
+					if k == 0 {
+						offset = d.int64()
+					} else {
+						d.int64()
+					}
+				}
+			} else {
+				d.int64() // timestamp
+				offset = d.int64()
+			}
+
+			if name != topic {
+				continue
+			}
+
+			if errCode != 0 || n == 0 {
+				return nil, fmt.Errorf("Kafka list offsets error %d for topic %s partition %d", errCode, topic, partition)
+			}
+
+			offsets[partition] = offset
+		}
+	}
+
+	return offsets, d.err
+}
+
+// groupCoordinator finds the broker that manages the consumer group's offsets
+func (c *kafkaConn) groupCoordinator(group string) (addr string, err error) {
+	v, err := c.version(kafkaGroupCoordinatorKey)
+	if err != nil {
+		return "", err
+	}
+
+	var e kafkaEncoder
+	e.putString(group)
+	if v >= 1 {
+		e.putInt8(0) // the key is a group ID
+	}
+
+	d, err := c.request(kafkaGroupCoordinatorKey, v, e.buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	if v >= 1 {
+		d.int32() // throttle time
+	}
+	errCode := d.int16()
+	if v >= 1 {
+		d.string() // error message
+	}
+	d.int32() // node ID
+	host := d.string()
+	port := d.int32()
+
+	if d.err != nil {
+		return "", d.err
+	}
+
+	if errCode != 0 {
+		return "", fmt.Errorf("Kafka group coordinator error %d for group %s", errCode, group)
+	}
+
+	return net.JoinHostPort(host, fmt.Sprintf("%d", port)), nil
+}
+
+// committedOffsets gets the group's committed offset for each partition, which is -1 if it hasn't committed one.
+// This must be sent to the group coordinator.
+func (c *kafkaConn) committedOffsets(group string, topic string, partitions []int32) (offsets map[int32]int64, err error) {
+	// Version 0 read offsets stored in ZooKeeper rather than Kafka, so we never send it
+	v, err := c.version(kafkaOffsetFetchKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var e kafkaEncoder
+	e.putString(group)
+	e.putArrayLen(1)
+	e.putString(topic)
+	e.putArrayLen(len(partitions))
+	for _, p := range partitions {
+		e.putInt32(p)
+	}
+
+	d, err := c.request(kafkaOffsetFetchKey, v, e.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if v >= 3 {
+		d.int32() // throttle time
+	}
+
+	offsets = make(map[int32]int64)
+	for i := d.arrayLen(); i > 0; i-- {
+		name := d.string()
+		for j := d.arrayLen(); j > 0; j-- {
+			partition := d.int32()
+			offset := d.int64()
+			d.string() // metadata
+			errCode := d.int16()
+
+			if name != topic {
+				continue
+			}
+
+			if errCode != 0 {
+				return nil, fmt.Errorf("Kafka offset fetch error %d for group %s topic %s partition %d", errCode, group, topic, partition)
+			}
+
+			offsets[partition] = offset
+		}
+	}
+
+	// From version 2, errors for the whole group come after the partitions
+	if v >= 2 {
+		if errCode := d.int16(); errCode != 0 {
+			return nil, fmt.Errorf("Kafka offset fetch error %d for group %s", errCode, group)
+		}
+	}
+
+	return offsets, d.err
+}
+
+type kafkaEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *kafkaEncoder) putInt8(v int8) {
+	e.buf.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) putInt16(v int16) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) putInt32(v int32) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) putInt64(v int64) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) putArrayLen(n int) {
+	e.putInt32(int32(n))
+}
+
+func (e *kafkaEncoder) putString(s string) {
+	e.putInt16(int16(len(s)))
+	e.buf.WriteString(s)
+}
+
+// kafkaDecoder reads a response. Once an error occurs, all further reads return zero values and the error is kept.
+type kafkaDecoder struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || d.off+n > len(d.b) {
+		d.err = fmt.Errorf("Kafka response too short")
+		return nil
+	}
+
+	v := d.b[d.off : d.off+n]
+	d.off += n
+	return v
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if v := d.next(1); v != nil {
+		return int8(v[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if v := d.next(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if v := d.next(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if v := d.next(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+// string reads a string, returning "" for a null string
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+
+	return string(d.next(int(n)))
+}
+
+// arrayLen reads the length of an array, returning 0 for a null array
+func (d *kafkaDecoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 || d.err != nil {
+		return 0
+	}
+
+	// Each element takes at least one byte, so this guards against allocating huge arrays for a bad response
+	if int(n) > len(d.b)-d.off {
+		d.err = fmt.Errorf("Kafka response has bad array length %d", n)
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *kafkaDecoder) skipInt32Array() {
+	d.next(4 * d.arrayLen())
+}
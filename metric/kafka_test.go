@@ -0,0 +1,364 @@
+package metric
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// fakeKafka is a single broker that leads all partitions and coordinates all groups
+type fakeKafka struct {
+	listener     net.Listener
+	topic        string
+	group        string
+	versions     map[int16][2]int16 // the min and max version of each request
+	startOffsets []int64
+	endOffsets   []int64
+	committed    []int64
+}
+
+// Versions supported by a Kafka 4.0 broker, which has dropped the oldest ones
+var kafka4Versions = map[int16][2]int16{
+	kafkaListOffsetsKey:      {1, 9},
+	kafkaMetadataKey:         {4, 12},
+	kafkaOffsetFetchKey:      {1, 9},
+	kafkaGroupCoordinatorKey: {1, 6},
+	kafkaAPIVersionsKey:      {0, 4},
+}
+
+// Versions supported by a Kafka 0.10.0 broker
+var kafka010Versions = map[int16][2]int16{
+	kafkaListOffsetsKey:      {0, 0},
+	kafkaMetadataKey:         {0, 1},
+	kafkaOffsetFetchKey:      {0, 1},
+	kafkaGroupCoordinatorKey: {0, 0},
+	kafkaAPIVersionsKey:      {0, 0},
+}
+
+func newFakeKafka(t *testing.T, topic string, group string) *fakeKafka {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	f := &fakeKafka{
+		listener: l,
+		topic:    topic,
+		group:    group,
+		versions: kafka4Versions,
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go f.serve(t, conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeKafka) addr() (host string, port int32) {
+	host, p, _ := net.SplitHostPort(f.listener.Addr().String())
+	n, _ := strconv.Atoi(p)
+	return host, int32(n)
+}
+
+func (f *fakeKafka) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+
+		req := make([]byte, size)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		d := &kafkaDecoder{b: req}
+		apiKey := d.int16()
+		apiVersion := d.int16()
+		correlationID := d.int32()
+		d.string() // client ID
+
+		if r, ok := f.versions[apiKey]; !ok || apiVersion < r[0] || apiVersion > r[1] {
+			t.Errorf("Unsupported version %d of request %d", apiVersion, apiKey)
+			return
+		}
+
+		var e kafkaEncoder
+		e.putInt32(correlationID)
+
+		switch apiKey {
+		case kafkaAPIVersionsKey:
+			f.apiVersions(d, &e)
+		case kafkaMetadataKey:
+			f.metadata(apiVersion, d, &e)
+		case kafkaListOffsetsKey:
+			f.listOffsets(apiVersion, d, &e)
+		case kafkaGroupCoordinatorKey:
+			f.groupCoordinator(apiVersion, d, &e)
+		case kafkaOffsetFetchKey:
+			if apiVersion == 0 {
+				t.Errorf("Expected offsets to be fetched from Kafka rather than ZooKeeper")
+			}
+			f.offsetFetch(apiVersion, d, &e)
+		default:
+			t.Errorf("Unexpected API key %d", apiKey)
+			return
+		}
+
+		if d.err != nil || d.off != len(d.b) {
+			t.Errorf("Failed to decode request %d version %d: %v", apiKey, apiVersion, d.err)
+			return
+		}
+
+		resp := make([]byte, 4)
+		binary.BigEndian.PutUint32(resp, uint32(e.buf.Len()))
+		conn.Write(append(resp, e.buf.Bytes()...))
+	}
+}
+
+func (f *fakeKafka) apiVersions(d *kafkaDecoder, e *kafkaEncoder) {
+	e.putInt16(0)
+	e.putArrayLen(len(f.versions))
+	for key, r := range f.versions {
+		e.putInt16(key)
+		e.putInt16(r[0])
+		e.putInt16(r[1])
+	}
+}
+
+func (f *fakeKafka) metadata(v int16, d *kafkaDecoder, e *kafkaEncoder) {
+	host, port := f.addr()
+	if v >= 3 {
+		e.putInt32(0) // throttle time
+	}
+	e.putArrayLen(1)
+	e.putInt32(1)
+	e.putString(host)
+	e.putInt32(port)
+	if v >= 1 {
+		e.putInt16(-1) // no rack
+	}
+	if v >= 2 {
+		e.putString("cluster")
+	}
+	if v >= 1 {
+		e.putInt32(1) // controller
+	}
+
+	n := d.arrayLen()
+	e.putArrayLen(n)
+	for i := 0; i < n; i++ {
+		topic := d.string()
+		if topic != f.topic {
+			e.putInt16(3) // unknown topic
+			e.putString(topic)
+			if v >= 1 {
+				e.putInt8(0)
+			}
+			e.putArrayLen(0)
+			continue
+		}
+
+		e.putInt16(0)
+		e.putString(topic)
+		if v >= 1 {
+			e.putInt8(0)
+		}
+		e.putArrayLen(len(f.endOffsets))
+		for p := range f.endOffsets {
+			e.putInt16(0)
+			e.putInt32(int32(p))
+			e.putInt32(1) // leader
+			e.putArrayLen(1)
+			e.putInt32(1)
+			e.putArrayLen(1)
+			e.putInt32(1)
+		}
+	}
+
+	if v >= 4 {
+		d.int8() // allow topic creation
+	}
+}
+
+func (f *fakeKafka) listOffsets(v int16, d *kafkaDecoder, e *kafkaEncoder) {
+	d.int32() // replica ID
+	n := d.arrayLen()
+	e.putArrayLen(n)
+	for i := 0; i < n; i++ {
+		e.putString(d.string())
+		np := d.arrayLen()
+		e.putArrayLen(np)
+		for j := 0; j < np; j++ {
+			p := d.int32()
+			offset := f.endOffsets[p]
+			if d.int64() == kafkaEarliestOffset {
+				offset = f.startOffsets[p]
+			}
+
+			e.putInt32(p)
+			e.putInt16(0)
+			if v == 0 {
+				d.int32() // max offsets
+				e.putArrayLen(1)
+			} else {
+				e.putInt64(-1) // timestamp
+			}
+			e.putInt64(offset)
+		}
+	}
+}
+
+func (f *fakeKafka) groupCoordinator(v int16, d *kafkaDecoder, e *kafkaEncoder) {
+	host, port := f.addr()
+	group := d.string()
+	if v >= 1 {
+		d.int8()      // key type
+		e.putInt32(0) // throttle time
+	}
+
+	if group != f.group {
+		e.putInt16(15) // coordinator not available
+	} else {
+		e.putInt16(0)
+	}
+	if v >= 1 {
+		e.putInt16(-1) // no error message
+	}
+	e.putInt32(1)
+	e.putString(host)
+	e.putInt32(port)
+}
+
+func (f *fakeKafka) offsetFetch(v int16, d *kafkaDecoder, e *kafkaEncoder) {
+	d.string() // group
+	if v >= 3 {
+		e.putInt32(0) // throttle time
+	}
+	n := d.arrayLen()
+	e.putArrayLen(n)
+	for i := 0; i < n; i++ {
+		e.putString(d.string())
+		np := d.arrayLen()
+		e.putArrayLen(np)
+		for j := 0; j < np; j++ {
+			p := d.int32()
+			e.putInt32(p)
+			e.putInt64(f.committed[p])
+			e.putInt16(-1) // null metadata
+			e.putInt16(0)
+		}
+	}
+	if v >= 2 {
+		e.putInt16(0)
+	}
+}
+
+func TestKafkaLagMetric(t *testing.T) {
+	f := newFakeKafka(t, "events", "consumers")
+	defer f.listener.Close()
+
+	f.startOffsets = []int64{0, 0, 15}
+	f.endOffsets = []int64{100, 250, 40}
+	f.committed = []int64{90, 200, -1}
+
+	m := KafkaLagMetric{
+		topicName: "events",
+		groupID:   "consumers",
+		brokers:   []string{"127.0.0.1:1", f.listener.Addr().String()},
+	}
+
+	_, err := m.UpdateCurrent()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// The partition without a committed offset counts from the start of the log
+	if m.Current() != 85 {
+		t.Errorf("Expected lag 85, got %d", m.Current())
+	}
+
+	if m.MaxContainers() != 3 {
+		t.Errorf("Expected max containers 3, got %d", m.MaxContainers())
+	}
+
+	// A consumer can be ahead of the end offset we read
+	f.committed = []int64{100, 260, 10}
+	m.UpdateCurrent()
+	if m.Current() != 30 {
+		t.Errorf("Expected lag 30, got %d", m.Current())
+	}
+
+	// Errors leave the previous value in place
+	m.topicName = "missing"
+	_, err = m.UpdateCurrent()
+	if err == nil {
+		t.Errorf("Expected an error for a missing topic")
+	}
+
+	if m.Current() != 30 || m.MaxContainers() != 3 {
+		t.Errorf("Expected previous values after an error, got lag %d max containers %d", m.Current(), m.MaxContainers())
+	}
+
+	m.topicName = "events"
+	m.groupID = "other"
+	_, err = m.UpdateCurrent()
+	if err == nil {
+		t.Errorf("Expected an error for a coordinator error")
+	}
+
+	if m.Current() != 30 {
+		t.Errorf("Expected previous lag after a coordinator error, got %d", m.Current())
+	}
+}
+
+func TestKafkaVersions(t *testing.T) {
+	f := newFakeKafka(t, "events", "consumers")
+	defer f.listener.Close()
+
+	f.startOffsets = []int64{10, 0}
+	f.endOffsets = []int64{100, 250}
+	f.committed = []int64{-1, 200}
+
+	m := KafkaLagMetric{
+		topicName: "events",
+		groupID:   "consumers",
+		brokers:   []string{f.listener.Addr().String()},
+	}
+
+	// Older brokers get the oldest versions of each request
+	f.versions = kafka010Versions
+	_, err := m.UpdateCurrent()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if m.Current() != 140 {
+		t.Errorf("Expected lag 140, got %d", m.Current())
+	}
+
+	// We can't talk to a broker that doesn't support any of the versions we know
+	f.versions = map[int16][2]int16{
+		kafkaListOffsetsKey:      {1, 9},
+		kafkaMetadataKey:         {5, 12},
+		kafkaOffsetFetchKey:      {1, 9},
+		kafkaGroupCoordinatorKey: {1, 6},
+		kafkaAPIVersionsKey:      {0, 4},
+	}
+	_, err = m.UpdateCurrent()
+	if err == nil {
+		t.Errorf("Expected an error for unsupported request versions")
+	}
+}
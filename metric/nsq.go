@@ -3,7 +3,9 @@ package metric
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/microscaling/microscaling/utils"
 )
@@ -72,18 +74,20 @@ func NewNSQMetric(topicName string, channelName string) *NSQMetric {
 }
 
 // UpdateCurrent sets the current queue length.
-func (nsqm *NSQMetric) UpdateCurrent() {
+func (nsqm *NSQMetric) UpdateCurrent() (sampled time.Time, err error) {
 	var statsMessage StatsMessage
 
 	url := "http://" + nsqStatsEndpoint + constNSQStatsAPI
 	body, err := utils.GetJSON(url)
 	if err != nil {
 		log.Errorf("Error getting NSQ metric %v", err)
+		return sampled, err
 	}
 
 	err = json.Unmarshal(body, &statsMessage)
 	if err != nil {
 		log.Errorf("Error %v unmarshalling from %s", err, string(body[:]))
+		return sampled, err
 	}
 
 	// Loop through NSQ Channels and Metrics to find the correct value.
@@ -92,12 +96,16 @@ func (nsqm *NSQMetric) UpdateCurrent() {
 			for _, channel := range topic.Channels {
 				if channel.ChannelName == nsqm.channelName {
 					nsqm.currentVal = channel.Depth
+					log.Debugf("Topic: %s Channel: %s Length: %d", nsqm.topicName, nsqm.channelName, nsqm.currentVal)
+					return time.Now(), nil
 				}
 			}
 		}
 	}
 
-	log.Debugf("Topic: %s Channel: %s Length: %d", nsqm.topicName, nsqm.channelName, nsqm.currentVal)
+	err = fmt.Errorf("NSQ topic %s channel %s not found", nsqm.topicName, nsqm.channelName)
+	log.Errorf("Error getting NSQ metric %v", err)
+	return sampled, err
 }
 
 // Current returns the queue length.
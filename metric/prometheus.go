@@ -0,0 +1,172 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/microscaling/microscaling/utils"
+)
+
+const constPrometheusURL string = "http://127.0.0.1:9090"
+const constPrometheusQueryAPI string = "/api/v1/query"
+
+// compile-time assert that we implement the right interface
+var _ Metric = (*PrometheusMetric)(nil)
+
+// PrometheusMetric is the result of a PromQL query, so we can scale on anything Prometheus collects
+type PrometheusMetric struct {
+	currentVal    int
+	query         string
+	prometheusURL string
+}
+
+// PrometheusQueryResponse from the Prometheus HTTP API
+type PrometheusQueryResponse struct {
+	Status    string              `json:"status"`
+	Data      PrometheusQueryData `json:"data"`
+	ErrorType string              `json:"errorType"`
+	Error     string              `json:"error"`
+}
+
+// PrometheusQueryData from the Prometheus HTTP API. The format of the result depends on the result type.
+type PrometheusQueryData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// PrometheusSample is an element of a vector result from the Prometheus HTTP API
+type PrometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+var (
+	prometheusURL         string
+	prometheusInitialized = false
+)
+
+// PrometheusInit sets up the URL of the Prometheus server.
+func PrometheusInit() {
+	prometheusURL = os.Getenv("PROMETHEUS_URL")
+	if prometheusURL == "" {
+		prometheusURL = constPrometheusURL
+	}
+
+	prometheusURL = strings.TrimSuffix(prometheusURL, "/")
+	prometheusInitialized = true
+	return
+}
+
+// NewPrometheusMetric creates the metric for a PromQL query, which should return a scalar or a single element vector.
+func NewPrometheusMetric(query string) *PrometheusMetric {
+	if !prometheusInitialized {
+		PrometheusInit()
+	}
+
+	return &PrometheusMetric{
+		query:         query,
+		prometheusURL: prometheusURL,
+	}
+}
+
+// UpdateCurrent runs the query and stores the result, rounded to the nearest integer. The sample time is the time
+// Prometheus evaluated the query.
+func (pm *PrometheusMetric) UpdateCurrent() (sampled time.Time, err error) {
+	v, sampled, err := pm.runQuery()
+	if err != nil {
+		log.Errorf("Error getting Prometheus metric for query %s: %v", pm.query, err)
+		return sampled, err
+	}
+
+	pm.currentVal = int(math.Floor(v + 0.5))
+	log.Debugf("Query: %s Value: %f", pm.query, v)
+	return sampled, nil
+}
+
+// Current returns the result of the query.
+func (pm *PrometheusMetric) Current() int {
+	return pm.currentVal
+}
+
+func (pm *PrometheusMetric) runQuery() (v float64, sampled time.Time, err error) {
+	var resp PrometheusQueryResponse
+
+	body, err := utils.GetJSON(pm.prometheusURL + constPrometheusQueryAPI + "?query=" + url.QueryEscape(pm.query))
+	if err != nil {
+		return 0, sampled, err
+	}
+
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return 0, sampled, fmt.Errorf("Error %v unmarshalling from %s", err, string(body[:]))
+	}
+
+	if resp.Status != "success" {
+		return 0, sampled, fmt.Errorf("Query failed: %s %s", resp.ErrorType, resp.Error)
+	}
+
+	var value []interface{}
+
+	switch resp.Data.ResultType {
+	case "scalar":
+		err = json.Unmarshal(resp.Data.Result, &value)
+		if err != nil {
+			return 0, sampled, fmt.Errorf("Bad scalar result: %v", err)
+		}
+
+	case "vector":
+		var samples []PrometheusSample
+		err = json.Unmarshal(resp.Data.Result, &samples)
+		if err != nil {
+			return 0, sampled, fmt.Errorf("Bad vector result: %v", err)
+		}
+
+		if len(samples) != 1 {
+			return 0, sampled, fmt.Errorf("Expected one sample but query returned %d", len(samples))
+		}
+
+		value = samples[0].Value
+
+	default:
+		return 0, sampled, fmt.Errorf("Unsupported result type %s", resp.Data.ResultType)
+	}
+
+	return sampleValue(value)
+}
+
+// sampleValue gets the value and time from a [timestamp, "value"] pair
+func sampleValue(value []interface{}) (v float64, sampled time.Time, err error) {
+	if len(value) != 2 {
+		return 0, sampled, fmt.Errorf("Unexpected sample %v", value)
+	}
+
+	ts, ok := value[0].(float64)
+	if !ok {
+		return 0, sampled, fmt.Errorf("Unexpected sample time %v", value[0])
+	}
+
+	s, ok := value[1].(string)
+	if !ok {
+		return 0, sampled, fmt.Errorf("Unexpected sample value %v", value[1])
+	}
+
+	v, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, sampled, err
+	}
+
+	sec, frac := math.Modf(ts)
+	sampled = time.Unix(int64(sec), int64(frac*1e9))
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, sampled, fmt.Errorf("Query result %s is not a number", s)
+	}
+
+	return v, sampled, nil
+}
@@ -0,0 +1,92 @@
+package metric
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type prometheusTest struct {
+	status   int
+	resp     string
+	expected int
+	expErr   bool
+}
+
+func TestPrometheusUpdateCurrent(t *testing.T) {
+	cases := []prometheusTest{
+		prometheusTest{
+			status:   http.StatusOK,
+			resp:     `{"status":"success","data":{"resultType":"scalar","result":[1482325120.123,"42"]}}`,
+			expected: 42,
+		},
+		prometheusTest{
+			status:   http.StatusOK,
+			resp:     `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"web"},"value":[1482325120.123,"17.6"]}]}}`,
+			expected: 18,
+		},
+		// Errors leave the previous value in place
+		prometheusTest{
+			status:   http.StatusBadRequest,
+			resp:     `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+			expected: 18,
+			expErr:   true,
+		},
+		prometheusTest{
+			status:   http.StatusOK,
+			resp:     `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			expected: 18,
+			expErr:   true,
+		},
+		prometheusTest{
+			status:   http.StatusOK,
+			resp:     `{"status":"success","data":{"resultType":"scalar","result":[1482325120.123,"NaN"]}}`,
+			expected: 18,
+			expErr:   true,
+		},
+		prometheusTest{
+			status:   http.StatusOK,
+			resp:     `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1482325120.123,"0.2"]}]}}`,
+			expected: 0,
+		},
+	}
+
+	var query string
+	var c prometheusTest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		query = r.URL.Query().Get("query")
+		w.WriteHeader(c.status)
+		w.Write([]byte(c.resp))
+	}))
+	defer server.Close()
+
+	m := PrometheusMetric{
+		query:         `sum(rate(http_requests_total{job="web"}[1m]))`,
+		prometheusURL: server.URL,
+	}
+
+	for i := range cases {
+		c = cases[i]
+		sampled, err := m.UpdateCurrent()
+		if c.expErr != (err != nil) {
+			t.Errorf("Test %d: unexpected error %v", i, err)
+		}
+
+		if err == nil && sampled.Unix() != 1482325120 {
+			t.Errorf("Test %d: unexpected sample time %v", i, sampled)
+		}
+
+		if query != m.query {
+			t.Errorf("Test %d: query was %s", i, query)
+		}
+
+		if m.Current() != c.expected {
+			t.Errorf("Test %d: expected %d but was %d", i, c.expected, m.Current())
+		}
+	}
+}
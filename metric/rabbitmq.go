@@ -0,0 +1,146 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const constRabbitMQEndpoint string = "127.0.0.1:15672"
+const constRabbitMQQueuesAPI string = "/api/queues/"
+const constRabbitMQDefaultVhost string = "/"
+
+// compile-time assert that we implement the right interface
+var _ Metric = (*RabbitMQMetric)(nil)
+
+// RabbitMQMetric stores the current length of a RabbitMQ queue.
+type RabbitMQMetric struct {
+	currentVal     int
+	vhost          string
+	queueName      string
+	includeUnacked bool
+	endpoint       string
+}
+
+// RabbitMQQueue from the RabbitMQ management API.
+type RabbitMQQueue struct {
+	Name                   string `json:"name"`
+	Vhost                  string `json:"vhost"`
+	MessagesReady          int    `json:"messages_ready"`
+	MessagesUnacknowledged int    `json:"messages_unacknowledged"`
+}
+
+var (
+	rabbitMQEndpoint    string
+	rabbitMQUser        string
+	rabbitMQPassword    string
+	rabbitMQInitialized = false
+
+	rabbitMQClient = &http.Client{
+		Timeout: 10 * time.Second,
+	}
+)
+
+// RabbitMQInit sets up the RabbitMQ management API endpoint and credentials.
+func RabbitMQInit() {
+	rabbitMQEndpoint = os.Getenv("RABBITMQ_MANAGEMENT_ENDPOINT")
+	if rabbitMQEndpoint == "" {
+		rabbitMQEndpoint = constRabbitMQEndpoint
+	}
+
+	rabbitMQUser = os.Getenv("RABBITMQ_USER")
+	if rabbitMQUser == "" {
+		rabbitMQUser = "guest"
+	}
+
+	rabbitMQPassword = os.Getenv("RABBITMQ_PASSWORD")
+	if rabbitMQPassword == "" {
+		rabbitMQPassword = "guest"
+	}
+
+	rabbitMQInitialized = true
+	return
+}
+
+// NewRabbitMQMetric creates the metric. The queue length is the number of messages ready for delivery, plus
+// messages that have been delivered but not yet acknowledged if includeUnacked is set.
+func NewRabbitMQMetric(vhost string, queueName string, includeUnacked bool) *RabbitMQMetric {
+	if !rabbitMQInitialized {
+		RabbitMQInit()
+	}
+
+	if vhost == "" {
+		vhost = constRabbitMQDefaultVhost
+	}
+
+	return &RabbitMQMetric{
+		vhost:          vhost,
+		queueName:      queueName,
+		includeUnacked: includeUnacked,
+		endpoint:       rabbitMQEndpoint,
+	}
+}
+
+// UpdateCurrent sets the current queue length.
+func (rm *RabbitMQMetric) UpdateCurrent() (sampled time.Time, err error) {
+	queue, err := rm.getQueue()
+	if err != nil {
+		log.Errorf("Error getting RabbitMQ metric %v", err)
+		return sampled, err
+	}
+
+	rm.currentVal = queue.MessagesReady
+	if rm.includeUnacked {
+		rm.currentVal += queue.MessagesUnacknowledged
+	}
+
+	log.Debugf("Vhost: %s Queue: %s Length: %d", rm.vhost, rm.queueName, rm.currentVal)
+	return time.Now(), nil
+}
+
+// Current returns the queue length.
+func (rm *RabbitMQMetric) Current() int {
+	return rm.currentVal
+}
+
+func (rm *RabbitMQMetric) getQueue() (queue RabbitMQQueue, err error) {
+	u := "http://" + rm.endpoint + constRabbitMQQueuesAPI + rabbitMQEscape(rm.vhost) + "/" + rabbitMQEscape(rm.queueName)
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return queue, err
+	}
+
+	req.SetBasicAuth(rabbitMQUser, rabbitMQPassword)
+	resp, err := rabbitMQClient.Do(req)
+	if err != nil {
+		return queue, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return queue, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return queue, fmt.Errorf("GET request failed %s %d: %s", u, resp.StatusCode, string(body[:]))
+	}
+
+	err = json.Unmarshal(body, &queue)
+	if err != nil {
+		return queue, fmt.Errorf("Error %v unmarshalling from %s", err, string(body[:]))
+	}
+
+	return queue, nil
+}
+
+// rabbitMQEscape escapes a vhost or queue name for use in a path. The default vhost "/" must be sent as %2F.
+func rabbitMQEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
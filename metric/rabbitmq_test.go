@@ -0,0 +1,55 @@
+package metric
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRabbitMQUpdateCurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "guest" || password != "guest" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.EscapedPath() != "/api/queues/%2F/work" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Object Not Found","reason":"Not Found"}`))
+			return
+		}
+
+		w.Write([]byte(`{"name":"work","vhost":"/","messages":12,"messages_ready":8,"messages_unacknowledged":4}`))
+	}))
+	defer server.Close()
+
+	RabbitMQInit()
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		queueName      string
+		includeUnacked bool
+		expected       int
+		expErr         bool
+	}{
+		{queueName: "work", expected: 8},
+		{queueName: "work", includeUnacked: true, expected: 12},
+		{queueName: "missing", expected: 0, expErr: true},
+	}
+
+	for i, test := range tests {
+		m := NewRabbitMQMetric("", test.queueName, test.includeUnacked)
+		m.endpoint = endpoint
+
+		_, err := m.UpdateCurrent()
+		if test.expErr != (err != nil) {
+			t.Errorf("Test %d: unexpected error %v", i, err)
+		}
+
+		if m.Current() != test.expected {
+			t.Errorf("Test %d: expected %d but was %d", i, test.expected, m.Current())
+		}
+	}
+}
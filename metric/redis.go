@@ -0,0 +1,211 @@
+package metric
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const constRedisAddress string = "127.0.0.1:6379"
+const constRedisTimeout = 10 * time.Second
+
+// Redis commands we can use to measure the length of a queue
+const (
+	RedisListLength    = "LLEN"     // length of a list
+	RedisStreamLength  = "XLEN"     // number of entries in a stream
+	RedisStreamPending = "XPENDING" // entries delivered to a stream consumer group but not yet acknowledged
+	RedisSortedSetSize = "ZCARD"    // number of members of a sorted set
+)
+
+// compile-time assert that we implement the right interface
+var _ Metric = (*RedisMetric)(nil)
+
+// RedisMetric stores the current length of a Redis list, stream or sorted set.
+type RedisMetric struct {
+	currentVal int
+	command    string
+	key        string
+	group      string
+	address    string
+}
+
+var (
+	redisAddress     string
+	redisPassword    string
+	redisInitialized = false
+)
+
+// RedisInit sets up the Redis server address and password.
+func RedisInit() {
+	redisAddress = os.Getenv("REDIS_ADDRESS")
+	if redisAddress == "" {
+		redisAddress = constRedisAddress
+	}
+
+	redisPassword = os.Getenv("REDIS_PASSWORD")
+	redisInitialized = true
+	return
+}
+
+// ParseRedisCommand checks the command is one we support, defaulting to LLEN
+func ParseRedisCommand(command string) (string, error) {
+	switch strings.ToUpper(command) {
+	case "", RedisListLength:
+		return RedisListLength, nil
+	case RedisStreamLength, RedisStreamPending, RedisSortedSetSize:
+		return strings.ToUpper(command), nil
+	default:
+		return "", fmt.Errorf("Unsupported Redis command %s", command)
+	}
+}
+
+// NewRedisMetric creates the metric. The group is only needed for XPENDING.
+func NewRedisMetric(command string, key string, group string) (*RedisMetric, error) {
+	if !redisInitialized {
+		RedisInit()
+	}
+
+	command, err := ParseRedisCommand(command)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisMetric{
+		command: command,
+		key:     key,
+		group:   group,
+		address: redisAddress,
+	}, nil
+}
+
+// UpdateCurrent sets the current queue length.
+func (rm *RedisMetric) UpdateCurrent() (sampled time.Time, err error) {
+	length, err := rm.getLength()
+	if err != nil {
+		log.Errorf("Error getting Redis metric %s %s: %v", rm.command, rm.key, err)
+		return sampled, err
+	}
+
+	rm.currentVal = length
+	log.Debugf("Redis %s %s Length: %d", rm.command, rm.key, rm.currentVal)
+	return time.Now(), nil
+}
+
+// Current returns the queue length.
+func (rm *RedisMetric) Current() int {
+	return rm.currentVal
+}
+
+func (rm *RedisMetric) getLength() (int, error) {
+	conn, err := net.DialTimeout("tcp", rm.address, constRedisTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(constRedisTimeout))
+	r := bufio.NewReader(conn)
+
+	if redisPassword != "" {
+		if _, err = redisCommand(conn, r, "AUTH", redisPassword); err != nil {
+			return 0, err
+		}
+	}
+
+	args := []string{rm.command, rm.key}
+	if rm.command == RedisStreamPending {
+		args = append(args, rm.group)
+	}
+
+	reply, err := redisCommand(conn, r, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	// XPENDING's summary form replies with the count of pending entries followed by details we don't need
+	if a, ok := reply.([]interface{}); ok && rm.command == RedisStreamPending && len(a) > 0 {
+		reply = a[0]
+	}
+
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("Unexpected reply %v", reply)
+	}
+
+	return int(n), nil
+}
+
+// redisCommand sends a command using the Redis protocol (https://redis.io/topics/protocol) and reads the reply
+func redisCommand(conn net.Conn, r *bufio.Reader, args ...string) (interface{}, error) {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, a := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)
+	}
+
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return nil, err
+	}
+
+	return readRedisReply(r)
+}
+
+// readRedisReply reads a reply, which is a string, an int64, nil or a slice of replies
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("Empty Redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, fmt.Errorf("Redis error: %s", line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		return string(b[:n]), nil
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		a := make([]interface{}, n)
+		for i := range a {
+			a[i], err = readRedisReply(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return a, nil
+
+	default:
+		return nil, fmt.Errorf("Unexpected Redis reply %s", line)
+	}
+}
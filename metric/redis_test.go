@@ -0,0 +1,149 @@
+package metric
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+// fakeRedis answers length commands for a few keys, and requires a password if one is set
+func fakeRedis(t *testing.T, password string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				authed := password == ""
+				for {
+					// Commands arrive as an array of bulk strings, which we can read as a reply
+					req, err := readRedisReply(r)
+					if err != nil {
+						return
+					}
+
+					args, ok := req.([]interface{})
+					if !ok || len(args) == 0 {
+						t.Errorf("Unexpected command %v", req)
+						return
+					}
+
+					var key string
+					if len(args) > 1 {
+						key = args[1].(string)
+					}
+
+					var resp string
+					switch {
+					case args[0] == "AUTH":
+						authed = args[1] == password
+						resp = "+OK\r\n"
+						if !authed {
+							resp = "-ERR invalid password\r\n"
+						}
+					case !authed:
+						resp = "-NOAUTH Authentication required.\r\n"
+					case args[0] == "LLEN" && key == "queue":
+						resp = ":12\r\n"
+					case args[0] == "LLEN":
+						resp = ":0\r\n"
+					case args[0] == "XLEN" && key == "stream":
+						resp = ":30\r\n"
+					case args[0] == "XPENDING" && key == "stream" && len(args) == 3 && args[2] == "workers":
+						resp = "*4\r\n:7\r\n$15\r\n1526569495631-0\r\n$15\r\n1526569498055-0\r\n*1\r\n*2\r\n$5\r\nwork1\r\n$1\r\n7\r\n"
+					case args[0] == "XPENDING":
+						resp = "-NOGROUP No such key or consumer group\r\n"
+					case args[0] == "ZCARD" && key == "scheduled":
+						resp = ":5\r\n"
+					default:
+						resp = "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+					}
+
+					conn.Write([]byte(resp))
+				}
+			}(conn)
+		}
+	}()
+
+	return l
+}
+
+func TestRedisUpdateCurrent(t *testing.T) {
+	l := fakeRedis(t, "")
+	defer l.Close()
+
+	RedisInit()
+
+	tests := []struct {
+		command  string
+		key      string
+		group    string
+		expected int
+		expErr   bool
+	}{
+		{command: "", key: "queue", expected: 12},
+		{command: "llen", key: "empty", expected: 0},
+		{command: "XLEN", key: "stream", expected: 30},
+		{command: "XPENDING", key: "stream", group: "workers", expected: 7},
+		{command: "ZCARD", key: "scheduled", expected: 5},
+		// Errors leave the previous value in place
+		{command: "XPENDING", key: "stream", group: "other", expected: 5, expErr: true},
+		{command: "XLEN", key: "queue", expected: 5, expErr: true},
+	}
+
+	m := &RedisMetric{address: l.Addr().String()}
+	for i, test := range tests {
+		command, err := ParseRedisCommand(test.command)
+		if err != nil {
+			t.Fatalf("Test %d: unexpected error %v", i, err)
+		}
+
+		m.command = command
+		m.key = test.key
+		m.group = test.group
+
+		_, err = m.UpdateCurrent()
+		if test.expErr != (err != nil) {
+			t.Errorf("Test %d: unexpected error %v", i, err)
+		}
+
+		if m.Current() != test.expected {
+			t.Errorf("Test %d: expected %d but was %d", i, test.expected, m.Current())
+		}
+	}
+
+	if _, err := NewRedisMetric("LRANGE", "queue", ""); err == nil {
+		t.Errorf("Expected an error for an unsupported command")
+	}
+}
+
+func TestRedisAuth(t *testing.T) {
+	l := fakeRedis(t, "secret")
+	defer l.Close()
+
+	RedisInit()
+	m := &RedisMetric{command: RedisListLength, key: "queue", address: l.Addr().String()}
+
+	_, err := m.UpdateCurrent()
+	if err == nil || m.Current() != 0 {
+		t.Errorf("Expected an error without a password")
+	}
+
+	redisPassword = "secret"
+	defer RedisInit()
+
+	_, err = m.UpdateCurrent()
+	if err != nil || m.Current() != 12 {
+		t.Errorf("Expected 12 but was %d, error %v", m.Current(), err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -47,7 +48,7 @@ func NewSQSMetric(queueURL string) (metric *SQSMetric, err error) {
 }
 
 // UpdateCurrent calls the SQS API to get the queue length and stores the value in the metric.
-func (sm *SQSMetric) UpdateCurrent() {
+func (sm *SQSMetric) UpdateCurrent() (sampled time.Time, err error) {
 	a := make([]*string, 1)
 	a[0] = aws.String(constQueueLengthAttribute)
 
@@ -59,15 +60,19 @@ func (sm *SQSMetric) UpdateCurrent() {
 	m, err := sm.client.GetQueueAttributes(&params)
 	if err != nil {
 		log.Errorf("Failed to get SQS queue info: %v", err)
+		return sampled, err
 	}
 
 	v := aws.StringValue(m.Attributes[constQueueLengthAttribute])
-	sm.currentVal, err = strconv.Atoi(v)
+	length, err := strconv.Atoi(v)
 	if err != nil {
 		log.Errorf("Failed to convert queue length to int: %v", err)
-	} else {
-		log.Debugf("Queue URL %s length %d", sm.queueURL, sm.currentVal)
+		return sampled, err
 	}
+
+	sm.currentVal = length
+	log.Debugf("Queue URL %s length %d", sm.queueURL, sm.currentVal)
+	return time.Now(), nil
 }
 
 // Current reads out the value of the current queue length
@@ -1,6 +1,7 @@
 package metric
 
 import (
+	"errors"
 	"strconv"
 	"testing"
 
@@ -12,6 +13,7 @@ import (
 type mockedQueueAttributes struct {
 	sqsiface.SQSAPI
 	Resp sqs.GetQueueAttributesOutput
+	Err  error
 }
 
 type sqsTest struct {
@@ -21,6 +23,10 @@ type sqsTest struct {
 
 // Mock SQS API call and just return the response that is parsed
 func (m mockedQueueAttributes) GetQueueAttributes(in *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
 	return &m.Resp, nil
 }
 
@@ -59,3 +65,20 @@ func getQueueAttributes(count int) sqs.GetQueueAttributesOutput {
 		Attributes: a,
 	}
 }
+
+func TestUpdateCurrentError(t *testing.T) {
+	m := SQSMetric{
+		client:     mockedQueueAttributes{Err: errors.New("AWS is down")},
+		queueURL:   "https://sqs.us-east-1.amazonaws.com/1234567890/microscaling-test",
+		currentVal: 3,
+	}
+
+	_, err := m.UpdateCurrent()
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+
+	if m.Current() != 3 {
+		t.Errorf("Expected the previous value but was %d", m.Current())
+	}
+}
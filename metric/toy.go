@@ -1,8 +1,14 @@
 package metric
 
-// ToyMetric is only used for testing, but we can set its value
+import (
+	"time"
+)
+
+// ToyMetric is only used for testing, but we can set its value, and make it fail or return an old sample
 type ToyMetric struct {
 	SettableCurrent int
+	SettableError   error
+	SettableSampled time.Time
 }
 
 // compile-time assert that we implement the right interface
@@ -14,7 +20,17 @@ func NewToyMetric() *ToyMetric {
 }
 
 // UpdateCurrent reads the value of the current metric, but this is a no-op for the Toy metric
-func (t *ToyMetric) UpdateCurrent() {}
+func (t *ToyMetric) UpdateCurrent() (sampled time.Time, err error) {
+	if t.SettableError != nil {
+		return sampled, t.SettableError
+	}
+
+	if !t.SettableSampled.IsZero() {
+		return t.SettableSampled, nil
+	}
+
+	return time.Now(), nil
+}
 
 // Current reads out the value of the current queue length
 func (t *ToyMetric) Current() int {
@@ -13,4 +13,10 @@ type Monitor interface {
 	SendMetrics(tasks *demand.Tasks) (err error)
 }
 
+// LeaderReporter is implemented by monitors that report whether this agent is the leader. Standbys keep sending
+// metrics to these monitors, so they stay up to date.
+type LeaderReporter interface {
+	SetLeader(leader bool)
+}
+
 var log = logging.MustGetLogger("mssmonitor")
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	kubeapi "k8s.io/client-go/1.5/pkg/api"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/utils"
+)
+
+// We write each policy's status at most this often, so a busy metric doesn't flood the API server with updates
+const constPolicyStatusInterval = 5 * time.Second
+
+// KubePolicyMonitor writes the state of each task to the status of the MicroscalingPolicy it was created from
+type KubePolicyMonitor struct {
+	KubeConfig string
+	clientset  *kubernetes.Clientset
+	written    map[demand.PolicyRef]writtenStatus
+}
+
+// policyStatus is the status of a MicroscalingPolicy. Fields that are nil are removed from the status.
+type policyStatus struct {
+	CurrentMetric   int     `json:"currentMetric"`
+	IdealContainers int     `json:"idealContainers"`
+	Requested       int     `json:"requested"`
+	Running         int     `json:"running"`
+	LastScaleTime   *string `json:"lastScaleTime"`
+	LastError       *string `json:"lastError"`
+}
+
+// writtenStatus is what we last wrote for a policy, and when
+type writtenStatus struct {
+	status policyStatus
+	at     time.Time
+	failed bool
+}
+
+// compile-time assert that we implement the right interface
+var _ Monitor = (*KubePolicyMonitor)(nil)
+
+// NewKubePolicyMonitor returns a new monitor that writes task state to MicroscalingPolicy status
+func NewKubePolicyMonitor(KubeConfig string) *KubePolicyMonitor {
+	return &KubePolicyMonitor{
+		KubeConfig: KubeConfig,
+		written:    make(map[demand.PolicyRef]writtenStatus),
+	}
+}
+
+// SendMetrics updates the status of the policies whose tasks have changed
+func (m *KubePolicyMonitor) SendMetrics(tasks *demand.Tasks) (err error) {
+	tasks.RLock()
+	statuses := make(map[demand.PolicyRef]policyStatus, len(tasks.Tasks))
+	for _, t := range tasks.Tasks {
+		if t.Policy.Name != "" {
+			statuses[t.Policy] = taskPolicyStatus(t)
+		}
+	}
+	tasks.RUnlock()
+
+	// Forget about policies that have been removed
+	for ref := range m.written {
+		if _, ok := statuses[ref]; !ok {
+			delete(m.written, ref)
+		}
+	}
+
+	now := time.Now()
+	for ref, status := range statuses {
+		last, ok := m.written[ref]
+		if ok && (now.Sub(last.at) < constPolicyStatusInterval || (!last.failed && reflect.DeepEqual(last.status, status))) {
+			continue
+		}
+
+		writeErr := m.writeStatus(ref, status)
+		if writeErr != nil {
+			err = fmt.Errorf("Failed to update status of MicroscalingPolicy %s/%s: %v", ref.Namespace, ref.Name, writeErr)
+			m.written[ref] = writtenStatus{status: last.status, at: now, failed: true}
+			continue
+		}
+
+		m.written[ref] = writtenStatus{status: status, at: now}
+	}
+
+	return err
+}
+
+func taskPolicyStatus(t *demand.Task) policyStatus {
+	s := policyStatus{
+		IdealContainers: t.IdealContainers,
+		Requested:       t.Requested,
+		Running:         t.Running,
+	}
+
+	if t.Metric != nil {
+		s.CurrentMetric = t.Metric.Current()
+	}
+
+	if !t.LastScaled.IsZero() {
+		lastScaleTime := t.LastScaled.UTC().Format(time.RFC3339)
+		s.LastScaleTime = &lastScaleTime
+	}
+
+	if t.MetricError != "" {
+		lastError := t.MetricError
+		s.LastError = &lastError
+	}
+
+	return s
+}
+
+// writeStatus merges the new status into the policy's status subresource
+func (m *KubePolicyMonitor) writeStatus(ref demand.PolicyRef, status policyStatus) (err error) {
+	if m.clientset == nil {
+		m.clientset, err = utils.NewKubeClientset(m.KubeConfig, ref.Namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(map[string]policyStatus{"status": status})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Updating status of MicroscalingPolicy %s/%s: %s", ref.Namespace, ref.Name, string(b))
+	return m.clientset.Core().GetRESTClient().Patch(kubeapi.MergePatchType).
+		AbsPath(utils.KubePolicyPath(ref.Namespace, ref.Name), "status").
+		Body(b).
+		Do().
+		Error()
+}
@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/rest"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/metric"
+	"github.com/microscaling/microscaling/target"
+)
+
+func TestKubePolicyMonitor(t *testing.T) {
+	var patches []map[string]map[string]interface{}
+	statusCode := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.URL.Path != "/apis/microscaling.com/v1alpha1/namespaces/queues/microscalingpolicies/consumer/status" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		if ct := r.Header.Get("Content-Type"); ct != "application/merge-patch+json" {
+			t.Errorf("Unexpected content type %s", ct)
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		var patch map[string]map[string]interface{}
+		err := json.Unmarshal(b, &patch)
+		if err != nil {
+			t.Errorf("Bad patch %s: %v", string(b), err)
+		}
+		patches = append(patches, patch)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	m := NewKubePolicyMonitor("")
+	m.clientset = clientset
+
+	toy := metric.NewToyMetric()
+	toy.SettableCurrent = 75
+	scaled := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	consumer := &demand.Task{Name: "consumer", Requested: 4, Running: 3, IdealContainers: 5, LastScaled: scaled,
+		MetricError: "timeout", Metric: toy, Target: target.NewQueueLengthTarget(50),
+		Policy: demand.PolicyRef{Namespace: "queues", Name: "consumer"}}
+	tasks := demand.Tasks{Tasks: []*demand.Task{
+		consumer,
+		// Tasks that don't come from a policy are left alone
+		{Name: "remainder", Metric: metric.NewNullMetric(), Target: target.NewRemainderTarget(10)},
+	}}
+
+	err = m.SendMetrics(&tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(patches) != 1 {
+		t.Fatalf("Expected one status update, got %d", len(patches))
+	}
+
+	status := patches[0]["status"]
+	if status["currentMetric"] != 75.0 || status["idealContainers"] != 5.0 || status["requested"] != 4.0 || status["running"] != 3.0 {
+		t.Errorf("Unexpected status %v", status)
+	}
+
+	if status["lastScaleTime"] != "2017-03-01T12:00:00Z" || status["lastError"] != "timeout" {
+		t.Errorf("Unexpected scale time or error %v", status)
+	}
+
+	// We don't update the status again straight away
+	consumer.Running = 4
+	m.SendMetrics(&tasks)
+	if len(patches) != 1 {
+		t.Fatalf("Expected status updates to be rate limited")
+	}
+
+	// Once the interval has passed, we only write the status if it has changed
+	ref := consumer.Policy
+	last := m.written[ref]
+	last.at = last.at.Add(-constPolicyStatusInterval)
+	m.written[ref] = last
+
+	consumer.MetricError = ""
+	m.SendMetrics(&tasks)
+	if len(patches) != 2 {
+		t.Fatalf("Expected a second status update, got %d", len(patches))
+	}
+
+	// The error is removed from the status when the metric recovers
+	status = patches[1]["status"]
+	if lastError, ok := status["lastError"]; !ok || lastError != nil || status["running"] != 4.0 {
+		t.Errorf("Unexpected status %v", status)
+	}
+
+	last = m.written[ref]
+	last.at = last.at.Add(-constPolicyStatusInterval)
+	m.written[ref] = last
+
+	m.SendMetrics(&tasks)
+	if len(patches) != 2 {
+		t.Errorf("Expected no update when the status hasn't changed")
+	}
+
+	// Errors are returned, and we try again after the interval
+	consumer.Running = 5
+	m.written[ref] = last
+	statusCode = http.StatusNotFound
+	err = m.SendMetrics(&tasks)
+	if err == nil || len(patches) != 3 {
+		t.Errorf("Expected an error updating the status")
+	}
+
+	statusCode = http.StatusOK
+	last = m.written[ref]
+	last.at = last.at.Add(-constPolicyStatusInterval)
+	m.written[ref] = last
+
+	err = m.SendMetrics(&tasks)
+	if err != nil || len(patches) != 4 {
+		t.Errorf("Expected the status update to be retried, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+// PrometheusMonitor serves metrics about tasks on /metrics in the Prometheus text exposition format
+type PrometheusMonitor struct {
+	address         string
+	tasks           []taskSample
+	schedulerErrors int
+	// Standbys don't scale tasks, so their demand and ideal containers aren't updated
+	standby bool
+	sync.RWMutex
+}
+
+// taskSample is a copy of the state of a task when metrics were last sent
+type taskSample struct {
+	name            string
+	demand          int
+	requested       int
+	running         int
+	healthy         int
+	idealContainers int
+	metric          int
+	target          int
+	hasTarget       bool
+	scaleUps        int
+	scaleDowns      int
+}
+
+// targetValue is implemented by targets that aim for a particular value of the metric
+type targetValue interface {
+	Value() int
+}
+
+// compile-time assert that we implement the right interfaces
+var _ Monitor = (*PrometheusMonitor)(nil)
+var _ LeaderReporter = (*PrometheusMonitor)(nil)
+
+// NewPrometheusMonitor returns a new monitor that serves metrics for Prometheus to scrape on the address
+func NewPrometheusMonitor(address string) *PrometheusMonitor {
+	m := &PrometheusMonitor{
+		address: address,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+
+	go func() {
+		err := http.ListenAndServe(address, mux)
+		if err != nil {
+			log.Errorf("Prometheus metrics server failed: %v", err)
+		}
+	}()
+
+	return m
+}
+
+// SendMetrics takes a copy of the current state of tasks, ready to be scraped
+func (m *PrometheusMonitor) SendMetrics(tasks *demand.Tasks) (err error) {
+	tasks.RLock()
+	samples := make([]taskSample, len(tasks.Tasks))
+	for i, t := range tasks.Tasks {
+		samples[i] = taskSample{
+			name:            t.Name,
+			demand:          t.Demand,
+			requested:       t.Requested,
+			running:         t.Running,
+			healthy:         t.Healthy,
+			idealContainers: t.IdealContainers,
+			scaleUps:        t.ScaleUps,
+			scaleDowns:      t.ScaleDowns,
+		}
+
+		if t.Metric != nil {
+			samples[i].metric = t.Metric.Current()
+		}
+
+		if tv, ok := t.Target.(targetValue); ok {
+			samples[i].target = tv.Value()
+			samples[i].hasTarget = true
+		}
+	}
+	schedulerErrors := tasks.SchedulerErrors
+	tasks.RUnlock()
+
+	m.Lock()
+	m.tasks = samples
+	m.schedulerErrors = schedulerErrors
+	m.Unlock()
+
+	return nil
+}
+
+// SetLeader records whether this agent is the leader
+func (m *PrometheusMonitor) SetLeader(leader bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.standby = !leader
+}
+
+// ServeHTTP writes out the metrics
+func (m *PrometheusMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var b bytes.Buffer
+
+	m.writeTaskMetric(&b, "microscaling_task_demand", "gauge", "Number of containers demanded for the task.",
+		func(s taskSample) (int, bool) { return s.demand, true })
+	m.writeTaskMetric(&b, "microscaling_task_requested", "gauge", "Number of containers requested from the scheduler for the task.",
+		func(s taskSample) (int, bool) { return s.requested, true })
+	m.writeTaskMetric(&b, "microscaling_task_running", "gauge", "Number of containers running for the task.",
+		func(s taskSample) (int, bool) { return s.running, true })
+	m.writeTaskMetric(&b, "microscaling_task_healthy", "gauge", "Number of running containers for the task that aren't failing their health check.",
+		func(s taskSample) (int, bool) { return s.healthy, true })
+	m.writeTaskMetric(&b, "microscaling_task_ideal_containers", "gauge", "Number of containers the task would ideally have if there were no other tasks.",
+		func(s taskSample) (int, bool) { return s.idealContainers, true })
+	m.writeTaskMetric(&b, "microscaling_task_metric", "gauge", "Current value of the metric used to scale the task.",
+		func(s taskSample) (int, bool) { return s.metric, true })
+	m.writeTaskMetric(&b, "microscaling_task_target", "gauge", "Target value of the metric used to scale the task.",
+		func(s taskSample) (int, bool) { return s.target, s.hasTarget })
+	m.writeTaskMetric(&b, "microscaling_task_scale_ups_total", "counter", "Number of times the task has been scaled up.",
+		func(s taskSample) (int, bool) { return s.scaleUps, true })
+	m.writeTaskMetric(&b, "microscaling_task_scale_downs_total", "counter", "Number of times the task has been scaled down.",
+		func(s taskSample) (int, bool) { return s.scaleDowns, true })
+
+	fmt.Fprintf(&b, "# HELP microscaling_scheduler_errors_total Number of errors returned by the scheduler.\n")
+	fmt.Fprintf(&b, "# TYPE microscaling_scheduler_errors_total counter\n")
+	fmt.Fprintf(&b, "microscaling_scheduler_errors_total %d\n", m.schedulerErrors)
+
+	leader := 1
+	if m.standby {
+		leader = 0
+	}
+	fmt.Fprintf(&b, "# HELP microscaling_leader Whether this agent is the leader. Standbys don't update demand or ideal containers.\n")
+	fmt.Fprintf(&b, "# TYPE microscaling_leader gauge\n")
+	fmt.Fprintf(&b, "microscaling_leader %d\n", leader)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
+
+func (m *PrometheusMonitor) writeTaskMetric(b *bytes.Buffer, name string, metricType string, help string, value func(taskSample) (int, bool)) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+
+	for _, s := range m.tasks {
+		if v, ok := value(s); ok {
+			fmt.Fprintf(b, "%s{task=\"%s\"} %d\n", name, escapeLabelValue(s.name), v)
+		}
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
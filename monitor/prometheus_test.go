@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/metric"
+	"github.com/microscaling/microscaling/target"
+)
+
+func TestPrometheusMonitor(t *testing.T) {
+	var tasks demand.Tasks
+
+	m := metric.NewToyMetric()
+	m.SettableCurrent = 42
+
+	tasks.Tasks = []*demand.Task{
+		&demand.Task{Name: "priority1", Demand: 8, Requested: 3, Running: 4, Healthy: 3, IdealContainers: 9, ScaleUps: 2,
+			Metric: m, Target: target.NewQueueLengthTarget(50)},
+		&demand.Task{Name: `odd"name`, Demand: 2, Requested: 7, Running: 5, ScaleDowns: 1,
+			Metric: metric.NewNullMetric(), Target: target.NewRemainderTarget(10)},
+	}
+	tasks.SchedulerErrors = 3
+
+	p := &PrometheusMonitor{}
+	err := p.SendMetrics(&tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	body := string(b)
+
+	expected := []string{
+		"# TYPE microscaling_task_demand gauge",
+		`microscaling_task_demand{task="priority1"} 8`,
+		`microscaling_task_requested{task="priority1"} 3`,
+		`microscaling_task_running{task="priority1"} 4`,
+		`microscaling_task_healthy{task="priority1"} 3`,
+		`microscaling_task_ideal_containers{task="priority1"} 9`,
+		`microscaling_task_metric{task="priority1"} 42`,
+		`microscaling_task_target{task="priority1"} 50`,
+		"# TYPE microscaling_task_scale_ups_total counter",
+		`microscaling_task_scale_ups_total{task="priority1"} 2`,
+		`microscaling_task_scale_downs_total{task="odd\"name"} 1`,
+		`microscaling_task_running{task="odd\"name"} 5`,
+		"microscaling_scheduler_errors_total 3",
+		"microscaling_leader 1",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected %s in metrics:\n%s", e, body)
+		}
+	}
+
+	// The remainder target doesn't have a target value
+	if strings.Contains(body, `microscaling_task_target{task="odd\"name"}`) {
+		t.Errorf("Didn't expect a target for the remainder task")
+	}
+
+	// Standbys report that they aren't the leader
+	p.SetLeader(false)
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, _ = ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(b), "microscaling_leader 0") {
+		t.Errorf("Expected a standby to report it isn't the leader:\n%s", string(b))
+	}
+}
@@ -0,0 +1,248 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+// Docker Hub images don't include a registry host, and their credentials are stored under its old index URL
+const (
+	dockerHubRegistry  = "docker.io"
+	dockerHubServerURL = "https://index.docker.io/v1/"
+)
+
+// Credential helpers exit with this message if they don't have credentials for the server, e.g. for public registries
+const credentialsNotFound = "credentials not found in native keychain"
+
+var errCredentialsNotFound = errors.New("Credentials not found")
+
+// registryAuth finds the credentials for pulling from a registry
+type registryAuth struct {
+	// From the Docker client's config.json, indexed by registry host
+	auths       map[string]docker.AuthConfiguration
+	credsStore  string
+	credHelpers map[string]string
+
+	// From MSS_REGISTRY_SERVER, MSS_REGISTRY_USERNAME and MSS_REGISTRY_PASSWORD
+	envServer string
+	envAuth   docker.AuthConfiguration
+}
+
+// dockerConfigFile is the part of the Docker client's config.json that has registry credentials
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// credentialHelperResponse is the output of docker-credential-<helper> get
+type credentialHelperResponse struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// newRegistryAuth reads credentials from the environment and the Docker client's config file, if there is one
+func newRegistryAuth() *registryAuth {
+	r := &registryAuth{
+		auths:     make(map[string]docker.AuthConfiguration),
+		envServer: registryHost(os.Getenv("MSS_REGISTRY_SERVER")),
+		envAuth: docker.AuthConfiguration{
+			Username: os.Getenv("MSS_REGISTRY_USERNAME"),
+			Password: os.Getenv("MSS_REGISTRY_PASSWORD"),
+		},
+	}
+
+	if r.envServer == "" {
+		r.envServer = dockerHubRegistry
+	}
+
+	path := dockerConfigPath()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Debugf("No Docker config file at %s", path)
+		return r
+	}
+
+	err = r.loadConfig(b)
+	if err != nil {
+		log.Errorf("Failed to read Docker config file %s: %v", path, err)
+	}
+
+	return r
+}
+
+func dockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".docker", "config.json")
+}
+
+func (r *registryAuth) loadConfig(b []byte) error {
+	var config dockerConfigFile
+	err := json.Unmarshal(b, &config)
+	if err != nil {
+		return err
+	}
+
+	for server, a := range config.Auths {
+		auth := docker.AuthConfiguration{
+			Username:      a.Username,
+			Password:      a.Password,
+			ServerAddress: server,
+		}
+
+		if a.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return fmt.Errorf("Bad auth for %s: %v", server, err)
+			}
+
+			userpass := strings.SplitN(string(decoded), ":", 2)
+			if len(userpass) != 2 {
+				return fmt.Errorf("Bad auth for %s", server)
+			}
+			auth.Username, auth.Password = userpass[0], userpass[1]
+		}
+
+		r.auths[registryHost(server)] = auth
+	}
+
+	r.credsStore = config.CredsStore
+	r.credHelpers = make(map[string]string, len(config.CredHelpers))
+	for server, helper := range config.CredHelpers {
+		r.credHelpers[registryHost(server)] = helper
+	}
+
+	return nil
+}
+
+// authFor finds the credentials for pulling an image. Credentials in the task's container config take precedence,
+// then the environment, then the Docker config file's credential helpers and auths. If there are none, or the
+// credential helper fails, we pull anonymously.
+func (r *registryAuth) authFor(image string, spec demand.ContainerSpec) docker.AuthConfiguration {
+	registry := imageRegistry(image)
+	serverAddress := registry
+	if registry == dockerHubRegistry {
+		serverAddress = dockerHubServerURL
+	}
+
+	if spec.RegistryUsername != "" {
+		return docker.AuthConfiguration{
+			Username:      spec.RegistryUsername,
+			Password:      spec.RegistryPassword,
+			ServerAddress: serverAddress,
+		}
+	}
+
+	if r.envAuth.Username != "" && r.envServer == registry {
+		auth := r.envAuth
+		auth.ServerAddress = serverAddress
+		return auth
+	}
+
+	helper, ok := r.credHelpers[registry]
+	if !ok {
+		helper = r.credsStore
+	}
+
+	if helper != "" {
+		auth, err := credentialHelperAuth(helper, serverAddress)
+		switch err {
+		case nil:
+			return auth
+		case errCredentialsNotFound:
+			log.Debugf("Credential helper %s has no credentials for %s", helper, serverAddress)
+		default:
+			log.Errorf("%v", err)
+		}
+	}
+
+	if auth, ok := r.auths[registry]; ok {
+		return auth
+	}
+
+	return docker.AuthConfiguration{}
+}
+
+// credentialHelperAuth gets credentials from a Docker credential helper, e.g. docker-credential-ecr-login
+func credentialHelperAuth(helper string, serverAddress string) (docker.AuthConfiguration, error) {
+	var out bytes.Buffer
+
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverAddress)
+	cmd.Stdout = &out
+
+	err := cmd.Run()
+	if err != nil && strings.Contains(out.String(), credentialsNotFound) {
+		return docker.AuthConfiguration{}, errCredentialsNotFound
+	}
+
+	if err != nil {
+		return docker.AuthConfiguration{}, fmt.Errorf("Credential helper %s failed for %s: %v", helper, serverAddress, err)
+	}
+
+	var resp credentialHelperResponse
+	err = json.Unmarshal(out.Bytes(), &resp)
+	if err != nil {
+		return docker.AuthConfiguration{}, fmt.Errorf("Bad response from credential helper %s: %v", helper, err)
+	}
+
+	return docker.AuthConfiguration{
+		Username:      resp.Username,
+		Password:      resp.Secret,
+		ServerAddress: serverAddress,
+	}, nil
+}
+
+// imageRegistry gets the registry host from an image name. The first part of the name is a registry if it looks like
+// a host name, otherwise the image is on Docker Hub.
+func imageRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return dockerHubRegistry
+	}
+
+	first := image[:i]
+	if !strings.ContainsAny(first, ".:") && first != "localhost" {
+		return dockerHubRegistry
+	}
+
+	return registryHost(first)
+}
+
+// registryHost normalizes the registry server names used in config files, which may be URLs
+func registryHost(server string) string {
+	host := server
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHubRegistry
+	}
+
+	return host
+}
@@ -0,0 +1,223 @@
+package docker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+const testDockerConfig = `{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "aHViOmh1YnBhc3M="},
+    "registry.example.com": {"auth": "ZXhhbXBsZTpleGFtcGxlcGFzcw=="},
+    "localhost:5000": {"username": "local", "password": "localpass"},
+    "public.example.com": {"auth": "cHVibGljOnB1YmxpY3Bhc3M="}
+  },
+  "credHelpers": {
+    "helped.example.com": "test",
+    "public.example.com": "nocreds",
+    "anonymous.example.com": "nocreds"
+  }
+}`
+
+func TestImageRegistry(t *testing.T) {
+	tests := []struct {
+		image    string
+		registry string
+	}{
+		{image: "nginx", registry: "docker.io"},
+		{image: "microscaling/priority-1:latest", registry: "docker.io"},
+		{image: "docker.io/library/nginx", registry: "docker.io"},
+		{image: "registry.example.com/team/app:1.0", registry: "registry.example.com"},
+		{image: "localhost:5000/app", registry: "localhost:5000"},
+		{image: "localhost/app", registry: "localhost"},
+	}
+
+	for _, test := range tests {
+		if r := imageRegistry(test.image); r != test.registry {
+			t.Errorf("Expected registry %s for %s, got %s", test.registry, test.image, r)
+		}
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microscaling")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A credential helper that returns fixed credentials for the server it's asked about
+	helper := "#!/bin/sh\nread server\necho '{\"ServerURL\":\"'$server'\",\"Username\":\"helper\",\"Secret\":\"helperpass\"}'\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(helper), 0755)
+	if err != nil {
+		t.Fatalf("Failed to write credential helper: %v", err)
+	}
+
+	// A credential helper that doesn't have credentials for any server, so we fall back to auths or pull anonymously
+	noCreds := "#!/bin/sh\necho '" + credentialsNotFound + "'\nexit 1\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "docker-credential-nocreds"), []byte(noCreds), 0755)
+	if err != nil {
+		t.Fatalf("Failed to write credential helper: %v", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(testDockerConfig), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	os.Setenv("DOCKER_CONFIG", dir)
+	os.Setenv("MSS_REGISTRY_SERVER", "https://env.example.com")
+	os.Setenv("MSS_REGISTRY_USERNAME", "env")
+	os.Setenv("MSS_REGISTRY_PASSWORD", "envpass")
+	defer func() {
+		os.Unsetenv("DOCKER_CONFIG")
+		os.Unsetenv("MSS_REGISTRY_SERVER")
+		os.Unsetenv("MSS_REGISTRY_USERNAME")
+		os.Unsetenv("MSS_REGISTRY_PASSWORD")
+	}()
+
+	r := newRegistryAuth()
+
+	tests := []struct {
+		image    string
+		spec     demand.ContainerSpec
+		username string
+		password string
+		server   string
+	}{
+		{image: "nginx", username: "hub", password: "hubpass", server: "https://index.docker.io/v1/"},
+		{image: "registry.example.com/app", username: "example", password: "examplepass", server: "registry.example.com"},
+		{image: "localhost:5000/app", username: "local", password: "localpass", server: "localhost:5000"},
+		{image: "env.example.com/app", username: "env", password: "envpass", server: "env.example.com"},
+		{image: "helped.example.com/app", username: "helper", password: "helperpass", server: "helped.example.com"},
+		{image: "public.example.com/app", username: "public", password: "publicpass", server: "public.example.com"},
+		{image: "anonymous.example.com/app"},
+		{image: "other.example.com/app"},
+		{
+			image:    "registry.example.com/app",
+			spec:     demand.ContainerSpec{RegistryUsername: "task", RegistryPassword: "taskpass"},
+			username: "task",
+			password: "taskpass",
+			server:   "registry.example.com",
+		},
+	}
+
+	for _, test := range tests {
+		auth := r.authFor(test.image, test.spec)
+		if auth.Username != test.username || auth.Password != test.password || auth.ServerAddress != test.server {
+			t.Errorf("Unexpected credentials for %s: %+v", test.image, auth)
+		}
+	}
+
+	// If a helper isn't installed we pull anonymously
+	r.credHelpers["missing.example.com"] = "missing"
+	if auth := r.authFor("missing.example.com/app", demand.ContainerSpec{}); auth.Username != "" {
+		t.Errorf("Expected no credentials for a missing credential helper, got %+v", auth)
+	}
+}
+
+func TestDockerPullRetries(t *testing.T) {
+	var pulls int
+	var pullsLock sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/create" {
+			w.Write([]byte("[]"))
+			return
+		}
+
+		if r.Header.Get("X-Registry-Auth") == "" {
+			t.Errorf("Expected registry credentials")
+		}
+
+		pullsLock.Lock()
+		defer pullsLock.Unlock()
+		pulls++
+		if pulls < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"registry unavailable"}`))
+		}
+	}))
+	defer server.Close()
+
+	d := NewScheduler(true, 0, false, server.URL, "agent")
+	defer d.Cleanup()
+	d.pullRetryDelay = time.Millisecond
+
+	task := &demand.Task{
+		Name:      "web",
+		Image:     "registry.example.com/web",
+		Container: demand.ContainerSpec{RegistryUsername: "task", RegistryPassword: "taskpass"},
+	}
+
+	err := d.InitScheduler(task)
+	if err != nil {
+		t.Errorf("Expected the pull to succeed after retrying: %v", err)
+	}
+
+	if pulls != 3 {
+		t.Errorf("Expected 3 pulls, got %d", pulls)
+	}
+
+	pullsLock.Lock()
+	pulls = -10
+	pullsLock.Unlock()
+
+	err = d.InitScheduler(task)
+	if err == nil {
+		t.Errorf("Expected an error when all the pulls fail")
+	}
+
+	if pulls != -10+constPullAttempts {
+		t.Errorf("Expected %d attempts, got %d", constPullAttempts, pulls+10)
+	}
+}
+
+func TestDockerRepull(t *testing.T) {
+	pulled := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/create" {
+			w.Write([]byte("[]"))
+			return
+		}
+
+		select {
+		case pulled <- r.URL.Query().Get("fromImage"):
+		default:
+		}
+	}))
+	defer server.Close()
+
+	d := NewScheduler(true, 10*time.Millisecond, false, server.URL, "agent")
+	defer d.Cleanup()
+
+	err := d.InitScheduler(&demand.Task{Name: "web", Image: "nginx:latest"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// The pull on startup, then at least one more
+	for i := 0; i < 2; i++ {
+		select {
+		case image := <-pulled:
+			if image != "nginx:latest" {
+				t.Errorf("Unexpected image pulled %s", image)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the image to be pulled again")
+		}
+	}
+}
@@ -3,8 +3,10 @@ package docker
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/op/go-logging"
@@ -15,24 +17,79 @@ import (
 
 const labelMap string = "com.microscaling.microscaling-in-a-box"
 
+// Failed pulls are retried, waiting twice as long each time
+const (
+	constPullAttempts   = 4
+	constPullRetryDelay = 1 * time.Second
+)
+
+// CPU limits are set as a quota of CPU time in each period, in microseconds
+const constCPUPeriod = 100000
+
+// We replace at most one unhealthy container for each task in this time, so a task whose containers always fail their
+// health check doesn't churn through new containers
+const constReplaceInterval = 30 * time.Second
+
+// labelAgent identifies the agent that started a container, so that agents sharing a Docker host leave each other's
+// containers alone
+const labelAgent string = "com.microscaling.agent-id"
+
 var log = logging.MustGetLogger("mssscheduler")
 
 type dockerContainer struct {
-	state   string
+	state string
+	// health is starting, healthy or unhealthy for containers with a health check, otherwise empty
+	health  string
+	created time.Time
 	updated bool
 }
 
+// isHealthy is false for containers failing their health check, and containers that Docker is restarting
+func (cc *dockerContainer) isHealthy() bool {
+	return cc.health != "unhealthy" && cc.state != "restarting"
+}
+
 // DockerScheduler stores information and state we need for communicating with Docker remote API
 // We keep track of each container so that we have their identities to stop them when we need to
 type DockerScheduler struct {
-	client         *docker.Client
-	pullImages     bool
-	taskContainers map[string]map[string]*dockerContainer // tasks indexed by app name, containers indexed by ID
+	client           *docker.Client
+	pullImages       bool
+	pullInterval     time.Duration
+	pullRetryDelay   time.Duration
+	auth             *registryAuth
+	agentID          string
+	replaceUnhealthy bool
+	replaceInterval  time.Duration
+	lastReplaced     map[string]time.Time                   // when we last replaced an unhealthy container, by task name
+	taskContainers   map[string]map[string]*dockerContainer // tasks indexed by app name, containers indexed by ID
 	sync.Mutex
+
+	// Closed when Cleanup is called, to stop our background goroutines
+	stop chan struct{}
+
+	// The images we pull again every pullInterval, indexed by task name
+	repulling  bool
+	taskImages map[string]taskImage
+
+	// Container states are kept up to date from the events stream, with a full resync when we
+	// (re)connect to the stream and every so often
+	watching     bool
+	streamID     int // 0 if we're not connected to the events stream
+	lastStreamID int
+	synced       bool
+	lastSync     time.Time
+}
+
+type taskImage struct {
+	image     string
+	container demand.ContainerSpec
 }
 
-// NewScheduler creates a new interface to the Docker remote API
-func NewScheduler(pullImages bool, dockerHost string) *DockerScheduler {
+// NewScheduler creates a new interface to the Docker remote API. The agent ID is added as a label to the containers
+// we start, and we only manage containers with our agent ID. If we're pulling images and the pull interval isn't 0,
+// we pull them again every interval so that tags such as :latest pick up updates. If replaceUnhealthy is set, containers
+// that fail their health check are replaced with new ones.
+func NewScheduler(pullImages bool, pullInterval time.Duration, replaceUnhealthy bool, dockerHost string, agentID string) *DockerScheduler {
 	client, err := docker.NewClient(dockerHost)
 	if err != nil {
 		log.Errorf("Error starting Docker client: %v", err)
@@ -40,49 +97,177 @@ func NewScheduler(pullImages bool, dockerHost string) *DockerScheduler {
 	}
 
 	return &DockerScheduler{
-		client:         client,
-		taskContainers: make(map[string]map[string]*dockerContainer),
-		pullImages:     pullImages,
+		client:           client,
+		taskContainers:   make(map[string]map[string]*dockerContainer),
+		pullImages:       pullImages,
+		pullInterval:     pullInterval,
+		pullRetryDelay:   constPullRetryDelay,
+		auth:             newRegistryAuth(),
+		agentID:          agentID,
+		replaceUnhealthy: replaceUnhealthy,
+		replaceInterval:  constReplaceInterval,
+		lastReplaced:     make(map[string]time.Time),
+		stop:             make(chan struct{}),
+		taskImages:       make(map[string]taskImage),
 	}
 }
 
-// compile-time assert that we implement the right interface
+// compile-time assert that we implement the right interfaces
 var _ scheduler.Scheduler = (*DockerScheduler)(nil)
+var _ scheduler.CapacityReporter = (*DockerScheduler)(nil)
 
 var scaling sync.WaitGroup
 
-// InitScheduler gets the images for each task
+// InitScheduler reconciles any containers left over from a previous run, and gets the images for each task
 func (c *DockerScheduler) InitScheduler(task *demand.Task) (err error) {
 	log.Infof("Docker initializing task %s", task.Name)
 
 	c.Lock()
-	defer c.Unlock()
+	if _, ok := c.taskContainers[task.Name]; !ok {
+		c.taskContainers[task.Name] = make(map[string]*dockerContainer, 100)
+	}
+
+	err = c.reconcileContainers(task.Name)
+	if err != nil {
+		c.Unlock()
+		return err
+	}
+
+	if !c.pullImages {
+		c.Unlock()
+		return nil
+	}
 
-	c.taskContainers[task.Name] = make(map[string]*dockerContainer, 100)
+	c.taskImages[task.Name] = taskImage{image: task.Image, container: task.Container}
+	if c.pullInterval > 0 && !c.repulling {
+		c.repulling = true
+		go c.repullImages()
+	}
+	c.Unlock()
 
 	// We may need to pull the image for this container
-	if c.pullImages {
-		pullOpts := docker.PullImageOptions{
-			Repository: task.Image,
+	return c.pullImage(task.Image, task.Container)
+}
+
+// pullImage pulls an image with the credentials for its registry, retrying with backoff if the pull fails
+func (c *DockerScheduler) pullImage(image string, spec demand.ContainerSpec) error {
+	authOpts := c.auth.authFor(image, spec)
+	pullOpts := docker.PullImageOptions{
+		Repository: image,
+	}
+
+	delay := c.pullRetryDelay
+	for attempt := 1; ; attempt++ {
+		log.Infof("Pulling image: %v", image)
+		err := c.client.PullImage(pullOpts, authOpts)
+		if err == nil {
+			return nil
 		}
 
-		authOpts := docker.AuthConfiguration{}
+		log.Errorf("Failed to pull image %s: %v", image, err)
+		if attempt == constPullAttempts {
+			return err
+		}
 
-		log.Infof("Pulling image: %v", task.Image)
-		err = c.client.PullImage(pullOpts, authOpts)
-		if err != nil {
-			log.Errorf("Failed to pull image %s: %v", task.Image, err)
+		select {
+		case <-c.stop:
+			return err
+		case <-time.After(delay):
 		}
+
+		delay *= 2
 	}
+}
 
-	return err
+// repullImages pulls the images for all our tasks every pull interval until Cleanup is called
+func (c *DockerScheduler) repullImages() {
+	ticker := time.NewTicker(c.pullInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		c.Lock()
+		images := make([]taskImage, 0, len(c.taskImages))
+		for _, ti := range c.taskImages {
+			images = append(images, ti)
+		}
+		c.Unlock()
+
+		for _, ti := range images {
+			c.pullImage(ti.image, ti.container)
+		}
+	}
 }
 
-// startTask creates the container and then starts it
-func (c *DockerScheduler) startTask(task *demand.Task) {
-	var labels = map[string]string{
-		labelMap: task.Name,
+// reconcileContainers adopts the running containers for this task that we started in a previous run, and removes
+// the ones that have exited, so they aren't orphaned. Call this with the scheduler locked.
+func (c *DockerScheduler) reconcileContainers(taskName string) error {
+	containers, err := c.client.ListContainers(docker.ListContainersOptions{
+		All: true,
+		Filters: map[string][]string{
+			"label": {labelMap + "=" + taskName},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list containers for task %s: %v", taskName, err)
+	}
+
+	for _, container := range containers {
+		id := container.ID[:12]
+		if !c.isOurs(container.Labels) {
+			log.Debugf("Ignoring container %s started by agent %s", id, container.Labels[labelAgent])
+			continue
+		}
+
+		if _, ok := c.taskContainers[taskName][id]; ok {
+			continue
+		}
+
+		switch state := statusToState(container.Status); state {
+		case "running", "restarting":
+			log.Infof("Adopting %s container %s for task %s", state, id, taskName)
+			c.taskContainers[taskName][id] = &dockerContainer{
+				state:   state,
+				health:  statusToHealth(container.Status),
+				created: time.Unix(container.Created, 0),
+			}
+		case "exited", "dead", "created":
+			log.Infof("Removing %s container %s for task %s", state, id, taskName)
+			err = c.client.RemoveContainer(docker.RemoveContainerOptions{
+				ID:            id,
+				RemoveVolumes: true,
+			})
+			if err != nil {
+				log.Errorf("Couldn't remove container %s: %v", id, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isOurs checks the agent ID label. Containers without one were started before we labelled them, so we manage them.
+func (c *DockerScheduler) isOurs(labels map[string]string) bool {
+	agentID, ok := labels[labelAgent]
+	return !ok || agentID == c.agentID
+}
+
+// createOptions builds the config for creating a container for this task
+func (c *DockerScheduler) createOptions(task *demand.Task) docker.CreateContainerOptions {
+	spec := task.Container
+
+	// Our labels take precedence, as we need them to keep track of the container
+	var labels = make(map[string]string, len(spec.Labels)+2)
+	for k, v := range spec.Labels {
+		labels[k] = v
 	}
+	labels[labelMap] = task.Name
+	labels[labelAgent] = c.agentID
 
 	var cmds = strings.Fields(task.Command)
 
@@ -94,13 +279,60 @@ func (c *DockerScheduler) startTask(task *demand.Task) {
 			AttachStdin:  true,
 			Labels:       labels,
 			Env:          task.Env,
+			User:         spec.User,
+			StopSignal:   spec.StopSignal,
 		},
 		HostConfig: &docker.HostConfig{
 			PublishAllPorts: task.PublishAllPorts,
 			NetworkMode:     task.NetworkMode,
+			Binds:           spec.Volumes,
+			RestartPolicy: docker.RestartPolicy{
+				Name:              spec.RestartPolicy,
+				MaximumRetryCount: spec.MaxRetries,
+			},
+			LogConfig: docker.LogConfig{
+				Type:   spec.LogDriver,
+				Config: spec.LogOptions,
+			},
+			Memory: spec.MemoryLimit * 1024 * 1024,
 		},
 	}
 
+	if spec.CPULimit > 0 {
+		createOpts.HostConfig.CPUPeriod = constCPUPeriod
+		createOpts.HostConfig.CPUQuota = int64(spec.CPULimit * constCPUPeriod)
+	}
+
+	if len(spec.Ports) > 0 {
+		createOpts.Config.ExposedPorts = make(map[docker.Port]struct{}, len(spec.Ports))
+		createOpts.HostConfig.PortBindings = make(map[docker.Port][]docker.PortBinding, len(spec.Ports))
+	}
+
+	for _, p := range spec.Ports {
+		port := docker.Port(fmt.Sprintf("%d/%s", p.ContainerPort, p.Protocol))
+		binding := docker.PortBinding{HostIP: p.HostIP}
+		if p.HostPort != 0 {
+			binding.HostPort = strconv.Itoa(p.HostPort)
+		}
+
+		createOpts.Config.ExposedPorts[port] = struct{}{}
+		createOpts.HostConfig.PortBindings[port] = append(createOpts.HostConfig.PortBindings[port], binding)
+	}
+
+	return createOpts
+}
+
+// startTask creates the container and then starts it
+func (c *DockerScheduler) startTask(task *demand.Task) {
+	createOpts := c.createOptions(task)
+
+	// The image may have changed when the config was reloaded
+	if c.pullImages {
+		c.Lock()
+		c.taskImages[task.Name] = taskImage{image: task.Image, container: task.Container}
+		c.Unlock()
+	}
+
 	go func() {
 		scaling.Add(1)
 		defer scaling.Done()
@@ -114,9 +346,13 @@ func (c *DockerScheduler) startTask(task *demand.Task) {
 
 		var containerID = container.ID[:12]
 
+		// We may already have heard about it from the events stream
 		c.Lock()
-		c.taskContainers[task.Name][containerID] = &dockerContainer{
-			state: "created",
+		if _, ok := c.taskContainers[task.Name][containerID]; !ok {
+			c.taskContainers[task.Name][containerID] = &dockerContainer{
+				state:   "created",
+				created: time.Now(),
+			}
 		}
 		c.Unlock()
 		log.Debugf("[created] task %s ID %s", task.Name, containerID)
@@ -131,50 +367,98 @@ func (c *DockerScheduler) startTask(task *demand.Task) {
 		log.Debugf("[starting] task %s ID %s", task.Name, containerID)
 
 		c.Lock()
-		c.taskContainers[task.Name][containerID].state = "starting"
+		if cc, ok := c.taskContainers[task.Name][containerID]; ok && cc.state == "created" {
+			cc.state = "starting"
+		}
 		c.Unlock()
 	}()
 }
 
-// stopTask kills the last container we know about of this type
+// stopTask kills a running container of this type. We choose an unhealthy or restarting one if there is one, otherwise
+// the newest, as it's had the least time to pick up work.
 func (c *DockerScheduler) stopTask(task *demand.Task) error {
-	var err error
-
 	// Kill a currently-running container of this type
 	c.Lock()
 	theseContainers := c.taskContainers[task.Name]
 	var containerToKill string
 	for id, v := range theseContainers {
-		if v.state == "running" {
+		if v.state != "running" && v.state != "restarting" {
+			continue
+		}
+
+		if containerToKill == "" || betterToStop(v, theseContainers[containerToKill]) {
 			containerToKill = id
-			v.state = "stopping"
-			break
 		}
 	}
+
+	if containerToKill != "" {
+		theseContainers[containerToKill].state = "stopping"
+	}
 	c.Unlock()
 
 	if containerToKill == "" {
 		return fmt.Errorf("[stop] No containers of type %s to kill", task.Name)
 	}
 
+	c.stopContainer(task, containerToKill)
+	return nil
+}
+
+// betterToStop compares two running containers
+func betterToStop(a *dockerContainer, b *dockerContainer) bool {
+	if a.isHealthy() != b.isHealthy() {
+		return !a.isHealthy()
+	}
+
+	return a.created.After(b.created)
+}
+
+// stopContainer runs any pre-stop hooks, then stops and removes a container that we've already marked as stopping
+func (c *DockerScheduler) stopContainer(task *demand.Task, containerToKill string) {
 	removeOpts := docker.RemoveContainerOptions{
 		ID:            containerToKill,
 		RemoveVolumes: true,
 	}
 
+	// The task's config could be reloaded while we're stopping the container
+	spec := task.Container
+
 	go func() {
 		scaling.Add(1)
 		defer scaling.Done()
 
+		// The hooks have to leave the container some time to exit after the stop signal
+		deadline := time.Now().Add(stopTimeout(spec))
+		c.runPreStopHooks(containerToKill, spec, deadline.Add(-constMinStopGrace))
+
 		log.Debugf("[stopping] container for task %s with ID %s", task.Name, containerToKill)
-		err = c.client.StopContainer(containerToKill, 1)
-		if err != nil {
+		err := c.client.StopContainer(containerToKill, stopGrace(deadline))
+		switch err.(type) {
+		case nil:
+		case *docker.ContainerNotRunning:
+			log.Debugf("Container %s had already stopped", containerToKill)
+		case *docker.NoSuchContainer:
+			log.Debugf("Container %s has already been removed", containerToKill)
+			c.Lock()
+			delete(c.taskContainers[task.Name], containerToKill)
+			c.Unlock()
+			return
+		default:
 			log.Errorf("Couldn't stop container %s: %v", containerToKill, err)
+
+			// It's still running as far as we know, so we can try stopping it again
+			c.Lock()
+			if cc, ok := c.taskContainers[task.Name][containerToKill]; ok && cc.state == "stopping" {
+				cc.state = "running"
+			}
+			c.Unlock()
 			return
 		}
 
 		c.Lock()
-		c.taskContainers[task.Name][containerToKill].state = "removing"
+		if cc, ok := c.taskContainers[task.Name][containerToKill]; ok {
+			cc.state = "removing"
+		}
 		c.Unlock()
 
 		log.Debugf("[removing] container for task %s with ID %s", task.Name, containerToKill)
@@ -184,8 +468,6 @@ func (c *DockerScheduler) stopTask(task *demand.Task) error {
 			return
 		}
 	}()
-
-	return nil
 }
 
 // StopStartTasks creates containers if there aren't enough of them, and stop them if there are too many
@@ -196,7 +478,6 @@ func (c *DockerScheduler) StopStartTasks(tasks *demand.Tasks) error {
 	var err error
 
 	tasks.Lock()
-	defer tasks.Unlock()
 
 	// TODO: Consider checking the number running before we start & stop
 	// Don't do more scaling if this task is already changin
@@ -235,6 +516,9 @@ func (c *DockerScheduler) StopStartTasks(tasks *demand.Tasks) error {
 		}
 	}
 
+	// Containers can take a while to drain, so we don't hold the lock while they stop
+	tasks.Unlock()
+
 	// Don't return until all the scale tasks are complete
 	scaling.Wait()
 	return err
@@ -244,6 +528,9 @@ func statusToState(status string) string {
 	if strings.Contains(status, "Up") {
 		return "running"
 	}
+	if strings.Contains(status, "Restarting") {
+		return "restarting"
+	}
 	if strings.Contains(status, "Removal") {
 		return "removing"
 	}
@@ -253,12 +540,121 @@ func statusToState(status string) string {
 	if strings.Contains(status, "Dead") {
 		return "dead"
 	}
+	if strings.Contains(status, "Created") {
+		return "created"
+	}
 	log.Errorf("Unexpected docker status %s", status)
 	return "unknown"
 }
 
-// CountAllTasks checks how many of each task are running
+// statusToHealth reads the health check result from a status such as "Up 5 minutes (unhealthy)"
+func statusToHealth(status string) string {
+	if strings.Contains(status, "(health: starting)") {
+		return "starting"
+	}
+	if strings.Contains(status, "(unhealthy)") {
+		return "unhealthy"
+	}
+	if strings.Contains(status, "(healthy)") {
+		return "healthy"
+	}
+	return ""
+}
+
+// CountAllTasks checks how many of each task are running. Usually we can tell from the events stream, but we list
+// all the containers if we've not been connected to it for long enough.
 func (c *DockerScheduler) CountAllTasks(running *demand.Tasks) error {
+	c.Lock()
+	if !c.watching {
+		c.watching = true
+		go c.watchEvents()
+	}
+	needResync := !c.synced || time.Since(c.lastSync) > constResyncInterval
+	streamID := c.streamID
+	c.Unlock()
+
+	if needResync {
+		err := c.resyncContainers(running)
+		if err != nil {
+			return err
+		}
+
+		// We can rely on events from here on, as long as the stream was already connected before we listed containers
+		c.Lock()
+		c.synced = streamID != 0 && streamID == c.streamID
+		c.lastSync = time.Now()
+		c.Unlock()
+	} else {
+		c.countContainers(running)
+	}
+
+	if c.replaceUnhealthy {
+		c.replaceUnhealthyContainers(running)
+	}
+
+	return nil
+}
+
+// countContainers updates the running and healthy counts from the container states we already know about
+func (c *DockerScheduler) countContainers(running *demand.Tasks) {
+	running.Lock()
+	defer running.Unlock()
+	c.Lock()
+	defer c.Unlock()
+
+	// Containers we're stopping are still running until we get their die event. Containers that Docker is restarting
+	// take up a slot, but aren't healthy.
+	for _, t := range running.Tasks {
+		t.Running = 0
+		t.Healthy = 0
+		for _, cc := range c.taskContainers[t.Name] {
+			switch cc.state {
+			case "running", "stopping", "restarting":
+				t.Running++
+				if cc.isHealthy() {
+					t.Healthy++
+				}
+			}
+		}
+	}
+}
+
+// replaceUnhealthyContainers stops a container that's failing its health check and starts a new one in its place. We
+// leave tasks alone while they're scaling, and replace at most one container for each task every replace interval.
+func (c *DockerScheduler) replaceUnhealthyContainers(running *demand.Tasks) {
+	running.Lock()
+	defer running.Unlock()
+
+	now := time.Now()
+	for _, t := range running.Tasks {
+		if t.Running != t.Requested {
+			continue
+		}
+
+		var unhealthy string
+		c.Lock()
+		if now.Sub(c.lastReplaced[t.Name]) >= c.replaceInterval {
+			for id, cc := range c.taskContainers[t.Name] {
+				if cc.state == "running" && cc.health == "unhealthy" {
+					cc.state = "stopping"
+					unhealthy = id
+					c.lastReplaced[t.Name] = now
+					break
+				}
+			}
+		}
+		c.Unlock()
+
+		if unhealthy != "" {
+			log.Infof("Replacing unhealthy container %s for task %s", unhealthy, t.Name)
+			c.stopContainer(t, unhealthy)
+			c.startTask(t)
+		}
+	}
+}
+
+// resyncContainers lists all the containers to update their states
+func (c *DockerScheduler) resyncContainers(running *demand.Tasks) error {
 	// Docker Remote API https://docs.docker.com/reference/api/docker_remote_api_v1.20/
 	// get /containers/json
 	var err error
@@ -277,6 +673,7 @@ func (c *DockerScheduler) CountAllTasks(running *demand.Tasks) error {
 	tasks := running.Tasks
 	for _, t := range tasks {
 		t.Running = 0
+		t.Healthy = 0
 
 		for _, cc := range c.taskContainers[t.Name] {
 			cc.updated = false
@@ -289,7 +686,7 @@ func (c *DockerScheduler) CountAllTasks(running *demand.Tasks) error {
 	for i := range containers {
 		labels := containers[i].Labels
 		taskName, present = labels[labelMap]
-		if present {
+		if present && c.isOurs(labels) {
 			// Only update tasks that are already in our task map - don't try to manage anything else
 			// log.Debugf("Found a container with labels %v", labels)
 			t, err := running.GetTask(taskName)
@@ -301,15 +698,25 @@ func (c *DockerScheduler) CountAllTasks(running *demand.Tasks) error {
 				thisContainer, ok := c.taskContainers[taskName][id]
 				if !ok {
 					log.Infof("We have no previous record of container %s, state %s", id, newState)
-					thisContainer = &dockerContainer{}
+					thisContainer = &dockerContainer{created: time.Unix(containers[i].Created, 0)}
 					c.taskContainers[taskName][id] = thisContainer
 				}
 
 				switch newState {
 				case "running":
 					t.Running++
+					thisContainer.health = statusToHealth(containers[i].Status)
+					if thisContainer.health != "unhealthy" {
+						t.Healthy++
+					}
 					// We could be moving from starting to running, or it could be a container that's totally new to us
-					if thisContainer.state == "starting" || thisContainer.state == "" {
+					if thisContainer.state == "starting" || thisContainer.state == "restarting" || thisContainer.state == "" {
+						thisContainer.state = newState
+					}
+				case "restarting":
+					// Docker's restart policy is restarting a container that keeps exiting
+					t.Running++
+					if thisContainer.state != "stopping" {
 						thisContainer.state = newState
 					}
 				case "removing":
@@ -333,16 +740,17 @@ func (c *DockerScheduler) CountAllTasks(running *demand.Tasks) error {
 	}
 
 	for _, task := range tasks {
-		log.Debugf("  %s: internally running %d, requested %d", task.Name, task.Running, task.Requested)
+		log.Debugf("  %s: internally running %d, healthy %d, requested %d", task.Name, task.Running, task.Healthy, task.Requested)
 		for id, cc := range c.taskContainers[task.Name] {
-			log.Debugf("  %s - %s", id, cc.state)
-			if !cc.updated {
-				if cc.state == "removing" || cc.state == "exited" {
-					log.Debugf("    Deleting %s", id)
-					delete(c.taskContainers[task.Name], id)
-				} else if cc.state != "created" && cc.state != "starting" && cc.state != "stopping" {
-					log.Errorf("Bad state for container %s: %s", id, cc.state)
+			log.Debugf("  %s - %s %s", id, cc.state, cc.health)
+			// The list is authoritative. Only containers we're still creating or starting may be missing from it, and
+			// the others have exited or been removed even if we missed their die event.
+			if !cc.updated && cc.state != "created" && cc.state != "starting" {
+				if cc.state == "running" || cc.state == "restarting" {
+					log.Infof("Container %s is no longer running", id)
 				}
+				log.Debugf("    Deleting %s", id)
+				delete(c.taskContainers[task.Name], id)
 			}
 		}
 	}
@@ -350,7 +758,29 @@ func (c *DockerScheduler) CountAllTasks(running *demand.Tasks) error {
 	return err
 }
 
+// GetCapacity reads the CPUs and memory available on the Docker host
+func (c *DockerScheduler) GetCapacity() (demand.Resources, error) {
+	info, err := c.client.Info()
+	if err != nil {
+		return demand.Resources{}, fmt.Errorf("Failed to get Docker info: %v", err)
+	}
+
+	return demand.Resources{
+		CPU:    float64(info.NCPU),
+		Memory: info.MemTotal / (1024 * 1024),
+	}, nil
+}
+
 // Cleanup gives the scheduler an opportunity to stop anything that needs to be stopped
 func (c *DockerScheduler) Cleanup() error {
+	c.Lock()
+	defer c.Unlock()
+
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+
 	return nil
 }
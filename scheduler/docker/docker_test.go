@@ -1,9 +1,14 @@
 package docker
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/microscaling/microscaling/demand"
@@ -22,7 +27,7 @@ func TestDockerInitScheduler(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		d := NewScheduler(test.pullImages, "unix:///var/run/docker.sock")
+		d := NewScheduler(test.pullImages, 0, false, "unix:///var/run/docker.sock", "agent")
 		log.Infof("Should I pull images? %v", test.pullImages)
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log.Infof("Received something %v", r)
@@ -44,7 +49,7 @@ func TestDockerInitScheduler(t *testing.T) {
 }
 
 func TestDockerScheduler(t *testing.T) {
-	d := NewScheduler(true, "unix:///var/run/docker.sock")
+	d := NewScheduler(true, 0, false, "unix:///var/run/docker.sock", "agent")
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	}))
 
@@ -64,3 +69,659 @@ func TestDockerScheduler(t *testing.T) {
 	tasks.Tasks = append(tasks.Tasks, &task)
 	d.CountAllTasks(&tasks)
 }
+
+func TestDockerReconcile(t *testing.T) {
+	var removed []string
+	var removedLock sync.Mutex
+
+	containers := []docker.APIContainers{
+		{ID: "aaaaaaaaaaaa1", Status: "Up 2 hours", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+		{ID: "bbbbbbbbbbbb1", Status: "Exited (0) 1 hour ago", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+		{ID: "cccccccccccc1", Status: "Created", Labels: map[string]string{labelMap: "web"}},
+		{ID: "dddddddddddd1", Status: "Up 1 hour", Labels: map[string]string{labelMap: "web"}},
+		{ID: "eeeeeeeeeeee1", Status: "Up 1 hour", Labels: map[string]string{labelMap: "web", labelAgent: "other"}},
+		{ID: "ffffffffffff1", Status: "Exited (1) 1 hour ago", Labels: map[string]string{labelMap: "web", labelAgent: "other"}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/containers/json":
+			// Reconciliation includes stopped containers
+			if r.URL.Query().Get("all") == "1" {
+				var filters map[string][]string
+				json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+				if len(filters["label"]) != 1 || filters["label"][0] != labelMap+"=web" {
+					t.Errorf("Unexpected container list query %v", r.URL.Query())
+				}
+			}
+
+			json.NewEncoder(w).Encode(containers)
+		case r.Method == "GET" && r.URL.Path == "/events":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/containers/"):
+			removedLock.Lock()
+			removed = append(removed, strings.TrimPrefix(r.URL.Path, "/containers/"))
+			removedLock.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	d := NewScheduler(false, 0, false, server.URL, "agent")
+	defer d.Cleanup()
+
+	task := &demand.Task{Name: "web"}
+	err := d.InitScheduler(task)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(d.taskContainers["web"]) != 2 {
+		t.Errorf("Expected to adopt 2 containers, have %v", d.taskContainers["web"])
+	}
+
+	for _, id := range []string{"aaaaaaaaaaaa", "dddddddddddd"} {
+		if c, ok := d.taskContainers["web"][id]; !ok || c.state != "running" {
+			t.Errorf("Expected to adopt running container %s", id)
+		}
+	}
+
+	if len(removed) != 2 || removed[0] != "bbbbbbbbbbbb" || removed[1] != "cccccccccccc" {
+		t.Errorf("Expected to remove our exited and created containers, removed %v", removed)
+	}
+
+	// Reinitializing doesn't forget the containers we know about
+	d.taskContainers["web"]["aaaaaaaaaaaa"].state = "stopping"
+	d.InitScheduler(task)
+	if d.taskContainers["web"]["aaaaaaaaaaaa"].state != "stopping" {
+		t.Errorf("Expected container state to be kept")
+	}
+
+	// Containers started by other agents aren't counted
+	tasks := &demand.Tasks{Tasks: []*demand.Task{task}}
+	containers = containers[3:5]
+	d.CountAllTasks(tasks)
+	if task.Running != 1 {
+		t.Errorf("Expected 1 running, got %d", task.Running)
+	}
+
+	// The container we were stopping is no longer listed, so it has exited
+	if _, ok := d.taskContainers["web"]["aaaaaaaaaaaa"]; ok {
+		t.Errorf("Expected to forget the stopped container")
+	}
+
+	// Running containers that are no longer listed have gone too, but ones we're still starting haven't
+	d.taskContainers["web"]["gggggggggggg"] = &dockerContainer{state: "starting", created: time.Now()}
+	containers = nil
+	d.CountAllTasks(tasks)
+	if _, ok := d.taskContainers["web"]["dddddddddddd"]; ok {
+		t.Errorf("Expected to forget the container that's no longer running")
+	}
+
+	if _, ok := d.taskContainers["web"]["gggggggggggg"]; !ok {
+		t.Errorf("Expected to keep the container we're starting")
+	}
+
+	d.countContainers(tasks)
+	if task.Running != 0 {
+		t.Errorf("Expected 0 running, got %d", task.Running)
+	}
+}
+
+func containerEvent(action string, id string, agentID string) *docker.APIEvents {
+	return &docker.APIEvents{
+		Action: action,
+		Type:   "container",
+		Actor: docker.APIActor{
+			ID:         id,
+			Attributes: map[string]string{labelMap: "web", labelAgent: agentID},
+		},
+		Time: time.Now().Unix(),
+	}
+}
+
+func TestDockerEvents(t *testing.T) {
+	var listCalls int
+	var listLock sync.Mutex
+	events := make(chan *docker.APIEvents)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			listLock.Lock()
+			listCalls++
+			listLock.Unlock()
+
+			json.NewEncoder(w).Encode([]docker.APIContainers{
+				{ID: "aaaaaaaaaaaa1", Status: "Up 2 hours", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+			})
+		case "/events":
+			var filters map[string][]string
+			json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+			if len(filters["label"]) != 1 || filters["label"][0] != labelMap {
+				t.Errorf("Expected events to be filtered by label, got %v", filters)
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for event := range events {
+				json.NewEncoder(w).Encode(event)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer server.Close()
+
+	d := NewScheduler(false, 0, false, server.URL, "agent")
+	defer d.Cleanup()
+
+	task := &demand.Task{Name: "web"}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{task}}
+	d.InitScheduler(task)
+	d.CountAllTasks(tasks)
+
+	connected := func() bool {
+		d.Lock()
+		defer d.Unlock()
+		return d.streamID != 0
+	}
+
+	for i := 0; i < 50 && !connected(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if !connected() {
+		t.Fatalf("Expected to connect to the events stream")
+	}
+
+	// Resync now that we're getting events
+	d.CountAllTasks(tasks)
+	listLock.Lock()
+	calls := listCalls
+	listLock.Unlock()
+
+	countUntil := func(expected int) {
+		for i := 0; i < 50; i++ {
+			d.CountAllTasks(tasks)
+			if task.Running == expected {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Errorf("Expected %d running, got %d", expected, task.Running)
+	}
+
+	events <- containerEvent("create", "bbbbbbbbbbbb1", "agent")
+	events <- containerEvent("start", "bbbbbbbbbbbb1", "agent")
+	events <- containerEvent("start", "cccccccccccc1", "other")
+	countUntil(2)
+
+	events <- containerEvent("die", "aaaaaaaaaaaa1", "agent")
+	countUntil(1)
+
+	// Events arrive in order, so once we've seen the last one we've handled the others
+	events <- containerEvent("destroy", "aaaaaaaaaaaa1", "agent")
+	events <- containerEvent("die", "dddddddddddd1", "agent")
+	events <- containerEvent("start", "eeeeeeeeeeee1", "agent")
+	countUntil(2)
+
+	d.Lock()
+	if _, ok := d.taskContainers["web"]["aaaaaaaaaaaa"]; ok || len(d.taskContainers["web"]) != 2 {
+		t.Errorf("Expected only containers b and e, have %v", d.taskContainers["web"])
+	}
+	d.Unlock()
+
+	// Containers we're stopping stop counting once they've exited
+	d.Lock()
+	d.taskContainers["web"]["bbbbbbbbbbbb"].state = "stopping"
+	d.Unlock()
+	events <- containerEvent("die", "bbbbbbbbbbbb1", "agent")
+	countUntil(1)
+
+	listLock.Lock()
+	if listCalls != calls {
+		t.Errorf("Expected counts to come from events, but listed containers %d times", listCalls-calls)
+	}
+	listLock.Unlock()
+
+	// We resync when the stream drops
+	close(events)
+	for i := 0; i < 50 && connected(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	d.CountAllTasks(tasks)
+	listLock.Lock()
+	if listCalls != calls+1 {
+		t.Errorf("Expected to list containers after the stream dropped")
+	}
+	listLock.Unlock()
+}
+
+func TestDockerCreateOptions(t *testing.T) {
+	d := NewScheduler(false, 0, false, "unix:///var/run/docker.sock", "agent")
+
+	task := &demand.Task{
+		Name:  "web",
+		Image: "nginx",
+		Container: demand.ContainerSpec{
+			MemoryLimit: 128,
+			CPULimit:    0.5,
+			Ports: []demand.PortBinding{
+				{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+				{HostIP: "127.0.0.1", ContainerPort: 53, Protocol: "udp"},
+			},
+			Volumes:       []string{"/data:/data:ro", "cache:/cache"},
+			Labels:        map[string]string{"team": "web", labelMap: "other"},
+			User:          "nobody",
+			LogDriver:     "json-file",
+			LogOptions:    map[string]string{"max-size": "10m"},
+			RestartPolicy: "on-failure",
+			MaxRetries:    3,
+		},
+	}
+
+	opts := d.createOptions(task)
+	config := opts.Config
+	host := opts.HostConfig
+
+	if config.Labels["team"] != "web" || config.Labels[labelMap] != "web" || config.Labels[labelAgent] != "agent" {
+		t.Errorf("Unexpected labels %v", config.Labels)
+	}
+
+	if config.User != "nobody" {
+		t.Errorf("Expected user nobody, got %s", config.User)
+	}
+
+	if host.Memory != 128*1024*1024 || host.CPUQuota != 50000 || host.CPUPeriod != 100000 {
+		t.Errorf("Unexpected limits memory %d, CPU quota %d period %d", host.Memory, host.CPUQuota, host.CPUPeriod)
+	}
+
+	if _, ok := config.ExposedPorts["80/tcp"]; !ok || len(config.ExposedPorts) != 2 {
+		t.Errorf("Unexpected exposed ports %v", config.ExposedPorts)
+	}
+
+	if b := host.PortBindings["80/tcp"]; len(b) != 1 || b[0].HostPort != "8080" || b[0].HostIP != "" {
+		t.Errorf("Unexpected binding for 80/tcp %v", b)
+	}
+
+	if b := host.PortBindings["53/udp"]; len(b) != 1 || b[0].HostPort != "" || b[0].HostIP != "127.0.0.1" {
+		t.Errorf("Unexpected binding for 53/udp %v", b)
+	}
+
+	if len(host.Binds) != 2 || host.LogConfig.Type != "json-file" || host.LogConfig.Config["max-size"] != "10m" {
+		t.Errorf("Unexpected volumes or logging %v %v", host.Binds, host.LogConfig)
+	}
+
+	if host.RestartPolicy.Name != "on-failure" || host.RestartPolicy.MaximumRetryCount != 3 {
+		t.Errorf("Unexpected restart policy %v", host.RestartPolicy)
+	}
+
+	// Without a spec there are no limits
+	opts = d.createOptions(&demand.Task{Name: "plain"})
+	if opts.HostConfig.Memory != 0 || opts.HostConfig.CPUQuota != 0 || opts.HostConfig.PortBindings != nil {
+		t.Errorf("Expected no limits or port bindings")
+	}
+}
+
+func TestDockerHealth(t *testing.T) {
+	var requests []string
+	var requestsLock sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/containers/json":
+			json.NewEncoder(w).Encode([]docker.APIContainers{
+				{ID: "aaaaaaaaaaaa1", Status: "Up 1 hour (healthy)", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+				{ID: "bbbbbbbbbbbb1", Status: "Up 1 minute (health: starting)", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+				{ID: "cccccccccccc1", Status: "Up 2 hours (unhealthy)", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+				{ID: "dddddddddddd1", Status: "Up 3 hours", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+			})
+		case r.Method == "GET" && r.URL.Path == "/events":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "POST" && r.URL.Path == "/containers/create":
+			requestsLock.Lock()
+			requests = append(requests, "create")
+			requestsLock.Unlock()
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"eeeeeeeeeeee1"}`))
+		default:
+			requestsLock.Lock()
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			requestsLock.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	d := NewScheduler(false, 0, true, server.URL, "agent")
+	defer d.Cleanup()
+
+	task := &demand.Task{Name: "web", Image: "nginx", Requested: 5}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{task}}
+	d.InitScheduler(task)
+
+	// Containers that are still starting count as healthy
+	d.CountAllTasks(tasks)
+	if task.Running != 4 || task.Healthy != 3 {
+		t.Errorf("Expected 4 running and 3 healthy, got %d and %d", task.Running, task.Healthy)
+	}
+
+	// We don't replace containers while the task is scaling
+	d.Lock()
+	if d.taskContainers["web"]["cccccccccccc"].state != "running" {
+		t.Errorf("Expected the unhealthy container not to be replaced while scaling")
+	}
+	d.Unlock()
+
+	task.Requested = 4
+	d.CountAllTasks(tasks)
+
+	expected := []string{"POST /containers/cccccccccccc/stop", "DELETE /containers/cccccccccccc", "create", "POST /containers/eeeeeeeeeeee/start"}
+	for i := 0; i < 50; i++ {
+		requestsLock.Lock()
+		n := len(requests)
+		requestsLock.Unlock()
+		if n >= len(expected) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	requestsLock.Lock()
+	for _, e := range expected {
+		found := false
+		for _, r := range requests {
+			if r == e {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected request %s replacing the unhealthy container, got %v", e, requests)
+		}
+	}
+	requestsLock.Unlock()
+
+	// Health check results also come from events
+	d.handleEvent(containerEvent("health_status: unhealthy", "aaaaaaaaaaaa1", "agent"))
+	d.Lock()
+	if d.taskContainers["web"]["aaaaaaaaaaaa"].health != "unhealthy" {
+		t.Errorf("Expected container to be unhealthy after health_status event")
+	}
+	d.Unlock()
+
+	// We don't replace another container for this task until the replace interval has passed
+	task.Running = 4
+	task.Requested = 4
+	d.replaceUnhealthyContainers(tasks)
+	d.Lock()
+	if d.taskContainers["web"]["aaaaaaaaaaaa"].state != "running" {
+		t.Errorf("Expected the unhealthy container not to be replaced within the replace interval")
+	}
+	d.replaceInterval = 0
+	d.Unlock()
+
+	d.replaceUnhealthyContainers(tasks)
+	d.Lock()
+	if d.taskContainers["web"]["aaaaaaaaaaaa"].state != "stopping" {
+		t.Errorf("Expected the unhealthy container to be replaced after the replace interval")
+	}
+	d.Unlock()
+}
+
+func TestDockerRestarting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			json.NewEncoder(w).Encode([]docker.APIContainers{
+				{ID: "aaaaaaaaaaaa1", Status: "Up 1 hour", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+				{ID: "bbbbbbbbbbbb1", Status: "Restarting (1) 5 seconds ago", Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d := NewScheduler(false, 0, false, server.URL, "agent")
+	defer d.Cleanup()
+
+	task := &demand.Task{Name: "web", Requested: 2}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{task}}
+	d.InitScheduler(task)
+
+	// Restarting containers take up a slot but aren't healthy
+	d.CountAllTasks(tasks)
+	if task.Running != 2 || task.Healthy != 1 {
+		t.Errorf("Expected 2 running and 1 healthy, got %d and %d", task.Running, task.Healthy)
+	}
+
+	d.countContainers(tasks)
+	if task.Running != 2 || task.Healthy != 1 {
+		t.Errorf("Expected the same counts from container states, got %d running and %d healthy", task.Running, task.Healthy)
+	}
+
+	// They're stopped before healthy containers, even newer ones
+	d.Lock()
+	restarting := d.taskContainers["web"]["bbbbbbbbbbbb"]
+	if !betterToStop(restarting, &dockerContainer{state: "running", created: time.Now()}) {
+		t.Errorf("Expected to stop the restarting container first")
+	}
+	d.Unlock()
+
+	d.handleEvent(containerEvent("start", "bbbbbbbbbbbb1", "agent"))
+	d.Lock()
+	if d.taskContainers["web"]["bbbbbbbbbbbb"].state != "running" {
+		t.Errorf("Expected a restarted container to be running")
+	}
+	d.Unlock()
+}
+
+func TestDockerStopTask(t *testing.T) {
+	var requests []string
+	var requestsLock sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsLock.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		requestsLock.Unlock()
+
+		switch {
+		case r.URL.Path == "/containers/json":
+			json.NewEncoder(w).Encode([]docker.APIContainers{
+				{ID: "aaaaaaaaaaaa1", Status: "Up 2 hours", Created: 1000, Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+				{ID: "bbbbbbbbbbbb1", Status: "Up 1 hour", Created: 2000, Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+				{ID: "cccccccccccc1", Status: "Up 90 minutes", Created: 1500, Labels: map[string]string{labelMap: "web", labelAgent: "agent"}},
+			})
+		case r.URL.Path == "/events":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/json") && strings.HasPrefix(r.URL.Path, "/containers/"):
+			w.Write([]byte(`{"Id":"bbbbbbbbbbbb1","NetworkSettings":{"IPAddress":"127.0.0.1"}}`))
+		case r.URL.Path == "/containers/bbbbbbbbbbbb/exec":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"exec1"}`))
+		case r.URL.Path == "/exec/exec1/json":
+			w.Write([]byte(`{"Running":false,"ExitCode":0}`))
+		case strings.HasSuffix(r.URL.Path, "/stop"):
+			if timeout, _ := strconv.Atoi(r.URL.Query().Get("t")); timeout < 3 || timeout > 5 {
+				t.Errorf("Expected a stop timeout of up to 5 seconds, got %s", r.URL.Query().Get("t"))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	port, _ := strconv.Atoi(server.URL[strings.LastIndex(server.URL, ":")+1:])
+
+	d := NewScheduler(false, 0, false, server.URL, "agent")
+	defer d.Cleanup()
+
+	task := &demand.Task{
+		Name: "web",
+		Container: demand.ContainerSpec{
+			StopTimeout: 5,
+			PreStopHTTP: &demand.HTTPHook{Port: port, Path: "/drain"},
+			PreStopExec: "drain --wait",
+		},
+	}
+	d.InitScheduler(task)
+
+	// The newest container is stopped first, after its pre-stop hooks
+	err := d.stopTask(task)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []string{
+		"GET /containers/bbbbbbbbbbbb/json",
+		"GET /drain",
+		"POST /containers/bbbbbbbbbbbb/exec",
+		"POST /exec/exec1/start",
+		"GET /exec/exec1/json",
+		"POST /containers/bbbbbbbbbbbb/stop",
+		"DELETE /containers/bbbbbbbbbbbb",
+	}
+
+	var stopped []string
+	for i := 0; i < 50; i++ {
+		requestsLock.Lock()
+		stopped = nil
+		for _, r := range requests {
+			if !strings.HasPrefix(r, "GET /containers/json") && r != "GET /events" {
+				stopped = append(stopped, r)
+			}
+		}
+		requestsLock.Unlock()
+
+		if len(stopped) >= len(expected) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if len(stopped) != len(expected) {
+		t.Fatalf("Expected requests %v, got %v", expected, stopped)
+	}
+
+	for i := range expected {
+		if stopped[i] != expected[i] {
+			t.Errorf("Expected requests %v, got %v", expected, stopped)
+			break
+		}
+	}
+
+	// Then the next newest
+	d.stopTask(task)
+	d.Lock()
+	if d.taskContainers["web"]["cccccccccccc"].state != "stopping" || d.taskContainers["web"]["aaaaaaaaaaaa"].state != "running" {
+		t.Errorf("Expected container c to be stopped next")
+	}
+	d.Unlock()
+}
+
+func TestDockerStopOptions(t *testing.T) {
+	d := NewScheduler(false, 0, false, "unix:///var/run/docker.sock", "agent")
+
+	opts := d.createOptions(&demand.Task{Name: "web", Container: demand.ContainerSpec{StopSignal: "SIGQUIT"}})
+	if opts.Config.StopSignal != "SIGQUIT" {
+		t.Errorf("Expected stop signal SIGQUIT, got %s", opts.Config.StopSignal)
+	}
+
+	if stopTimeout(demand.ContainerSpec{}) != constDefaultStopTimeout {
+		t.Errorf("Expected the default stop timeout")
+	}
+
+	if stopTimeout(demand.ContainerSpec{StopTimeout: 30}) != 30*time.Second {
+		t.Errorf("Expected a stop timeout of 30s")
+	}
+
+	if secondsUntil(time.Now().Add(-time.Second)) != 0 {
+		t.Errorf("Expected no time left after the deadline")
+	}
+
+	// Containers get a minimum grace period even if the hooks used up the stop timeout
+	if stopGrace(time.Now().Add(-time.Second)) != uint(constMinStopGrace/time.Second) {
+		t.Errorf("Expected the minimum grace period after the deadline")
+	}
+
+	if stopGrace(time.Now().Add(5500*time.Millisecond)) != 5 {
+		t.Errorf("Expected a grace period of 5 seconds")
+	}
+
+	// Hooks are skipped once the deadline has passed, rather than running without a timeout
+	err := d.preStopExec("aaaaaaaaaaaa", "drain", time.Now())
+	if err == nil {
+		t.Errorf("Expected an error running a hook after the deadline")
+	}
+}
+
+func TestDockerStopErrors(t *testing.T) {
+	var removed []string
+	var removedLock sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/containers/aaaaaaaaaaaa/stop":
+			w.WriteHeader(http.StatusNotModified)
+		case r.URL.Path == "/containers/bbbbbbbbbbbb/stop":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == "DELETE":
+			removedLock.Lock()
+			removed = append(removed, strings.TrimPrefix(r.URL.Path, "/containers/"))
+			removedLock.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d := NewScheduler(false, 0, false, server.URL, "agent")
+	defer d.Cleanup()
+
+	task := &demand.Task{Name: "web"}
+	d.taskContainers["web"] = map[string]*dockerContainer{
+		"aaaaaaaaaaaa": {state: "stopping"},
+		"bbbbbbbbbbbb": {state: "stopping"},
+	}
+
+	// A container that has already stopped is still removed
+	d.stopContainer(task, "aaaaaaaaaaaa")
+
+	// A container we failed to stop can be stopped again
+	d.stopContainer(task, "bbbbbbbbbbbb")
+
+	state := func(id string) string {
+		d.Lock()
+		defer d.Unlock()
+		return d.taskContainers["web"][id].state
+	}
+
+	for i := 0; i < 50 && (state("aaaaaaaaaaaa") != "removing" || state("bbbbbbbbbbbb") != "running"); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if state("bbbbbbbbbbbb") != "running" {
+		t.Errorf("Expected container b to be running again, got %s", state("bbbbbbbbbbbb"))
+	}
+
+	for i := 0; i < 50; i++ {
+		removedLock.Lock()
+		n := len(removed)
+		removedLock.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	removedLock.Lock()
+	if len(removed) != 1 || removed[0] != "aaaaaaaaaaaa" {
+		t.Errorf("Expected to remove container a, removed %v", removed)
+	}
+	removedLock.Unlock()
+}
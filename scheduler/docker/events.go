@@ -0,0 +1,186 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// We do a full resync of the containers this often, even if the events stream is working
+	constResyncInterval = 1 * time.Minute
+	// How long to wait before reconnecting to the events stream
+	constEventsRetryInterval = 5 * time.Second
+)
+
+// watchEvents keeps the events stream open until Cleanup is called, reconnecting if it drops
+func (c *DockerScheduler) watchEvents() {
+	for {
+		err := c.streamEvents()
+
+		c.Lock()
+		c.streamID = 0
+		c.synced = false
+		c.Unlock()
+
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		log.Errorf("Docker events stream dropped: %v", err)
+
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(constEventsRetryInterval):
+		}
+	}
+}
+
+// streamEvents reads container events for our label until the stream drops. We use our own request rather than the
+// client's event listeners as those don't support filters, and can deliver events out of order.
+func (c *DockerScheduler) streamEvents() error {
+	client, baseURL, err := eventsClient(c.client.Endpoint())
+	if err != nil {
+		return err
+	}
+
+	filters, err := json.Marshal(map[string][]string{
+		"type":  {"container"},
+		"label": {labelMap},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", baseURL+"/events?"+url.Values{"filters": {string(filters)}}.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Cancel = c.stop
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error response code %d from Docker events", resp.StatusCode)
+	}
+
+	c.Lock()
+	c.lastStreamID++
+	c.streamID = c.lastStreamID
+	c.Unlock()
+	log.Debugf("Connected to Docker events stream")
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event docker.APIEvents
+		err = decoder.Decode(&event)
+		if err != nil {
+			return err
+		}
+
+		c.handleEvent(&event)
+	}
+}
+
+// eventsClient makes an HTTP client that can stream from the Docker endpoint, which may be a Unix socket
+func eventsClient(endpoint string) (client *http.Client, baseURL string, err error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		client = &http.Client{
+			Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return net.Dial("unix", socket)
+				},
+			},
+		}
+		return client, "http://docker", nil
+	case "tcp", "http":
+		return &http.Client{}, "http://" + u.Host, nil
+	default:
+		return nil, "", fmt.Errorf("Can't stream Docker events from %s", endpoint)
+	}
+}
+
+// handleEvent updates the state of one of our containers
+func (c *DockerScheduler) handleEvent(event *docker.APIEvents) {
+	action := event.Action
+	if action == "" {
+		action = event.Status
+	}
+
+	attributes := event.Actor.Attributes
+	taskName := attributes[labelMap]
+	id := event.Actor.ID
+	if id == "" {
+		id = event.ID
+	}
+
+	if taskName == "" || len(id) < 12 || !c.isOurs(attributes) {
+		return
+	}
+	id = id[:12]
+
+	c.Lock()
+	defer c.Unlock()
+
+	// Only update tasks that are already in our task map - don't try to manage anything else
+	containers, ok := c.taskContainers[taskName]
+	if !ok {
+		log.Debugf("Received %s event for task %s that we're not managing", action, taskName)
+		return
+	}
+
+	thisContainer, known := containers[id]
+	log.Debugf("[event] %s container %s for task %s", action, id, taskName)
+
+	switch action {
+	case "create":
+		if !known {
+			containers[id] = &dockerContainer{state: "created", created: time.Unix(event.Time, 0)}
+		}
+	case "start":
+		if !known {
+			log.Infof("We have no previous record of container %s, state running", id)
+			containers[id] = &dockerContainer{state: "running", created: time.Unix(event.Time, 0)}
+		} else if thisContainer.state == "created" || thisContainer.state == "starting" || thisContainer.state == "exited" ||
+			thisContainer.state == "restarting" {
+			// Containers that exited may have been restarted by their restart policy
+			thisContainer.state = "running"
+		}
+	case "die":
+		if !known || thisContainer.state == "removing" {
+			break
+		}
+		if thisContainer.state != "stopping" {
+			log.Errorf("Container %s has exited, but we didn't terminate it", id)
+		}
+		// Containers we're stopping stop counting as running once they've exited
+		thisContainer.state = "exited"
+		thisContainer.health = ""
+	case "destroy":
+		delete(containers, id)
+	case "health_status: starting", "health_status: healthy", "health_status: unhealthy":
+		if known {
+			thisContainer.health = strings.TrimPrefix(action, "health_status: ")
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+const (
+	// How long containers get to exit after the stop signal, if their task doesn't say
+	constDefaultStopTimeout = 10 * time.Second
+	// Pre-stop hooks can't use up the whole stop timeout, so containers always get at least this long to exit
+	constMinStopGrace = 2 * time.Second
+	// How often we check whether a pre-stop exec command has finished
+	constExecPollInterval = 100 * time.Millisecond
+)
+
+// stopTimeout is how long a container gets to exit, including its pre-stop hooks, before it's killed
+func stopTimeout(spec demand.ContainerSpec) time.Duration {
+	if spec.StopTimeout > 0 {
+		return time.Duration(spec.StopTimeout) * time.Second
+	}
+
+	return constDefaultStopTimeout
+}
+
+// secondsUntil is the whole number of seconds left before the deadline, which is what Docker's stop timeout takes
+func secondsUntil(deadline time.Time) uint {
+	remaining := deadline.Sub(time.Now())
+	if remaining < 0 {
+		return 0
+	}
+
+	return uint(remaining / time.Second)
+}
+
+// stopGrace is how long the container gets to exit after the stop signal, which is what's left before the deadline
+// but at least the minimum grace period
+func stopGrace(deadline time.Time) uint {
+	grace := secondsUntil(deadline)
+	if grace < uint(constMinStopGrace/time.Second) {
+		return uint(constMinStopGrace / time.Second)
+	}
+
+	return grace
+}
+
+// runPreStopHooks gives the container a chance to finish in-flight work before it's sent the stop signal. We stop
+// the container anyway if a hook fails or doesn't finish before the deadline.
+func (c *DockerScheduler) runPreStopHooks(id string, spec demand.ContainerSpec, deadline time.Time) {
+	if spec.PreStopHTTP != nil {
+		err := c.preStopHTTP(id, spec.PreStopHTTP, deadline)
+		if err != nil {
+			log.Errorf("Pre-stop HTTP hook failed for container %s: %v", id, err)
+		}
+	}
+
+	if spec.PreStopExec != "" {
+		err := c.preStopExec(id, spec.PreStopExec, deadline)
+		if err != nil {
+			log.Errorf("Pre-stop command failed for container %s: %v", id, err)
+		}
+	}
+}
+
+// preStopHTTP makes a GET request to the container, on its IP address on the first network we find. Containers on
+// the host network are reached on localhost.
+func (c *DockerScheduler) preStopHTTP(id string, hook *demand.HTTPHook, deadline time.Time) error {
+	container, err := c.client.InspectContainer(id)
+	if err != nil {
+		return err
+	}
+
+	host := "127.0.0.1"
+	if ns := container.NetworkSettings; ns != nil {
+		if ns.IPAddress != "" {
+			host = ns.IPAddress
+		} else {
+			for _, network := range ns.Networks {
+				if network.IPAddress != "" {
+					host = network.IPAddress
+					break
+				}
+			}
+		}
+	}
+
+	url := "http://" + net.JoinHostPort(host, strconv.Itoa(hook.Port)) + hook.Path
+	log.Debugf("[pre-stop] GET %s for container %s", url, id)
+
+	// A zero timeout would mean no timeout at all
+	timeout := deadline.Sub(time.Now())
+	if timeout <= 0 {
+		return fmt.Errorf("No time left to call %s", url)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Error response code %d from %s", resp.StatusCode, url)
+	}
+
+	return nil
+}
+
+// preStopExec runs a command in the container and waits for it to finish
+func (c *DockerScheduler) preStopExec(id string, command string, deadline time.Time) error {
+	if !time.Now().Before(deadline) {
+		return fmt.Errorf("No time left to run %s", command)
+	}
+
+	exec, err := c.client.CreateExec(docker.CreateExecOptions{
+		Container: id,
+		Cmd:       strings.Fields(command),
+	})
+	if err != nil {
+		return err
+	}
+
+	// We don't need the output, so we detach rather than attaching to the exec's streams
+	err = c.client.StartExec(exec.ID, docker.StartExecOptions{Detach: true})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("[pre-stop] running %s in container %s", command, id)
+	for time.Now().Before(deadline) {
+		inspect, err := c.client.InspectExec(exec.ID)
+		if err != nil {
+			return err
+		}
+
+		if !inspect.Running {
+			if inspect.ExitCode != 0 {
+				return fmt.Errorf("%s exited with code %d", command, inspect.ExitCode)
+			}
+			return nil
+		}
+
+		time.Sleep(constExecPollInterval)
+	}
+
+	return fmt.Errorf("%s still running after the stop timeout", command)
+}
@@ -0,0 +1,180 @@
+// Package ecs provides a scheduler using the Amazon ECS API. Each task is an ECS service.
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/op/go-logging"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/scheduler"
+)
+
+// DescribeServices accepts up to 10 services at a time
+const constMaxDescribeServices = 10
+
+var log = logging.MustGetLogger("mssscheduler")
+
+// ECSScheduler holds the ECS client and the cluster our services run in.
+type ECSScheduler struct {
+	client  ecsiface.ECSAPI
+	cluster string
+}
+
+// compile-time assert that we implement the right interface
+var _ scheduler.Scheduler = (*ECSScheduler)(nil)
+
+// NewScheduler returns a pointer to the scheduler.
+func NewScheduler(cluster string) (*ECSScheduler, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		return nil, errors.New("AWS_REGION env var must be set")
+	}
+
+	var config *aws.Config = &aws.Config{Region: aws.String(region)}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		log.Errorf("Failed to create AWS session: %v", err)
+		return nil, err
+	}
+
+	return &ECSScheduler{
+		client:  ecs.New(sess),
+		cluster: cluster,
+	}, nil
+}
+
+// InitScheduler checks the task's service exists in the cluster.
+func (e *ECSScheduler) InitScheduler(task *demand.Task) error {
+	log.Infof("ECS initializing task %s", task.Name)
+
+	services, err := e.describeServices([]string{task.Name})
+	if err != nil {
+		return err
+	}
+
+	s, ok := services[task.Name]
+	if !ok {
+		return fmt.Errorf("ECS service %s not found in cluster %s", task.Name, e.cluster)
+	}
+
+	if status := aws.StringValue(s.Status); status != "ACTIVE" {
+		return fmt.Errorf("ECS service %s is %s", task.Name, status)
+	}
+
+	return nil
+}
+
+// StopStartTasks sets the desired count of each service that needs to scale.
+func (e *ECSScheduler) StopStartTasks(tasks *demand.Tasks) error {
+	// Create tasks if there aren't enough of them, and stop them if there are too many
+	var tooMany []*demand.Task
+	var tooFew []*demand.Task
+
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	for _, task := range tasks.Tasks {
+		if task.Demand > task.Requested {
+			tooFew = append(tooFew, task)
+		}
+		if task.Demand < task.Requested {
+			tooMany = append(tooMany, task)
+		}
+	}
+
+	// Concatentate the two lists - scale down first to free up resources
+	tasksToScale := append(tooMany, tooFew...)
+	for _, task := range tasksToScale {
+		params := ecs.UpdateServiceInput{
+			Cluster:      aws.String(e.cluster),
+			Service:      aws.String(task.Name),
+			DesiredCount: aws.Int64(int64(task.Demand)),
+		}
+
+		_, err := e.client.UpdateService(&params)
+		if err != nil {
+			log.Errorf("Couldn't scale %s: %v ", task.Name, err)
+			return err
+		}
+
+		task.Requested = task.Demand
+		log.Debugf("Now have %s: %d", task.Name, task.Requested)
+	}
+
+	return nil
+}
+
+// CountAllTasks tells us how many instances of each service are running.
+func (e *ECSScheduler) CountAllTasks(running *demand.Tasks) error {
+	running.Lock()
+	defer running.Unlock()
+
+	names := make([]string, len(running.Tasks))
+	for i, t := range running.Tasks {
+		names[i] = t.Name
+	}
+
+	services, err := e.describeServices(names)
+	if err != nil {
+		return err
+	}
+
+	// Defaults to 0 if the service does not exist
+	for _, t := range running.Tasks {
+		if s, ok := services[t.Name]; ok {
+			t.Running = int(aws.Int64Value(s.RunningCount))
+		} else {
+			t.Running = 0
+		}
+		// We don't have health check results for ECS services
+		t.Healthy = t.Running
+	}
+
+	return nil
+}
+
+// Cleanup gives the scheduler an opportunity to stop anything that needs to be stopped
+func (e *ECSScheduler) Cleanup() error {
+	return nil
+}
+
+// describeServices gets the services we can find, by name
+func (e *ECSScheduler) describeServices(names []string) (services map[string]*ecs.Service, err error) {
+	services = make(map[string]*ecs.Service, len(names))
+
+	for start := 0; start < len(names); start += constMaxDescribeServices {
+		end := start + constMaxDescribeServices
+		if end > len(names) {
+			end = len(names)
+		}
+
+		params := ecs.DescribeServicesInput{
+			Cluster:  aws.String(e.cluster),
+			Services: aws.StringSlice(names[start:end]),
+		}
+
+		resp, err := e.client.DescribeServices(&params)
+		if err != nil {
+			log.Errorf("Failed to describe ECS services: %v", err)
+			return nil, err
+		}
+
+		for _, f := range resp.Failures {
+			log.Debugf("Couldn't describe ECS service %s: %s", aws.StringValue(f.Arn), aws.StringValue(f.Reason))
+		}
+
+		for _, s := range resp.Services {
+			services[aws.StringValue(s.ServiceName)] = s
+		}
+	}
+
+	return services, nil
+}
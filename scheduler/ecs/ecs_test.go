@@ -0,0 +1,169 @@
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+// Mock the ECS API calls we use, with a set of services in a single cluster
+type mockedECS struct {
+	ecsiface.ECSAPI
+	services        map[string]*ecs.Service
+	describeCalls   int
+	updateErr       error
+	expectedCluster string
+}
+
+func (m *mockedECS) DescribeServices(in *ecs.DescribeServicesInput) (*ecs.DescribeServicesOutput, error) {
+	m.describeCalls++
+	if aws.StringValue(in.Cluster) != m.expectedCluster {
+		return nil, errors.New("ClusterNotFoundException")
+	}
+
+	if len(in.Services) > 10 {
+		return nil, errors.New("InvalidParameterException: too many services")
+	}
+
+	out := &ecs.DescribeServicesOutput{}
+	for _, name := range aws.StringValueSlice(in.Services) {
+		if s, ok := m.services[name]; ok {
+			out.Services = append(out.Services, s)
+		} else {
+			out.Failures = append(out.Failures, &ecs.Failure{Arn: aws.String(name), Reason: aws.String("MISSING")})
+		}
+	}
+
+	return out, nil
+}
+
+func (m *mockedECS) UpdateService(in *ecs.UpdateServiceInput) (*ecs.UpdateServiceOutput, error) {
+	if m.updateErr != nil {
+		return nil, m.updateErr
+	}
+
+	s, ok := m.services[aws.StringValue(in.Service)]
+	if !ok {
+		return nil, errors.New("ServiceNotFoundException")
+	}
+
+	s.DesiredCount = in.DesiredCount
+	return &ecs.UpdateServiceOutput{Service: s}, nil
+}
+
+func newService(name string, status string, running int64) *ecs.Service {
+	return &ecs.Service{
+		ServiceName:  aws.String(name),
+		Status:       aws.String(status),
+		DesiredCount: aws.Int64(running),
+		RunningCount: aws.Int64(running),
+	}
+}
+
+func TestECSInitScheduler(t *testing.T) {
+	m := &mockedECS{
+		services: map[string]*ecs.Service{
+			"web":  newService("web", "ACTIVE", 2),
+			"gone": newService("gone", "INACTIVE", 0),
+		},
+		expectedCluster: "test",
+	}
+
+	e := ECSScheduler{client: m, cluster: "test"}
+
+	tests := []struct {
+		name string
+		pass bool
+	}{
+		{name: "web", pass: true},
+		{name: "gone", pass: false},
+		{name: "missing", pass: false},
+	}
+
+	for _, test := range tests {
+		err := e.InitScheduler(&demand.Task{Name: test.name})
+		if (err == nil) != test.pass {
+			t.Errorf("Unexpected result initializing %s: %v", test.name, err)
+		}
+	}
+
+	e.cluster = "other"
+	if err := e.InitScheduler(&demand.Task{Name: "web"}); err == nil {
+		t.Errorf("Expected an error for the wrong cluster")
+	}
+}
+
+func TestECSScaling(t *testing.T) {
+	m := &mockedECS{
+		services:        make(map[string]*ecs.Service),
+		expectedCluster: "test",
+	}
+
+	e := ECSScheduler{client: m, cluster: "test"}
+
+	// More tasks than we can describe in one call
+	tasks := &demand.Tasks{}
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("service%d", i)
+		m.services[name] = newService(name, "ACTIVE", int64(i))
+		tasks.Tasks = append(tasks.Tasks, &demand.Task{Name: name})
+	}
+	tasks.Tasks = append(tasks.Tasks, &demand.Task{Name: "missing", Running: 3})
+
+	err := e.CountAllTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if m.describeCalls != 2 {
+		t.Errorf("Expected 2 calls to describe services, got %d", m.describeCalls)
+	}
+
+	for i, task := range tasks.Tasks[:12] {
+		if task.Running != i {
+			t.Errorf("Expected %d running for %s, got %d", i, task.Name, task.Running)
+		}
+	}
+
+	if tasks.Tasks[12].Running != 0 {
+		t.Errorf("Expected none running for a missing service")
+	}
+
+	up := tasks.Tasks[1]
+	up.Requested = 1
+	up.Demand = 4
+
+	down := tasks.Tasks[5]
+	down.Requested = 5
+	down.Demand = 2
+
+	err = e.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if aws.Int64Value(m.services["service1"].DesiredCount) != 4 || aws.Int64Value(m.services["service5"].DesiredCount) != 2 {
+		t.Errorf("Desired counts not updated")
+	}
+
+	if up.Requested != 4 || down.Requested != 2 {
+		t.Errorf("Expected requested to match demand")
+	}
+
+	m.updateErr = errors.New("ThrottlingException")
+	up.Demand = 6
+	err = e.StopStartTasks(tasks)
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+
+	if up.Requested != 4 {
+		t.Errorf("Requested shouldn't change after an error")
+	}
+}
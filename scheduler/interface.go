@@ -16,6 +16,18 @@ type Scheduler interface {
 	// CountAllTasks updates task.Running to tell us how many instances of each task are currently running
 	CountAllTasks(tasks *demand.Tasks) error
 
-	// Cleanup is called to give the scheduler a chance to clean up
+	// Cleanup is called to give the scheduler a chance to clean up. It's called before the demand update channel is
+	// closed, so the scheduler needs to stop sending on it.
 	Cleanup() error
 }
+
+// ShutdownHandler is implemented by schedulers that need to do something once each task's shutdown policy has been
+// applied, just before we exit
+type ShutdownHandler interface {
+	Shutdown() error
+}
+
+// CapacityReporter is implemented by schedulers that can tell us the total resources available for running tasks
+type CapacityReporter interface {
+	GetCapacity() (demand.Resources, error)
+}
@@ -2,45 +2,40 @@
 package kubernetes
 
 import (
-	"encoding/json"
-	"time"
+	"sync"
 
 	"github.com/op/go-logging"
 
 	"k8s.io/client-go/1.5/kubernetes"
 	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
 
 	"github.com/microscaling/microscaling/demand"
 	"github.com/microscaling/microscaling/scheduler"
 	"github.com/microscaling/microscaling/utils"
 )
 
-var (
-	log = logging.MustGetLogger("mssscheduler")
-	pt  = api.StrategicMergePatchType
-)
+var log = logging.MustGetLogger("mssscheduler")
 
-// KubernetesScheduler holds the Kubernetes clientset and a Backoff struct for each task.
+// KubernetesScheduler holds the Kubernetes clientset and a cache of the workloads we're scaling.
 type KubernetesScheduler struct {
-	clientset    *kubernetes.Clientset
-	namespace    string
-	demandUpdate chan struct{}
-	backoff      *utils.Backoff
-}
-
-// deploymentSpec updates the Deployments API
-type deploymentSpec struct {
-	Spec deployment `json:"spec"`
-}
-
-// deployment sends the number of pods to run
-type deployment struct {
-	Replicas int32 `json:"replicas"`
+	clientset     *kubernetes.Clientset
+	namespace     string
+	labelSelector string
+	demandUpdate  chan struct{}
+
+	// Caches of built-in workloads, indexed by collection path, which are kept up to date by watches until Cleanup
+	// is called
+	caches  map[string]*workloadCache
+	stopped bool
+	stop    chan struct{}
+	sync.Mutex
 }
 
 // NewScheduler returns a pointer to the scheduler. Creates k8s clientset from the provided kube
-// config or when running as a pod uses the in cluster config.
-func NewScheduler(kubeConfig string, namespace string, demandUpdate chan struct{}) *KubernetesScheduler {
+// config or when running as a pod uses the in cluster config. If there's a label selector, we only
+// watch workloads that match it.
+func NewScheduler(kubeConfig string, namespace string, labelSelector string, demandUpdate chan struct{}) *KubernetesScheduler {
 	clientset, err := utils.NewKubeClientset(kubeConfig, namespace)
 	if err != nil {
 		log.Errorf("Error creating Kubernetes clientset: %v", err)
@@ -48,40 +43,41 @@ func NewScheduler(kubeConfig string, namespace string, demandUpdate chan struct{
 	}
 
 	return &KubernetesScheduler{
-		clientset:    clientset,
-		namespace:    namespace,
-		demandUpdate: demandUpdate,
-		backoff: &utils.Backoff{
-			Min:    250 * time.Millisecond,
-			Max:    5 * time.Second,
-			Factor: 2,
-		},
+		clientset:     clientset,
+		namespace:     namespace,
+		labelSelector: labelSelector,
+		demandUpdate:  demandUpdate,
+		caches:        make(map[string]*workloadCache),
+		stop:          make(chan struct{}),
 	}
 }
 
-// compile-time assert that we implement the right interface
+// compile-time assert that we implement the right interfaces
 var _ scheduler.Scheduler = (*KubernetesScheduler)(nil)
+var _ scheduler.CapacityReporter = (*KubernetesScheduler)(nil)
 
-// InitScheduler initializes the scheduler.
+// InitScheduler checks we know where to find the task's workload, and starts watching built-in workloads of its kind.
 func (k *KubernetesScheduler) InitScheduler(task *demand.Task) (err error) {
 	log.Infof("Kubernetes initializing task %s", task.Name)
-	return err
+	w, err := k.workloadFor(task)
+	if err != nil {
+		return err
+	}
+
+	if w.readyField != "" {
+		k.startWatch(w)
+	}
+
+	return nil
 }
 
-// StopStartTasks by calling the Kubernetes Deployments API.
+// StopStartTasks by updating the scale of each task's workload.
 func (k *KubernetesScheduler) StopStartTasks(tasks *demand.Tasks) error {
 	// Create tasks if there aren't enough of them, and stop them if there are too many
 	var tooMany []*demand.Task
 	var tooFew []*demand.Task
 	var err error
 
-	// Check we're not already backed off. This could easily happen if we get a demand update
-	// arrive while we are in the midst of a previous backoff.
-	if k.backoff.Waiting() {
-		log.Debug("Backoff timer still running")
-		return nil
-	}
-
 	tasks.Lock()
 	defer tasks.Unlock()
 
@@ -101,74 +97,64 @@ func (k *KubernetesScheduler) StopStartTasks(tasks *demand.Tasks) error {
 	for _, t := range tasksToScale {
 		log.Debugf("Scaling task %s to %d", t.Name, t.Demand)
 
-		running, err := k.countTasks(t.Name)
+		running, err := k.countTasks(t)
 		if err != nil {
 			log.Errorf("Error getting task count for %s: %v", t.Name, err)
 			return err
 		}
 
-		if running == t.Requested {
-			// Clear any backoffs before scaling
-			k.backoff.Reset()
-
-			err := k.stopStartTask(t)
-			if err != nil {
-				log.Errorf("Error scaling %s: %v ", t.Name, err)
-				return err
-			}
-
-			log.Infof("Scaled %s to %d", t.Name, t.Demand)
-
-		} else {
-			// Trigger a backoff as the previous scaling action is not yet complete
-			err = k.backoff.Backoff(k.demandUpdate)
-			log.Debugf("Backing off %s %d requested but %d running", t.Name, t.Demand, running)
+		if running != t.Requested {
+			// The previous scaling action is not yet complete. We'll get another demand update when the watch
+			// sees the rollout finish.
+			log.Debugf("Waiting for %s: %d requested but %d running", t.Name, t.Requested, running)
+			continue
+		}
 
+		err = k.stopStartTask(t)
+		if err != nil {
+			log.Errorf("Error scaling %s: %v ", t.Name, err)
 			return err
 		}
+
+		log.Infof("Scaled %s to %d", t.Name, t.Demand)
 	}
 
 	return err
 }
 
-// CountAllTasks tells us how many pods of each deployment are currently running.
+// CountAllTasks tells us how many pods of each workload are currently running.
 func (k *KubernetesScheduler) CountAllTasks(running *demand.Tasks) (err error) {
 	running.Lock()
 	defer running.Unlock()
 
-	// Set running counts. Defaults to 0 if the deployment does not exist.
+	// Set running counts. Defaults to 0 if the workload does not exist.
 	tasks := running.Tasks
 	for _, t := range tasks {
-		running, err := k.countTasks(t.Name)
+		running, err := k.countTasks(t)
 		if err != nil {
-			log.Errorf("Error getting deployment %s: %v", t.Name, err)
+			log.Errorf("Error getting workload %s: %v", t.Name, err)
 			return err
 		}
 
 		t.Running = running
-		log.Debugf("Deployment %s: requested %d, running %d", t.Name, t.Requested, running)
+		// We only count pods that have already passed their readiness checks
+		t.Healthy = running
+		log.Debugf("Workload %s: requested %d, running %d", t.Name, t.Requested, running)
 	}
 
 	return err
 }
 
-// stopStartTask patches the deployment to set the desired number of pods
+// stopStartTask updates the workload's scale subresource to set the desired number of pods
 func (k *KubernetesScheduler) stopStartTask(task *demand.Task) (err error) {
-	deployment := deploymentSpec{
-		deployment{
-			Replicas: int32(task.Demand),
-		},
-	}
-
-	bytes, err := json.Marshal(deployment)
+	w, err := k.workloadFor(task)
 	if err != nil {
-		log.Errorf("Error marshaling deployment json for %s: %v", task.Name, err)
 		return err
 	}
 
-	_, err = k.clientset.Extensions().Deployments(k.namespace).Patch(task.Name, pt, bytes)
+	err = k.setReplicas(w, task.Demand)
 	if err != nil {
-		log.Errorf("Error patching deployment %s: %v", task.Name, err)
+		log.Errorf("Error scaling workload %s: %v", task.Name, err)
 		return err
 	}
 
@@ -177,20 +163,66 @@ func (k *KubernetesScheduler) stopStartTask(task *demand.Task) (err error) {
 	return err
 }
 
-// countTasks counts how many running pods exist for the deployment
-func (k *KubernetesScheduler) countTasks(taskName string) (count int, err error) {
-	d, err := k.clientset.Extensions().Deployments(k.namespace).Get(taskName)
+// countTasks counts how many running pods exist for the task's workload. We use the cache if it's synced, and
+// only ask the API server if it isn't.
+func (k *KubernetesScheduler) countTasks(task *demand.Task) (count int, err error) {
+	w, err := k.workloadFor(task)
 	if err != nil {
-		log.Errorf("Error getting deployment %s: %v", taskName, err)
 		return count, err
 	}
 
-	count = int(d.Status.AvailableReplicas)
+	count, cached, err := k.cachedReadyReplicas(w)
+	if !cached {
+		count, err = k.readyReplicas(w)
+	}
+	if err != nil {
+		log.Errorf("Error getting workload %s: %v", task.Name, err)
+	}
+
 	return count, err
 }
 
-// Cleanup gives the scheduler an opportunity to stop anything that needs to be stopped
+// GetCapacity adds up the allocatable CPU and memory on all the schedulable nodes in the cluster
+func (k *KubernetesScheduler) GetCapacity() (capacity demand.Resources, err error) {
+	nodes, err := k.clientset.Core().Nodes().List(api.ListOptions{})
+	if err != nil {
+		log.Errorf("Error listing nodes: %v", err)
+		return capacity, err
+	}
+
+	for _, n := range nodes.Items {
+		if n.Spec.Unschedulable {
+			continue
+		}
+
+		if cpu, ok := n.Status.Allocatable[v1.ResourceCPU]; ok {
+			capacity.CPU += float64(cpu.MilliValue()) / 1000
+		}
+
+		if memory, ok := n.Status.Allocatable[v1.ResourceMemory]; ok {
+			capacity.Memory += memory.Value() / (1024 * 1024)
+		}
+	}
+
+	return capacity, err
+}
+
+// Cleanup stops the watches, and with them the demand updates when rollouts finish
 func (k *KubernetesScheduler) Cleanup() error {
-	k.backoff.Stop()
+	k.Lock()
+	defer k.Unlock()
+
+	if k.stopped {
+		return nil
+	}
+
+	k.stopped = true
+	close(k.stop)
+	for _, cache := range k.caches {
+		if cache.stream != nil {
+			cache.stream.Close()
+		}
+	}
+
 	return nil
 }
@@ -1,10 +1,17 @@
 package kubernetes
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/rest"
+
 	"github.com/microscaling/microscaling/demand"
 )
 
@@ -13,7 +20,8 @@ func TestKubernetesInitScheduler(t *testing.T) {
 	namespace := "default"
 	demandUpdate := make(chan struct{}, 1)
 
-	k := NewScheduler(kubeConfig, namespace, demandUpdate)
+	k := NewScheduler(kubeConfig, namespace, "microscaling=true", demandUpdate)
+	defer k.Cleanup()
 
 	task := demand.Task{
 		Name:   "consumer",
@@ -26,15 +34,230 @@ func TestKubernetesInitScheduler(t *testing.T) {
 		t.Errorf("Expected namespace to be %s but was %s", namespace, k.namespace)
 	}
 
-	if k.backoff.Factor != 2 {
-		t.Errorf("Expected backoff factor to be 2 but was %d", k.backoff.Factor)
+	if k.labelSelector != "microscaling=true" {
+		t.Errorf("Expected label selector to be microscaling=true but was %s", k.labelSelector)
+	}
+
+	// We start watching the deployments
+	if _, ok := k.caches["/apis/extensions/v1beta1/namespaces/default/deployments"]; !ok {
+		t.Errorf("Expected to watch deployments, watching %v", k.caches)
+	}
+}
+
+func TestKubernetesWorkloadPaths(t *testing.T) {
+	k := &KubernetesScheduler{namespace: "ns"}
+
+	tests := []struct {
+		workload demand.Workload
+		path     string
+		pass     bool
+	}{
+		{workload: demand.Workload{}, path: "/apis/extensions/v1beta1/namespaces/ns/deployments/app", pass: true},
+		{workload: demand.Workload{Kind: "Deployment", APIVersion: "apps/v1"}, path: "/apis/apps/v1/namespaces/ns/deployments/app", pass: true},
+		{workload: demand.Workload{Kind: "StatefulSet"}, path: "/apis/apps/v1/namespaces/ns/statefulsets/app", pass: true},
+		{workload: demand.Workload{Kind: "ReplicationController"}, path: "/api/v1/namespaces/ns/replicationcontrollers/app", pass: true},
+		{workload: demand.Workload{Kind: "Worker", APIVersion: "example.com/v1"}, path: "/apis/example.com/v1/namespaces/ns/workers/app", pass: true},
+		{workload: demand.Workload{Kind: "Index", APIVersion: "example.com/v1", Resource: "indices"}, path: "/apis/example.com/v1/namespaces/ns/indices/app", pass: true},
+		{workload: demand.Workload{Namespace: "other", Name: "web"}, path: "/apis/extensions/v1beta1/namespaces/other/deployments/web", pass: true},
+		{workload: demand.Workload{Kind: "Worker"}, pass: false},
 	}
 
-	if k.backoff.Min != (250 * time.Millisecond) {
-		t.Errorf("Expected min backoff to be 250 ms but was %d", k.backoff.Min)
+	for _, test := range tests {
+		w, err := k.workloadFor(&demand.Task{Name: "app", Workload: test.workload})
+		if err != nil && test.pass {
+			t.Errorf("Unexpected error for %+v: %v", test.workload, err)
+		}
+		if err == nil && !test.pass {
+			t.Errorf("Expected an error for %+v", test.workload)
+		}
+		if test.pass && w.path != test.path {
+			t.Errorf("Expected path %s for %+v, got %s", test.path, test.workload, w.path)
+		}
 	}
+}
+
+func TestKubernetesScale(t *testing.T) {
+	var updated map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /apis/apps/v1/namespaces/default/statefulsets/db":
+			w.Write([]byte(`{"kind":"StatefulSet","status":{"replicas":3,"readyReplicas":2}}`))
+		case "GET /apis/apps/v1/namespaces/default/statefulsets/db/scale":
+			w.Write([]byte(`{"kind":"Scale","apiVersion":"autoscaling/v1","metadata":{"name":"db","resourceVersion":"7"},"spec":{"replicas":3},"status":{"replicas":3}}`))
+		case "PUT /apis/apps/v1/namespaces/default/statefulsets/db/scale":
+			json.NewDecoder(r.Body).Decode(&updated)
+			w.Write([]byte(`{}`))
+		case "GET /apis/example.com/v1/namespaces/default/workers/worker/scale":
+			w.Write([]byte(`{"kind":"Scale","spec":{"replicas":4},"status":{"replicas":4}}`))
+		case "GET /apis/extensions/v1beta1/namespaces/default/deployments/web":
+			w.Write([]byte(`{"kind":"Deployment","status":{"replicas":1}}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	k := &KubernetesScheduler{clientset: clientset, namespace: "default"}
+
+	db := &demand.Task{Name: "db", Workload: demand.Workload{Kind: "StatefulSet"}, Demand: 5}
+	worker := &demand.Task{Name: "worker", Workload: demand.Workload{Kind: "Worker", APIVersion: "example.com/v1"}}
+	web := &demand.Task{Name: "web"}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{db, worker, web}}
 
-	if k.backoff.Max != (5 * time.Second) {
-		t.Errorf("Expected max backoff to be 5 secs but was %d", k.backoff.Max)
+	err = k.CountAllTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
 	}
+
+	// Built-in kinds count ready pods, custom resources count the replicas in the scale status
+	if db.Running != 2 || worker.Running != 4 || web.Running != 0 {
+		t.Errorf("Unexpected counts db %d, worker %d, web %d", db.Running, worker.Running, web.Running)
+	}
+
+	err = k.stopStartTask(db)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if db.Requested != 5 {
+		t.Errorf("Expected 5 requested, got %d", db.Requested)
+	}
+
+	spec, _ := updated["spec"].(map[string]interface{})
+	metadata, _ := updated["metadata"].(map[string]interface{})
+	if spec["replicas"] != float64(5) || metadata["resourceVersion"] != "7" {
+		t.Errorf("Unexpected scale update %v", updated)
+	}
+}
+
+func TestKubernetesWatch(t *testing.T) {
+	var gets int
+	var getsLock sync.Mutex
+	events := make(chan string)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/apis/extensions/v1beta1/namespaces/default/deployments":
+			if r.URL.Query().Get("labelSelector") != "microscaling=true" {
+				t.Errorf("Expected a label selector, got %v", r.URL.Query())
+			}
+
+			if r.URL.Query().Get("watch") != "true" {
+				w.Write([]byte(`{"metadata":{"resourceVersion":"10"},"items":[
+					{"metadata":{"name":"web","generation":2},"spec":{"replicas":2},"status":{"observedGeneration":2,"availableReplicas":1}},
+					{"metadata":{"name":"api","generation":1},"spec":{"replicas":1},"status":{"observedGeneration":1,"availableReplicas":1}}]}`))
+				return
+			}
+
+			if r.URL.Query().Get("resourceVersion") != "10" {
+				t.Errorf("Expected to watch from resource version 10, got %v", r.URL.Query())
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for event := range events {
+				w.Write([]byte(event))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			getsLock.Lock()
+			gets++
+			getsLock.Unlock()
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	demandUpdate := make(chan struct{}, 1)
+	k := &KubernetesScheduler{
+		clientset:     clientset,
+		namespace:     "default",
+		labelSelector: "microscaling=true",
+		demandUpdate:  demandUpdate,
+		caches:        make(map[string]*workloadCache),
+		stop:          make(chan struct{}),
+	}
+	defer k.Cleanup()
+
+	web := &demand.Task{Name: "web"}
+	api := &demand.Task{Name: "api"}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{web, api}}
+	k.InitScheduler(web)
+	k.InitScheduler(api)
+
+	watching := func() bool {
+		k.Lock()
+		defer k.Unlock()
+		cache := k.caches["/apis/extensions/v1beta1/namespaces/default/deployments"]
+		return cache.synced && cache.stream != nil
+	}
+
+	for i := 0; i < 50 && !watching(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if !watching() {
+		t.Fatalf("Expected to be watching deployments")
+	}
+
+	// Counts come from the cache
+	err = k.CountAllTasks(tasks)
+	if err != nil || web.Running != 1 || api.Running != 1 {
+		t.Errorf("Unexpected counts web %d, api %d: %v", web.Running, api.Running, err)
+	}
+
+	getsLock.Lock()
+	if gets != 0 {
+		t.Errorf("Expected no requests for individual deployments, got %d", gets)
+	}
+	getsLock.Unlock()
+
+	// We're told when the rollout finishes
+	events <- `{"type":"MODIFIED","object":{"metadata":{"name":"web","generation":2},"spec":{"replicas":2},"status":{"observedGeneration":2,"availableReplicas":2}}}`
+
+	select {
+	case <-demandUpdate:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a demand update when the rollout finished")
+	}
+
+	err = k.CountAllTasks(tasks)
+	if err != nil || web.Running != 2 {
+		t.Errorf("Expected 2 running for web, got %d: %v", web.Running, err)
+	}
+
+	events <- `{"type":"DELETED","object":{"metadata":{"name":"api"}}}`
+	for i := 0; i < 50; i++ {
+		if err = k.CountAllTasks(tasks); err != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err == nil {
+		t.Errorf("Expected an error counting a deleted deployment")
+	}
+
+	// Cleanup is called before the demand update channel is closed, and after that we mustn't send on it
+	k.Cleanup()
+	close(demandUpdate)
+	k.rolloutFinished("web")
+
+	close(events)
 }
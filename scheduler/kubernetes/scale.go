@@ -0,0 +1,153 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+// workloadKind has the defaults for a built-in kind of workload
+type workloadKind struct {
+	apiVersion string
+	resource   string
+	// The status field counting pods that are ready to do work
+	readyField string
+}
+
+var workloadKinds = map[string]workloadKind{
+	"Deployment":            {apiVersion: "extensions/v1beta1", resource: "deployments", readyField: "availableReplicas"},
+	"ReplicaSet":            {apiVersion: "extensions/v1beta1", resource: "replicasets", readyField: "availableReplicas"},
+	"StatefulSet":           {apiVersion: "apps/v1", resource: "statefulsets", readyField: "readyReplicas"},
+	"ReplicationController": {apiVersion: "v1", resource: "replicationcontrollers", readyField: "availableReplicas"},
+}
+
+// workload is where to find a task's object in the API
+type workload struct {
+	collection string
+	name       string
+	path       string
+	readyField string // empty for custom resources, where we count the replicas in the scale status
+}
+
+// scaleStatus is the part of a Scale object that we read
+type scaleStatus struct {
+	Status struct {
+		Replicas int `json:"replicas"`
+	} `json:"status"`
+}
+
+// workloadFor finds the API path for the task's workload, filling in the defaults for its kind
+func (k *KubernetesScheduler) workloadFor(task *demand.Task) (w workload, err error) {
+	kind := task.Workload.Kind
+	if kind == "" {
+		kind = "Deployment"
+	}
+
+	apiVersion := task.Workload.APIVersion
+	resource := task.Workload.Resource
+
+	if known, ok := workloadKinds[kind]; ok {
+		if apiVersion == "" {
+			apiVersion = known.apiVersion
+		}
+		if resource == "" {
+			resource = known.resource
+		}
+		w.readyField = known.readyField
+	} else {
+		if apiVersion == "" {
+			return w, fmt.Errorf("apiVersion is required for kind %s", kind)
+		}
+		if resource == "" {
+			resource = strings.ToLower(kind) + "s"
+		}
+	}
+
+	// The core API group has a different prefix
+	prefix := "/apis/" + apiVersion
+	if apiVersion == "v1" {
+		prefix = "/api/v1"
+	}
+
+	namespace := task.Workload.Namespace
+	if namespace == "" {
+		namespace = k.namespace
+	}
+
+	w.name = task.Workload.Name
+	if w.name == "" {
+		w.name = task.Name
+	}
+
+	w.collection = prefix + "/namespaces/" + namespace + "/" + resource
+	w.path = w.collection + "/" + w.name
+	return w, nil
+}
+
+// getScale reads the task's Scale object, which is the same for every kind of workload
+func (k *KubernetesScheduler) getScale(w workload) ([]byte, error) {
+	return k.clientset.Core().GetRESTClient().Get().AbsPath(w.path, "scale").Do().Raw()
+}
+
+// setReplicas updates the replicas in the task's Scale object. We keep the rest of the object as it was, including
+// its resource version so we don't overwrite a change someone else has made.
+func (k *KubernetesScheduler) setReplicas(w workload, replicas int) error {
+	b, err := k.getScale(w)
+	if err != nil {
+		return err
+	}
+
+	var scale map[string]interface{}
+	err = json.Unmarshal(b, &scale)
+	if err != nil {
+		return err
+	}
+
+	spec, ok := scale["spec"].(map[string]interface{})
+	if !ok {
+		spec = make(map[string]interface{})
+		scale["spec"] = spec
+	}
+	spec["replicas"] = replicas
+
+	b, err = json.Marshal(scale)
+	if err != nil {
+		return err
+	}
+
+	return k.clientset.Core().GetRESTClient().Put().AbsPath(w.path, "scale").Body(b).Do().Error()
+}
+
+// readyReplicas counts the pods that are ready. For built-in kinds this comes from the workload's status, so we only
+// count pods that have passed their readiness checks. For custom resources we count the replicas in the scale status.
+func (k *KubernetesScheduler) readyReplicas(w workload) (int, error) {
+	if w.readyField == "" {
+		b, err := k.getScale(w)
+		if err != nil {
+			return 0, err
+		}
+
+		var scale scaleStatus
+		err = json.Unmarshal(b, &scale)
+		return scale.Status.Replicas, err
+	}
+
+	b, err := k.clientset.Core().GetRESTClient().Get().AbsPath(w.path).Do().Raw()
+	if err != nil {
+		return 0, err
+	}
+
+	// Fields that are 0 are left out of the status
+	var obj struct {
+		Status map[string]interface{} `json:"status"`
+	}
+	err = json.Unmarshal(b, &obj)
+	if err != nil {
+		return 0, err
+	}
+
+	ready, _ := obj.Status[w.readyField].(float64)
+	return int(ready), nil
+}
@@ -0,0 +1,275 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	// The API server ends each watch after this long, and we start another one
+	constWatchTimeout = 5 * time.Minute
+	// How long to wait before listing again if the watch fails
+	constWatchRetryInterval = 5 * time.Second
+)
+
+// workloadCache holds the state of the workloads in one collection, e.g. the deployments in our namespace. It's kept up
+// to date by a watch, so we don't need to ask the API server every time we count pods.
+type workloadCache struct {
+	synced  bool
+	objects map[string]workloadStatus // indexed by name
+	stream  io.ReadCloser             // the current watch, so we can close it on cleanup
+}
+
+// workloadStatus is what we need to know about a workload to count its pods and tell when a rollout has finished
+type workloadStatus struct {
+	replicas int
+	ready    int
+	// The controller has seen the latest change to the spec
+	observed bool
+}
+
+func (s workloadStatus) rolledOut() bool {
+	return s.observed && s.ready == s.replicas
+}
+
+// workloadObject is the part of any workload that we read
+type workloadObject struct {
+	Metadata struct {
+		Name       string `json:"name"`
+		Generation int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int `json:"replicas"`
+	} `json:"spec"`
+	Status map[string]interface{} `json:"status"`
+}
+
+// workloadList is the response to listing a collection
+type workloadList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []workloadObject `json:"items"`
+}
+
+// workloadEvent is a change to a workload, from the watch
+type workloadEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// status reads the workload's replicas. Fields that are 0 are left out of the status.
+func (o *workloadObject) status(readyField string) workloadStatus {
+	// Replicas defaults to 1 if it isn't set
+	replicas := 1
+	if o.Spec.Replicas != nil {
+		replicas = *o.Spec.Replicas
+	}
+
+	ready, _ := o.Status[readyField].(float64)
+	observedGeneration, _ := o.Status["observedGeneration"].(float64)
+
+	return workloadStatus{
+		replicas: replicas,
+		ready:    int(ready),
+		observed: int64(observedGeneration) >= o.Metadata.Generation,
+	}
+}
+
+// startWatch starts keeping a cache of the workloads in this collection, if we aren't already
+func (k *KubernetesScheduler) startWatch(w workload) {
+	k.Lock()
+	defer k.Unlock()
+
+	if _, ok := k.caches[w.collection]; ok || k.stopped {
+		return
+	}
+
+	k.caches[w.collection] = &workloadCache{}
+	go k.watchWorkloads(w)
+}
+
+// watchWorkloads lists the collection and then watches it for changes, until Cleanup is called. If the watch fails we
+// list the collection again, as we may have missed changes.
+func (k *KubernetesScheduler) watchWorkloads(w workload) {
+	for {
+		resourceVersion, err := k.listWorkloads(w)
+		if err == nil {
+			err = k.streamWorkloads(w, resourceVersion)
+		}
+
+		k.Lock()
+		k.caches[w.collection].synced = false
+		k.caches[w.collection].stream = nil
+		stopped := k.stopped
+		k.Unlock()
+
+		if stopped {
+			return
+		}
+
+		// The API server ends the watch after the timeout, and we can carry straight on
+		if err == io.EOF {
+			continue
+		}
+
+		log.Errorf("Watch on %s failed: %v", w.collection, err)
+
+		select {
+		case <-k.stop:
+			return
+		case <-time.After(constWatchRetryInterval):
+		}
+	}
+}
+
+// listWorkloads fills the cache for the collection, and returns the resource version to watch from
+func (k *KubernetesScheduler) listWorkloads(w workload) (string, error) {
+	req := k.clientset.Core().GetRESTClient().Get().AbsPath(w.collection)
+	if k.labelSelector != "" {
+		req = req.Param("labelSelector", k.labelSelector)
+	}
+
+	b, err := req.Do().Raw()
+	if err != nil {
+		return "", err
+	}
+
+	var list workloadList
+	err = json.Unmarshal(b, &list)
+	if err != nil {
+		return "", err
+	}
+
+	objects := make(map[string]workloadStatus, len(list.Items))
+	for _, o := range list.Items {
+		objects[o.Metadata.Name] = o.status(w.readyField)
+	}
+
+	k.Lock()
+	cache := k.caches[w.collection]
+	previous := cache.objects
+	cache.objects = objects
+	cache.synced = true
+	k.Unlock()
+
+	// We may have missed rollouts finishing while we weren't watching
+	for name, s := range objects {
+		if was, ok := previous[name]; ok && !was.rolledOut() && s.rolledOut() {
+			k.rolloutFinished(name)
+		}
+	}
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+// streamWorkloads updates the cache from the watch until it ends
+func (k *KubernetesScheduler) streamWorkloads(w workload, resourceVersion string) error {
+	req := k.clientset.Core().GetRESTClient().Get().AbsPath(w.collection).
+		Param("watch", "true").
+		Param("resourceVersion", resourceVersion).
+		Param("timeoutSeconds", strconv.Itoa(int(constWatchTimeout/time.Second)))
+	if k.labelSelector != "" {
+		req = req.Param("labelSelector", k.labelSelector)
+	}
+
+	stream, err := req.Stream()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	k.Lock()
+	if k.stopped {
+		k.Unlock()
+		return nil
+	}
+	k.caches[w.collection].stream = stream
+	k.Unlock()
+	log.Debugf("Watching %s", w.collection)
+
+	decoder := json.NewDecoder(stream)
+	for {
+		var event workloadEvent
+		err = decoder.Decode(&event)
+		if err != nil {
+			return err
+		}
+
+		// An error, such as the resource version being too old, means we need to list again
+		if event.Type == "ERROR" {
+			return fmt.Errorf("Watch error %s", string(event.Object))
+		}
+
+		var o workloadObject
+		err = json.Unmarshal(event.Object, &o)
+		if err != nil {
+			return err
+		}
+
+		k.handleWorkloadEvent(w, event.Type, &o)
+	}
+}
+
+// handleWorkloadEvent updates the cache, and lets the scheduler know if a rollout has just finished
+func (k *KubernetesScheduler) handleWorkloadEvent(w workload, eventType string, o *workloadObject) {
+	name := o.Metadata.Name
+	log.Debugf("[watch] %s %s/%s", eventType, w.collection, name)
+
+	k.Lock()
+	objects := k.caches[w.collection].objects
+	was, known := objects[name]
+	s := o.status(w.readyField)
+
+	switch eventType {
+	case "ADDED", "MODIFIED":
+		objects[name] = s
+	case "DELETED":
+		delete(objects, name)
+	}
+	k.Unlock()
+
+	if eventType == "MODIFIED" && known && !was.rolledOut() && s.rolledOut() {
+		k.rolloutFinished(name)
+	}
+}
+
+// rolloutFinished triggers a demand update, as the task may have been waiting for its previous scaling to complete
+func (k *KubernetesScheduler) rolloutFinished(name string) {
+	log.Debugf("Rollout of %s finished", name)
+
+	k.Lock()
+	defer k.Unlock()
+
+	// Cleanup is called before the demand update channel is closed, so we mustn't send on it once we've stopped
+	if k.stopped {
+		return
+	}
+
+	select {
+	case k.demandUpdate <- struct{}{}:
+	default:
+		// There's already a demand update waiting to be handled
+	}
+}
+
+// cachedReadyReplicas gets the ready count from the cache, if the cache is synced
+func (k *KubernetesScheduler) cachedReadyReplicas(w workload) (ready int, ok bool, err error) {
+	k.Lock()
+	defer k.Unlock()
+
+	cache, watching := k.caches[w.collection]
+	if !watching || !cache.synced {
+		return 0, false, nil
+	}
+
+	s, found := cache.objects[w.name]
+	if !found {
+		return 0, true, fmt.Errorf("No workload %s matching label selector %q", w.path, k.labelSelector)
+	}
+
+	return s.ready, true, nil
+}
@@ -157,6 +157,7 @@ func (m *MarathonScheduler) CountAllTasks(running *demand.Tasks) error {
 	tasks := running.Tasks
 	for _, t := range tasks {
 		t.Running = appCounts[t.Name]
+		t.Healthy = t.Running
 	}
 
 	return err
@@ -219,6 +220,6 @@ func getBaseMarathonURL(marathonAPI string) string {
 
 // Cleanup gives the scheduler an opportunity to stop anything that needs to be stopped
 func (m *MarathonScheduler) Cleanup() error {
-	m.backoff.Stop()
+	m.backoff.Close()
 	return nil
 }
@@ -0,0 +1,340 @@
+// Package nomad provides a scheduler using the Nomad HTTP API.
+package nomad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/scheduler"
+	"github.com/microscaling/microscaling/utils"
+)
+
+var log = logging.MustGetLogger("mssscheduler")
+
+// NomadScheduler scales the count of a task group within a Nomad job. The task name is the job ID.
+type NomadScheduler struct {
+	baseNomadURL string
+	token        string
+	demandUpdate chan struct{}
+	backoff      *utils.Backoff
+
+	// The task group we scale for each task
+	groups     map[string]string
+	groupsLock sync.RWMutex
+}
+
+// Job from the Nomad API.
+type Job struct {
+	ID         string      `json:"ID"`
+	TaskGroups []TaskGroup `json:"TaskGroups"`
+}
+
+// TaskGroup from the Nomad API.
+type TaskGroup struct {
+	Name  string `json:"Name"`
+	Count int    `json:"Count"`
+}
+
+// Allocation from the Nomad API.
+type Allocation struct {
+	ID           string `json:"ID"`
+	TaskGroup    string `json:"TaskGroup"`
+	ClientStatus string `json:"ClientStatus"`
+}
+
+// Deployment from the Nomad API.
+type Deployment struct {
+	ID     string `json:"ID"`
+	Status string `json:"Status"`
+}
+
+type scalePayload struct {
+	Count   int               `json:"Count"`
+	Target  map[string]string `json:"Target"`
+	Message string            `json:"Message"`
+}
+
+var (
+	httpClient = &http.Client{
+		// TODO Make timeout configurable.
+		Timeout: 10 * time.Second,
+	}
+)
+
+// NewScheduler returns a pointer to the scheduler. The token is sent with each request if ACLs are enabled.
+func NewScheduler(nomadAPI string, token string, demandUpdate chan struct{}) *NomadScheduler {
+	return &NomadScheduler{
+		baseNomadURL: strings.TrimSuffix(nomadAPI, "/") + "/v1/",
+		token:        token,
+		demandUpdate: demandUpdate,
+		backoff: &utils.Backoff{
+			Min:    250 * time.Millisecond,
+			Max:    5 * time.Second,
+			Factor: 2,
+		},
+		groups: make(map[string]string),
+	}
+}
+
+// compile-time assert that we implement the right interface
+var _ scheduler.Scheduler = (*NomadScheduler)(nil)
+
+// InitScheduler checks the job exists and finds the task group to scale. If the job has more than one task group,
+// we scale the one with the same name as the job.
+func (n *NomadScheduler) InitScheduler(task *demand.Task) error {
+	log.Infof("Nomad initializing task %s", task.Name)
+
+	var job Job
+	status, err := n.get("job/"+url.QueryEscape(task.Name), &job)
+	if err != nil {
+		return err
+	}
+
+	if status == http.StatusNotFound {
+		return fmt.Errorf("Nomad job %s not found", task.Name)
+	}
+
+	group, err := scalingGroup(job)
+	if err != nil {
+		return err
+	}
+
+	n.groupsLock.Lock()
+	n.groups[task.Name] = group
+	n.groupsLock.Unlock()
+
+	log.Debugf("Scaling task group %s of Nomad job %s", group, task.Name)
+	return nil
+}
+
+func scalingGroup(job Job) (string, error) {
+	if len(job.TaskGroups) == 1 {
+		return job.TaskGroups[0].Name, nil
+	}
+
+	for _, g := range job.TaskGroups {
+		if g.Name == job.ID {
+			return g.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("Nomad job %s has %d task groups, and none has the same name as the job", job.ID, len(job.TaskGroups))
+}
+
+// StopStartTasks by calling the Nomad scaling API.
+func (n *NomadScheduler) StopStartTasks(tasks *demand.Tasks) error {
+	// Create tasks if there aren't enough of them, and stop them if there are too many
+	var tooMany []*demand.Task
+	var tooFew []*demand.Task
+	var err error
+
+	// Check we're not already backed off. This could easily happen if we get a demand update arrive while we are in the midst
+	// of a previous backoff.
+	if n.backoff.Waiting() {
+		log.Debug("Backoff timer still running")
+		return nil
+	}
+
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	for _, task := range tasks.Tasks {
+		if task.Demand > task.Requested {
+			tooFew = append(tooFew, task)
+		}
+		if task.Demand < task.Requested {
+			tooMany = append(tooMany, task)
+		}
+	}
+
+	// Concatentate the two lists - scale down first to free up resources
+	tasksToScale := append(tooMany, tooFew...)
+	for _, task := range tasksToScale {
+		blocked, err := n.stopStartTask(task)
+		if blocked {
+			// The job has a deployment in progress, so trigger a new scaling operation after a backoff delay
+			err = n.backoff.Backoff(n.demandUpdate)
+			return err
+		}
+
+		if err != nil {
+			log.Errorf("Couldn't scale %s: %v ", task.Name, err)
+			return err
+		}
+
+		// Clear any backoffs on success
+		n.backoff.Reset()
+		log.Debugf("Now have %s: %d", task.Name, task.Requested)
+	}
+
+	return err
+}
+
+// stopStartTask updates the count of the task group, unless the job is being deployed.
+func (n *NomadScheduler) stopStartTask(task *demand.Task) (blocked bool, err error) {
+	group, err := n.group(task.Name)
+	if err != nil {
+		return false, err
+	}
+
+	var deployment *Deployment
+	_, err = n.get("job/"+url.QueryEscape(task.Name)+"/deployment", &deployment)
+	if err != nil {
+		return false, err
+	}
+
+	if deployment != nil && deploymentActive(deployment.Status) {
+		log.Debugf("Deployment %s of %s is %s", deployment.ID, task.Name, deployment.Status)
+		return true, nil
+	}
+
+	payload := scalePayload{
+		Count:   task.Demand,
+		Target:  map[string]string{"Group": group},
+		Message: "Scaled by microscaling",
+	}
+
+	status, body, err := n.post("job/"+url.QueryEscape(task.Name)+"/scale", &payload)
+	if err != nil {
+		return false, err
+	}
+
+	if status != http.StatusOK {
+		return false, fmt.Errorf("Error response code %d from Nomad API: %s", status, strings.TrimSpace(string(body)))
+	}
+
+	task.Requested = task.Demand
+	return false, nil
+}
+
+func deploymentActive(status string) bool {
+	switch status {
+	case "running", "pending", "paused":
+		return true
+	default:
+		return false
+	}
+}
+
+// CountAllTasks tells us how many allocations of each task group are running.
+func (n *NomadScheduler) CountAllTasks(running *demand.Tasks) error {
+	running.Lock()
+	defer running.Unlock()
+
+	for _, t := range running.Tasks {
+		group, err := n.group(t.Name)
+		if err != nil {
+			return err
+		}
+
+		var allocations []Allocation
+		status, err := n.get("job/"+url.QueryEscape(t.Name)+"/allocations", &allocations)
+		if err != nil {
+			log.Errorf("Error getting allocations for %s: %v", t.Name, err)
+			return err
+		}
+
+		// Defaults to 0 if the job does not exist
+		count := 0
+		if status == http.StatusOK {
+			for _, a := range allocations {
+				if a.TaskGroup == group && a.ClientStatus == "running" {
+					count++
+				}
+			}
+		}
+
+		t.Running = count
+		t.Healthy = count
+	}
+
+	return nil
+}
+
+// Cleanup gives the scheduler an opportunity to stop anything that needs to be stopped
+func (n *NomadScheduler) Cleanup() error {
+	n.backoff.Close()
+	return nil
+}
+
+func (n *NomadScheduler) group(taskName string) (string, error) {
+	n.groupsLock.RLock()
+	defer n.groupsLock.RUnlock()
+
+	group, ok := n.groups[taskName]
+	if !ok {
+		return "", fmt.Errorf("Task %s has not been initialized with Nomad", taskName)
+	}
+
+	return group, nil
+}
+
+// get decodes the response into v if the request succeeds. A not found response isn't an error, so that callers
+// can decide what it means.
+func (n *NomadScheduler) get(path string, v interface{}) (status int, err error) {
+	req, err := http.NewRequest("GET", n.baseNomadURL+path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	status, body, err := n.do(req)
+	if err != nil {
+		return status, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		err = json.Unmarshal(body, v)
+		if err != nil {
+			log.Errorf("Error %v unmarshalling from %s", err, string(body[:]))
+		}
+	case http.StatusNotFound:
+	default:
+		err = fmt.Errorf("Error response code %d from Nomad API: %s", status, strings.TrimSpace(string(body)))
+	}
+
+	return status, err
+}
+
+func (n *NomadScheduler) post(path string, payload interface{}) (status int, body []byte, err error) {
+	w := &bytes.Buffer{}
+	err = json.NewEncoder(w).Encode(payload)
+	if err != nil {
+		log.Errorf("Failed to encode json. %v", err)
+		return 0, nil, err
+	}
+
+	log.Debugf("Scale POST: %s", n.baseNomadURL+path)
+	req, err := http.NewRequest("POST", n.baseNomadURL+path, w)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return n.do(req)
+}
+
+func (n *NomadScheduler) do(req *http.Request) (status int, body []byte, err error) {
+	if n.token != "" {
+		req.Header.Set("X-Nomad-Token", n.token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
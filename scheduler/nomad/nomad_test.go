@@ -0,0 +1,219 @@
+package nomad
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+// fakeNomad is a stand-in for the parts of the Nomad API we use
+type fakeNomad struct {
+	sync.Mutex
+	jobs        map[string]Job
+	allocations map[string][]Allocation
+	deployments map[string]string
+	scaled      map[string]int
+	token       string
+}
+
+func (f *fakeNomad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("X-Nomad-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Permission denied"))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/job/"), "/")
+	job, ok := f.jobs[parts[0]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("job not found"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		json.NewEncoder(w).Encode(job)
+
+	case parts[1] == "allocations" && r.Method == "GET":
+		json.NewEncoder(w).Encode(f.allocations[job.ID])
+
+	case parts[1] == "deployment" && r.Method == "GET":
+		if status, ok := f.deployments[job.ID]; ok {
+			json.NewEncoder(w).Encode(Deployment{ID: "d1", Status: status})
+		} else {
+			w.Write([]byte("null"))
+		}
+
+	case parts[1] == "scale" && r.Method == "POST":
+		var payload scalePayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Target["Group"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("missing task group name"))
+			return
+		}
+
+		f.scaled[job.ID+"/"+payload.Target["Group"]] = payload.Count
+		w.Write([]byte(`{"EvalID":"e1","EvalCreateIndex":10,"JobModifyIndex":10}`))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeNomad() *fakeNomad {
+	return &fakeNomad{
+		jobs: map[string]Job{
+			"web":    Job{ID: "web", TaskGroups: []TaskGroup{{Name: "frontend", Count: 2}}},
+			"worker": Job{ID: "worker", TaskGroups: []TaskGroup{{Name: "cache", Count: 1}, {Name: "worker", Count: 3}}},
+			"multi":  Job{ID: "multi", TaskGroups: []TaskGroup{{Name: "a"}, {Name: "b"}}},
+		},
+		allocations: map[string][]Allocation{
+			"web": []Allocation{
+				{ID: "1", TaskGroup: "frontend", ClientStatus: "running"},
+				{ID: "2", TaskGroup: "frontend", ClientStatus: "running"},
+				{ID: "3", TaskGroup: "frontend", ClientStatus: "complete"},
+			},
+			"worker": []Allocation{
+				{ID: "4", TaskGroup: "cache", ClientStatus: "running"},
+				{ID: "5", TaskGroup: "worker", ClientStatus: "running"},
+				{ID: "6", TaskGroup: "worker", ClientStatus: "pending"},
+			},
+		},
+		deployments: make(map[string]string),
+		scaled:      make(map[string]int),
+		token:       "secret",
+	}
+}
+
+func TestNomadInitScheduler(t *testing.T) {
+	f := newFakeNomad()
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	n := NewScheduler(server.URL, "secret", make(chan struct{}, 1))
+
+	tests := []struct {
+		name   string
+		group  string
+		expErr bool
+	}{
+		{name: "web", group: "frontend"},
+		{name: "worker", group: "worker"},
+		{name: "multi", expErr: true},
+		{name: "missing", expErr: true},
+	}
+
+	for _, test := range tests {
+		err := n.InitScheduler(&demand.Task{Name: test.name})
+		if test.expErr {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.name, err)
+		}
+
+		if group, _ := n.group(test.name); group != test.group {
+			t.Errorf("Expected group %s for %s, got %s", test.group, test.name, group)
+		}
+	}
+
+	n = NewScheduler(server.URL, "wrong", make(chan struct{}, 1))
+	if err := n.InitScheduler(&demand.Task{Name: "web"}); err == nil {
+		t.Errorf("Expected an error with the wrong token")
+	}
+}
+
+func TestNomadScaling(t *testing.T) {
+	f := newFakeNomad()
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	demandUpdate := make(chan struct{}, 1)
+	n := NewScheduler(server.URL, "secret", demandUpdate)
+	defer n.Cleanup()
+
+	web := &demand.Task{Name: "web"}
+	worker := &demand.Task{Name: "worker"}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{web, worker}}
+
+	for _, task := range tasks.Tasks {
+		if err := n.InitScheduler(task); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	err := n.CountAllTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if web.Running != 2 || worker.Running != 1 {
+		t.Errorf("Expected 2 and 1 running, got %d and %d", web.Running, worker.Running)
+	}
+
+	web.Requested = 2
+	web.Demand = 4
+	worker.Requested = 1
+	worker.Demand = 0
+
+	err = n.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if f.scaled["web/frontend"] != 4 || f.scaled["worker/worker"] != 0 || len(f.scaled) != 2 {
+		t.Errorf("Unexpected scaling %v", f.scaled)
+	}
+
+	if web.Requested != 4 || worker.Requested != 0 {
+		t.Errorf("Expected requested to match demand, got %d and %d", web.Requested, worker.Requested)
+	}
+
+	// We don't scale while a deployment is in progress, but try again after backing off
+	f.Lock()
+	f.deployments["web"] = "running"
+	f.Unlock()
+
+	web.Demand = 6
+	err = n.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if web.Requested != 4 || f.scaled["web/frontend"] != 4 {
+		t.Errorf("Expected no scaling during a deployment")
+	}
+
+	if !n.backoff.Waiting() {
+		t.Errorf("Expected to be backing off")
+	}
+
+	<-demandUpdate
+
+	f.Lock()
+	f.deployments["web"] = "successful"
+	f.Unlock()
+
+	err = n.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if web.Requested != 6 || f.scaled["web/frontend"] != 6 {
+		t.Errorf("Expected scaling after the deployment, requested %d", web.Requested)
+	}
+}
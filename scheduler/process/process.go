@@ -0,0 +1,272 @@
+// Package process provides a scheduler that runs each task's command as a local child process, without containers.
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/op/go-logging"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/scheduler"
+)
+
+var log = logging.MustGetLogger("mssscheduler")
+
+type process struct {
+	cmd      *exec.Cmd
+	stopping bool
+	exited   chan struct{}
+}
+
+// ProcessScheduler starts and stops processes on this host. We keep track of each process by PID so we can stop them.
+type ProcessScheduler struct {
+	gracePeriod   time.Duration
+	taskProcesses map[string]map[int]*process // tasks indexed by app name, processes indexed by PID
+	sync.Mutex
+}
+
+// compile-time assert that we implement the right interfaces
+var _ scheduler.Scheduler = (*ProcessScheduler)(nil)
+var _ scheduler.ShutdownHandler = (*ProcessScheduler)(nil)
+
+// NewScheduler returns a pointer to the scheduler. Processes that don't exit within the grace period after
+// SIGTERM are killed.
+func NewScheduler(gracePeriod time.Duration) *ProcessScheduler {
+	return &ProcessScheduler{
+		gracePeriod:   gracePeriod,
+		taskProcesses: make(map[string]map[int]*process),
+	}
+}
+
+// InitScheduler checks we can find the task's command
+func (p *ProcessScheduler) InitScheduler(task *demand.Task) error {
+	log.Infof("Process initializing task %s", task.Name)
+
+	args := strings.Fields(task.Command)
+	if len(args) == 0 {
+		return fmt.Errorf("No command for task %s", task.Name)
+	}
+
+	_, err := exec.LookPath(args[0])
+	if err != nil {
+		return fmt.Errorf("Can't run command for task %s: %v", task.Name, err)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.taskProcesses[task.Name]; !ok {
+		p.taskProcesses[task.Name] = make(map[int]*process)
+	}
+
+	return nil
+}
+
+// StopStartTasks starts processes if there aren't enough of them, and stops them if there are too many
+func (p *ProcessScheduler) StopStartTasks(tasks *demand.Tasks) error {
+	var tooMany []*demand.Task
+	var tooFew []*demand.Task
+
+	tasks.Lock()
+	for _, task := range tasks.Tasks {
+		if task.Demand > task.Requested {
+			tooFew = append(tooFew, task)
+		}
+		if task.Demand < task.Requested {
+			tooMany = append(tooMany, task)
+		}
+	}
+
+	// Scale down first to free up resources. Processes are stopped in parallel so we only wait for one grace period.
+	var stopping sync.WaitGroup
+	for _, task := range tooMany {
+		diff := task.Requested - task.Demand
+		log.Infof("Stop %d of task %s", diff, task.Name)
+		for i := 0; i < diff; i++ {
+			proc := p.chooseProcess(task.Name)
+			if proc != nil {
+				stopping.Add(1)
+				go func(proc *process) {
+					defer stopping.Done()
+					p.stopProcess(proc)
+				}(proc)
+			}
+
+			task.Requested--
+		}
+	}
+	tasks.Unlock()
+
+	// Processes can take the whole grace period to stop, so we don't hold the lock while we wait for them
+	stopping.Wait()
+
+	// Now we can scale up. Demand may have changed while we were waiting.
+	tasks.Lock()
+	defer tasks.Unlock()
+	for _, task := range tooFew {
+		diff := task.Demand - task.Requested
+		log.Infof("Start %d of task %s", diff, task.Name)
+		for i := 0; i < diff; i++ {
+			err := p.startProcess(task)
+			if err != nil {
+				log.Errorf("Couldn't start %s: %v", task.Name, err)
+				return err
+			}
+
+			task.Requested++
+		}
+	}
+
+	return nil
+}
+
+// startProcess runs the task's command with the task's environment, which already includes ours
+func (p *ProcessScheduler) startProcess(task *demand.Task) error {
+	args := strings.Fields(task.Command)
+	if len(args) == 0 {
+		return fmt.Errorf("No command for task %s", task.Name)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = task.Env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	proc := &process{
+		cmd:    cmd,
+		exited: make(chan struct{}),
+	}
+
+	pid := cmd.Process.Pid
+	p.Lock()
+	if _, ok := p.taskProcesses[task.Name]; !ok {
+		p.taskProcesses[task.Name] = make(map[int]*process)
+	}
+	p.taskProcesses[task.Name][pid] = proc
+	p.Unlock()
+	log.Debugf("[started] task %s PID %d", task.Name, pid)
+
+	// Reap the process when it exits, however that happens
+	go func() {
+		err := cmd.Wait()
+
+		p.Lock()
+		if err != nil && !proc.stopping {
+			log.Errorf("Process %d for task %s exited: %v", pid, task.Name, err)
+		}
+		delete(p.taskProcesses[task.Name], pid)
+		p.Unlock()
+
+		close(proc.exited)
+	}()
+
+	return nil
+}
+
+// chooseProcess picks a process of this task that we haven't already asked to stop
+func (p *ProcessScheduler) chooseProcess(taskName string) *process {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, proc := range p.taskProcesses[taskName] {
+		if !proc.stopping {
+			proc.stopping = true
+			return proc
+		}
+	}
+
+	log.Errorf("[stop] No processes of task %s to stop", taskName)
+	return nil
+}
+
+// stopProcess sends SIGTERM, and SIGKILL if the process is still running after the grace period
+func (p *ProcessScheduler) stopProcess(proc *process) {
+	pid := proc.cmd.Process.Pid
+	log.Debugf("[stopping] PID %d", pid)
+
+	err := proc.cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil {
+		log.Debugf("Couldn't send SIGTERM to PID %d: %v", pid, err)
+	}
+
+	select {
+	case <-proc.exited:
+		return
+	case <-time.After(p.gracePeriod):
+	}
+
+	log.Infof("PID %d didn't exit within %v, killing it", pid, p.gracePeriod)
+	err = proc.cmd.Process.Kill()
+	if err != nil {
+		log.Errorf("Couldn't kill PID %d: %v", pid, err)
+	}
+
+	<-proc.exited
+}
+
+// CountAllTasks tells us how many processes of each task are running
+func (p *ProcessScheduler) CountAllTasks(running *demand.Tasks) error {
+	running.Lock()
+	defer running.Unlock()
+	p.Lock()
+	defer p.Unlock()
+
+	for _, t := range running.Tasks {
+		count := 0
+		for _, proc := range p.taskProcesses[t.Name] {
+			if !proc.stopping {
+				count++
+			}
+		}
+
+		t.Running = count
+		t.Healthy = count
+	}
+
+	return nil
+}
+
+// Cleanup doesn't need to do anything, as we don't trigger demand updates
+func (p *ProcessScheduler) Cleanup() error {
+	return nil
+}
+
+// Shutdown stops any processes that are still running once the shutdown policies have been applied. Nothing else will
+// be looking after them, and a restarted agent can't adopt them.
+func (p *ProcessScheduler) Shutdown() error {
+	var procs []*process
+
+	p.Lock()
+	for _, processes := range p.taskProcesses {
+		for _, proc := range processes {
+			if !proc.stopping {
+				proc.stopping = true
+				procs = append(procs, proc)
+			}
+		}
+	}
+	p.Unlock()
+
+	var stopping sync.WaitGroup
+	for _, proc := range procs {
+		stopping.Add(1)
+		go func(proc *process) {
+			defer stopping.Done()
+			p.stopProcess(proc)
+		}(proc)
+	}
+	stopping.Wait()
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+// writeScript creates an executable shell script in dir
+func writeScript(t *testing.T, dir string, name string, script string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755)
+	if err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	return path
+}
+
+func TestProcessInitScheduler(t *testing.T) {
+	p := NewScheduler(time.Second)
+
+	tests := []struct {
+		command string
+		pass    bool
+	}{
+		{command: "sleep 10", pass: true},
+		{command: "", pass: false},
+		{command: "/no/such/command", pass: false},
+	}
+
+	for _, test := range tests {
+		err := p.InitScheduler(&demand.Task{Name: "task", Command: test.command})
+		if (err == nil) != test.pass {
+			t.Errorf("Unexpected result initializing %q: %v", test.command, err)
+		}
+	}
+}
+
+func TestProcessScaling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microscaling")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "env")
+	script := writeScript(t, dir, "env.sh", "echo $GREETING >> "+out+"\nexec sleep 30\n")
+
+	p := NewScheduler(5 * time.Second)
+	task := &demand.Task{Name: "sleeper", Command: script, Env: []string{"PATH=" + os.Getenv("PATH"), "GREETING=hello"}}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{task}}
+
+	err = p.InitScheduler(task)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	task.Demand = 3
+	err = p.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	p.CountAllTasks(tasks)
+	if task.Requested != 3 || task.Running != 3 {
+		t.Errorf("Expected 3 requested and running, got %d and %d", task.Requested, task.Running)
+	}
+
+	// Each process gets the task's environment
+	for i := 0; i < 50; i++ {
+		b, _ := ioutil.ReadFile(out)
+		if strings.Count(string(b), "hello\n") == 3 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	b, _ := ioutil.ReadFile(out)
+	if strings.Count(string(b), "hello\n") != 3 {
+		t.Errorf("Expected environment to be passed to each process, got %q", string(b))
+	}
+
+	// sleep exits on SIGTERM, so we shouldn't have to wait for the grace period
+	task.Demand = 1
+	start := time.Now()
+	err = p.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Took too long to stop processes that exit on SIGTERM")
+	}
+
+	p.CountAllTasks(tasks)
+	if task.Requested != 1 || task.Running != 1 {
+		t.Errorf("Expected 1 requested and running, got %d and %d", task.Requested, task.Running)
+	}
+
+	// Processes the shutdown policy left running are stopped when we exit
+	p.Shutdown()
+	p.CountAllTasks(tasks)
+	if task.Running != 0 {
+		t.Errorf("Expected none running after shutdown, got %d", task.Running)
+	}
+}
+
+func TestProcessKilledAfterGracePeriod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microscaling")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ready := filepath.Join(dir, "ready")
+	script := writeScript(t, dir, "stubborn.sh", "trap '' TERM\ntouch "+ready+"\nwhile true; do sleep 0.1; done\n")
+
+	p := NewScheduler(200 * time.Millisecond)
+	task := &demand.Task{Name: "stubborn", Command: script, Demand: 1}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{task}}
+
+	err = p.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Wait until the trap is set
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	task.Demand = 0
+	start := time.Now()
+	done := make(chan error)
+	go func() {
+		done <- p.StopStartTasks(tasks)
+	}()
+
+	// We don't hold the tasks lock while we wait for the process to stop
+	time.Sleep(50 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		tasks.Lock()
+		tasks.Unlock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("Expected the tasks lock to be free during the grace period")
+	}
+
+	err = <-done
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if time.Since(start) < 200*time.Millisecond {
+		t.Errorf("Expected to wait for the grace period before killing the process")
+	}
+
+	p.CountAllTasks(tasks)
+	if task.Running != 0 {
+		t.Errorf("Expected the process to be killed, %d running", task.Running)
+	}
+}
@@ -0,0 +1,152 @@
+// Package swarm provides a scheduler using Docker Swarm mode services. Each task is a replicated Swarm service.
+package swarm
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/op/go-logging"
+
+	"github.com/microscaling/microscaling/demand"
+	"github.com/microscaling/microscaling/scheduler"
+)
+
+var log = logging.MustGetLogger("mssscheduler")
+
+// SwarmScheduler scales the replicas of Swarm services through the Docker Engine API of a manager node.
+type SwarmScheduler struct {
+	client *docker.Client
+}
+
+// compile-time assert that we implement the right interface
+var _ scheduler.Scheduler = (*SwarmScheduler)(nil)
+
+// NewScheduler returns a pointer to the scheduler. The Docker host must be a Swarm manager.
+func NewScheduler(dockerHost string) *SwarmScheduler {
+	client, err := docker.NewClient(dockerHost)
+	if err != nil {
+		log.Errorf("Error starting Docker client: %v", err)
+		return nil
+	}
+
+	return &SwarmScheduler{
+		client: client,
+	}
+}
+
+// InitScheduler checks the task's service exists and is replicated, as we can't scale global services.
+func (s *SwarmScheduler) InitScheduler(task *demand.Task) error {
+	log.Infof("Swarm initializing task %s", task.Name)
+
+	service, err := s.client.InspectService(task.Name)
+	if err != nil {
+		log.Errorf("Couldn't inspect Swarm service %s: %v", task.Name, err)
+		return err
+	}
+
+	if service.Spec.Mode.Replicated == nil {
+		return fmt.Errorf("Swarm service %s is not replicated", task.Name)
+	}
+
+	return nil
+}
+
+// StopStartTasks updates the number of replicas of each service that needs to scale.
+func (s *SwarmScheduler) StopStartTasks(tasks *demand.Tasks) error {
+	// Create tasks if there aren't enough of them, and stop them if there are too many
+	var tooMany []*demand.Task
+	var tooFew []*demand.Task
+
+	tasks.Lock()
+	defer tasks.Unlock()
+
+	for _, task := range tasks.Tasks {
+		if task.Demand > task.Requested {
+			tooFew = append(tooFew, task)
+		}
+		if task.Demand < task.Requested {
+			tooMany = append(tooMany, task)
+		}
+	}
+
+	// Concatentate the two lists - scale down first to free up resources
+	tasksToScale := append(tooMany, tooFew...)
+	for _, task := range tasksToScale {
+		err := s.scaleService(task.Name, task.Demand)
+		if err != nil {
+			log.Errorf("Couldn't scale %s: %v ", task.Name, err)
+			return err
+		}
+
+		task.Requested = task.Demand
+		log.Debugf("Now have %s: %d", task.Name, task.Requested)
+	}
+
+	return nil
+}
+
+// scaleService updates the replicas in the current spec of the service. Swarm rejects updates that
+// don't include the version index of the spec they're based on, so we inspect the service immediately before.
+func (s *SwarmScheduler) scaleService(name string, replicas int) error {
+	service, err := s.client.InspectService(name)
+	if err != nil {
+		return err
+	}
+
+	if service.Spec.Mode.Replicated == nil {
+		return fmt.Errorf("Swarm service %s is not replicated", name)
+	}
+
+	count := uint64(replicas)
+	spec := service.Spec
+	spec.Mode = swarm.ServiceMode{
+		Replicated: &swarm.ReplicatedService{Replicas: &count},
+	}
+
+	opts := docker.UpdateServiceOptions{
+		ServiceSpec: spec,
+		Version:     service.Version.Index,
+	}
+
+	return s.client.UpdateService(service.ID, opts)
+}
+
+// CountAllTasks tells us how many tasks of each service are running.
+func (s *SwarmScheduler) CountAllTasks(running *demand.Tasks) error {
+	running.Lock()
+	defer running.Unlock()
+
+	for _, t := range running.Tasks {
+		opts := docker.ListTasksOptions{
+			Filters: map[string][]string{
+				"service":       {t.Name},
+				"desired-state": {string(swarm.TaskStateRunning)},
+			},
+		}
+
+		swarmTasks, err := s.client.ListTasks(opts)
+		if err != nil {
+			log.Errorf("Error listing tasks for %s: %v", t.Name, err)
+			return err
+		}
+
+		// Tasks that are still starting up don't count until they are running
+		count := 0
+		for _, st := range swarmTasks {
+			if st.Status.State == swarm.TaskStateRunning {
+				count++
+			}
+		}
+
+		t.Running = count
+		t.Healthy = count
+	}
+
+	return nil
+}
+
+// Cleanup gives the scheduler an opportunity to stop anything that needs to be stopped
+func (s *SwarmScheduler) Cleanup() error {
+	return nil
+}
@@ -0,0 +1,200 @@
+package swarm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/microscaling/microscaling/demand"
+)
+
+// fakeSwarm is a stand-in for the service and task endpoints of a Swarm manager
+type fakeSwarm struct {
+	sync.Mutex
+	services map[string]*swarm.Service
+	tasks    []swarm.Task
+}
+
+func (f *fakeSwarm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch {
+	case r.URL.Path == "/tasks" && r.Method == "GET":
+		var filters map[string][]string
+		json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+
+		var tasks []swarm.Task
+		for _, t := range f.tasks {
+			s, ok := f.services[filters["service"][0]]
+			if ok && t.ServiceID == s.ID && string(t.DesiredState) == filters["desired-state"][0] {
+				tasks = append(tasks, t)
+			}
+		}
+		json.NewEncoder(w).Encode(tasks)
+
+	case strings.HasPrefix(r.URL.Path, "/services/"):
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/services/"), "/")
+		s, ok := f.service(parts[0])
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"service not found"}`))
+			return
+		}
+
+		if len(parts) == 1 && r.Method == "GET" {
+			json.NewEncoder(w).Encode(s)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "update" && r.Method == "POST" {
+			version, _ := strconv.ParseUint(r.URL.Query().Get("version"), 10, 64)
+			if version != s.Version.Index {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message":"update out of sequence"}`))
+				return
+			}
+
+			var spec swarm.ServiceSpec
+			json.NewDecoder(r.Body).Decode(&spec)
+			s.Spec = spec
+			s.Version.Index++
+			return
+		}
+
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// service looks up a service by name or ID, like the Engine API does
+func (f *fakeSwarm) service(nameOrID string) (*swarm.Service, bool) {
+	for name, s := range f.services {
+		if name == nameOrID || s.ID == nameOrID {
+			return s, true
+		}
+	}
+
+	return nil, false
+}
+
+func replicated(n uint64) swarm.ServiceMode {
+	return swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &n}}
+}
+
+func newFakeSwarm() *fakeSwarm {
+	web := &swarm.Service{ID: "s1", Spec: swarm.ServiceSpec{Mode: replicated(2)}}
+	web.Spec.Name = "web"
+	web.Version.Index = 7
+
+	agent := &swarm.Service{ID: "s2", Spec: swarm.ServiceSpec{Mode: swarm.ServiceMode{Global: &swarm.GlobalService{}}}}
+	agent.Spec.Name = "agent"
+
+	f := &fakeSwarm{
+		services: map[string]*swarm.Service{"web": web, "agent": agent},
+	}
+
+	states := []swarm.TaskState{swarm.TaskStateRunning, swarm.TaskStateRunning, swarm.TaskStateStarting}
+	for i, state := range states {
+		t := swarm.Task{ID: strconv.Itoa(i), ServiceID: "s1", DesiredState: swarm.TaskStateRunning}
+		t.Status.State = state
+		f.tasks = append(f.tasks, t)
+	}
+
+	shutdown := swarm.Task{ID: "old", ServiceID: "s1", DesiredState: swarm.TaskStateShutdown}
+	shutdown.Status.State = swarm.TaskStateRunning
+	f.tasks = append(f.tasks, shutdown)
+
+	return f
+}
+
+func TestSwarmInitScheduler(t *testing.T) {
+	server := httptest.NewServer(newFakeSwarm())
+	defer server.Close()
+
+	s := NewScheduler(server.URL)
+
+	tests := []struct {
+		name string
+		pass bool
+	}{
+		{name: "web", pass: true},
+		{name: "agent", pass: false},
+		{name: "missing", pass: false},
+	}
+
+	for _, test := range tests {
+		err := s.InitScheduler(&demand.Task{Name: test.name})
+		if (err == nil) != test.pass {
+			t.Errorf("Unexpected result initializing %s: %v", test.name, err)
+		}
+	}
+}
+
+func TestSwarmScaling(t *testing.T) {
+	f := newFakeSwarm()
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	s := NewScheduler(server.URL)
+
+	web := &demand.Task{Name: "web"}
+	tasks := &demand.Tasks{Tasks: []*demand.Task{web}}
+
+	err := s.CountAllTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if web.Running != 2 {
+		t.Errorf("Expected 2 running, got %d", web.Running)
+	}
+
+	web.Requested = 2
+	web.Demand = 5
+	err = s.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if web.Requested != 5 {
+		t.Errorf("Expected requested to match demand, got %d", web.Requested)
+	}
+
+	// Each update is based on the latest version of the spec
+	web.Demand = 1
+	err = s.StopStartTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	f.Lock()
+	service := f.services["web"]
+	if *service.Spec.Mode.Replicated.Replicas != 1 || service.Version.Index != 9 {
+		t.Errorf("Expected 1 replica at version 9, got %d at version %d", *service.Spec.Mode.Replicated.Replicas, service.Version.Index)
+	}
+
+	if service.Spec.Name != "web" {
+		t.Errorf("Expected the rest of the spec to be unchanged")
+	}
+	f.Unlock()
+
+	missing := &demand.Task{Name: "missing", Demand: 1}
+	tasks.Tasks = append(tasks.Tasks, missing)
+	err = s.StopStartTasks(tasks)
+	if err == nil {
+		t.Errorf("Expected an error scaling a missing service")
+	}
+
+	if missing.Requested != 0 {
+		t.Errorf("Requested shouldn't change after an error")
+	}
+}
@@ -49,6 +49,7 @@ func (t *ToyScheduler) CountAllTasks(running *demand.Tasks) error {
 
 	for _, task := range running.Tasks {
 		task.Running = task.Requested
+		task.Healthy = task.Requested
 	}
 	return nil
 }
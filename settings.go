@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/op/go-logging"
 	"golang.org/x/net/websocket"
@@ -13,27 +15,57 @@ import (
 	"github.com/microscaling/microscaling/engine"
 	"github.com/microscaling/microscaling/engine/localEngine"
 	"github.com/microscaling/microscaling/engine/serverEngine"
+	"github.com/microscaling/microscaling/leader"
 	"github.com/microscaling/microscaling/monitor"
 	"github.com/microscaling/microscaling/scheduler"
 	"github.com/microscaling/microscaling/scheduler/docker"
+	"github.com/microscaling/microscaling/scheduler/ecs"
 	"github.com/microscaling/microscaling/scheduler/kubernetes"
 	"github.com/microscaling/microscaling/scheduler/marathon"
+	"github.com/microscaling/microscaling/scheduler/nomad"
+	"github.com/microscaling/microscaling/scheduler/process"
+	"github.com/microscaling/microscaling/scheduler/swarm"
 	"github.com/microscaling/microscaling/scheduler/toy"
+	"github.com/microscaling/microscaling/utils"
 )
 
+// Agent ID for containers started by agents that haven't been given one with MSS_AGENT_ID
+const constDefaultAgentID = "microscaling"
+
 type settings struct {
-	schedulerType   string
-	sendMetrics     bool
-	monitorTypes    string
-	microscalingAPI string
-	userID          string
-	pullImages      bool
-	dockerHost      string
-	demandEngine    string
-	marathonAPI     string
-	config          string
-	kubeConfig      string
-	kubeNamespace   string
+	schedulerType    string
+	sendMetrics      bool
+	monitorTypes     string
+	prometheusAddr   string
+	microscalingAPI  string
+	userID           string
+	pullImages       bool
+	pullInterval     int
+	replaceUnhealthy bool
+	dockerHost       string
+	agentID          string
+	leaderIdentity   string
+	demandEngine     string
+	marathonAPI      string
+	nomadAPI         string
+	ecsCluster       string
+	nomadToken       string
+	processGrace     int
+	config           string
+	configFile       string
+	configReload     int
+	shutdownPolicy   string
+	capacity         string
+	capacityCPU      float64
+	capacityMemory   int
+	metricMaxAge     int
+	kubeConfig       string
+	kubeNamespace    string
+	kubeSelector     string
+	kubeAllNS        bool
+	leaderElection   string
+	leaderLockName   string
+	leaderLease      int
 }
 
 func initLogging() {
@@ -74,34 +106,97 @@ func getSettings() settings {
 	st.userID = getEnvOrDefault("MSS_USER_ID", "5k5gk")
 	st.sendMetrics = (getEnvOrDefault("MSS_SEND_METRICS_TO_API", "true") == "true")
 	st.monitorTypes = getEnvOrDefault("MSS_MONITOR", "SERVER")
+	st.prometheusAddr = getEnvOrDefault("MSS_PROMETHEUS_ADDRESS", ":9191")
 	st.pullImages = (getEnvOrDefault("MSS_PULL_IMAGES", "true") == "true")
+	// Pull images again every MSS_PULL_INTERVAL seconds so new containers get updated tags. 0 means we only pull on startup.
+	st.pullInterval = getEnvIntOrDefault("MSS_PULL_INTERVAL", 0)
+	// Replace Docker containers that fail their health check
+	st.replaceUnhealthy = (getEnvOrDefault("MSS_REPLACE_UNHEALTHY", "false") == "true")
 	st.dockerHost = getEnvOrDefault("DOCKER_HOST", "unix:///var/run/docker.sock")
+	// Identifies the containers this agent starts, so agents sharing a Docker host don't manage each other's containers.
+	// The default needs to stay the same when the agent restarts, so it adopts the containers it started last time.
+	st.agentID = getEnvOrDefault("MSS_AGENT_ID", constDefaultAgentID)
+	// Every agent taking part in leader election needs a different identity
+	hostname, _ := os.Hostname()
+	st.leaderIdentity = getEnvOrDefault("MSS_AGENT_ID", hostname)
 	st.demandEngine = getEnvOrDefault("MSS_DEMAND_ENGINE", "LOCAL")
 	st.marathonAPI = getEnvOrDefault("MSS_MARATHON_API", "http://localhost:8080")
+	st.nomadAPI = getEnvOrDefault("MSS_NOMAD_API", "http://localhost:4646")
+	st.ecsCluster = getEnvOrDefault("MSS_ECS_CLUSTER", "default")
+	// ACL token, if ACLs are enabled in Nomad
+	st.nomadToken = getEnvOrDefault("NOMAD_TOKEN", "")
+	// Processes are killed if they're still running MSS_PROCESS_GRACE_PERIOD seconds after SIGTERM
+	st.processGrace = getEnvIntOrDefault("MSS_PROCESS_GRACE_PERIOD", 10)
 	st.config = getEnvOrDefault("MSS_CONFIG", "SERVER")
+	st.configFile = getEnvOrDefault("MSS_CONFIG_FILE", "/etc/microscaling/config.yaml")
+	// Reload task config every MSS_CONFIG_RELOAD seconds. Config is also reloaded on SIGHUP.
+	st.configReload = getEnvIntOrDefault("MSS_CONFIG_RELOAD", 0)
 	// To run locally set kube config location. Otherwise uses the built in cluster config.
 	st.kubeConfig = getEnvOrDefault("MSS_KUBE_CONFIG", "")
 	st.kubeNamespace = getEnvOrDefault("MSS_KUBE_NAMESPACE", "default")
+	// Only watch Kubernetes workloads with these labels, e.g. microscaling=true
+	st.kubeSelector = getEnvOrDefault("MSS_KUBE_LABEL_SELECTOR", "")
+	// Annotation and policy config look in all namespaces, rather than just MSS_KUBE_NAMESPACE
+	st.kubeAllNS = (getEnvOrDefault("MSS_KUBE_ALL_NAMESPACES", "false") == "true")
+	// Run more than one agent, with only the leader scaling tasks. CONFIGMAP or LEASE picks the kind of lock object,
+	// which is created in MSS_KUBE_NAMESPACE. Empty means we always scale.
+	st.leaderElection = getEnvOrDefault("MSS_LEADER_ELECTION", "")
+	st.leaderLockName = getEnvOrDefault("MSS_LEADER_LOCK_NAME", "microscaling")
+	// A standby takes over if the leader hasn't renewed its lease for MSS_LEADER_LEASE_DURATION seconds
+	st.leaderLease = getEnvIntOrDefault("MSS_LEADER_LEASE_DURATION", 15)
+	// What to do with tasks when we exit, unless it's set in the task config
+	st.shutdownPolicy = getEnvOrDefault("MSS_SHUTDOWN_POLICY", defaultShutdownPolicy(st.schedulerType))
+	// By default we only limit the total number of containers. We can also limit CPU & memory, using
+	// values we're given or that we get from the scheduler.
+	st.capacity = getEnvOrDefault("MSS_CAPACITY", "CONTAINERS")
+	st.capacityCPU = utils.EnvFl64("MSS_CAPACITY_CPU", 0)
+	st.capacityMemory = getEnvIntOrDefault("MSS_CAPACITY_MEMORY", 0)
+	// Stop scaling a task on its metric if we haven't had a good reading for MSS_METRIC_MAX_AGE seconds
+	st.metricMaxAge = getEnvIntOrDefault("MSS_METRIC_MAX_AGE", 60)
 	return st
 }
 
+// defaultShutdownPolicy scales everything to 0 when we're starting containers directly with Docker. Orchestrators
+// are managing services that should carry on running if microscaling restarts, so we leave them as they are.
+func defaultShutdownPolicy(schedulerType string) string {
+	switch schedulerType {
+	case "DOCKER", "PROCESS", "TOY":
+		return string(demand.ScaleToZero)
+	default:
+		return string(demand.LeaveAsIs)
+	}
+}
+
 func getScheduler(st settings, demandUpdate chan struct{}) (scheduler.Scheduler, error) {
 	var s scheduler.Scheduler
 
 	switch st.schedulerType {
 	case "DOCKER":
 		log.Info("Scheduling with Docker remote API")
-		s = docker.NewScheduler(st.pullImages, st.dockerHost)
+		s = docker.NewScheduler(st.pullImages, time.Duration(st.pullInterval)*time.Second, st.replaceUnhealthy, st.dockerHost, st.agentID)
 	case "MARATHON":
 		log.Info("Scheduling with Mesos / Marathon")
 		s = marathon.NewScheduler(st.marathonAPI, demandUpdate)
 	case "ECS":
-		return nil, fmt.Errorf("Scheduling with ECS not yet supported. Tweet with hashtag #MicroscaleECS if you'd like us to add this next!")
+		log.Info("Scheduling with Amazon ECS")
+		es, err := ecs.NewScheduler(st.ecsCluster)
+		if err != nil {
+			return nil, err
+		}
+
+		s = es
 	case "KUBERNETES":
 		log.Info("Scheduling with Kubernetes")
-		s = kubernetes.NewScheduler(st.kubeConfig, st.kubeNamespace, demandUpdate)
+		s = kubernetes.NewScheduler(st.kubeConfig, st.kubeNamespace, st.kubeSelector, demandUpdate)
 	case "NOMAD":
-		return nil, fmt.Errorf("Scheduling with Nomad not yet supported. Tweet with hashtag #MicroscaleNomad if you'd like us to add this next!")
+		log.Info("Scheduling with Nomad")
+		s = nomad.NewScheduler(st.nomadAPI, st.nomadToken, demandUpdate)
+	case "PROCESS":
+		log.Info("Scheduling with local processes")
+		s = process.NewScheduler(time.Duration(st.processGrace) * time.Second)
+	case "SWARM":
+		log.Info("Scheduling with Docker Swarm services")
+		s = swarm.NewScheduler(st.dockerHost)
 	case "TOY":
 		log.Info("Scheduling with toy scheduler")
 		s = toy.NewScheduler()
@@ -116,19 +211,61 @@ func getScheduler(st settings, demandUpdate chan struct{}) (scheduler.Scheduler,
 	return s, nil
 }
 
+func getCapacity(st settings, s scheduler.Scheduler) (capacity demand.Resources, err error) {
+	switch st.capacity {
+	case "CONTAINERS":
+		// Zero means no CPU or memory limits
+	case "STATIC":
+		capacity = demand.Resources{
+			CPU:    st.capacityCPU,
+			Memory: int64(st.capacityMemory),
+		}
+	case "SCHEDULER":
+		cr, ok := s.(scheduler.CapacityReporter)
+		if !ok {
+			return capacity, fmt.Errorf("Scheduler %s can't report capacity", st.schedulerType)
+		}
+
+		capacity, err = cr.GetCapacity()
+	default:
+		return capacity, fmt.Errorf("Bad value for MSS_CAPACITY: %s", st.capacity)
+	}
+
+	return capacity, err
+}
+
 func getTasks(st settings) (tasks *demand.Tasks, err error) {
 	var c config.Config
 
 	tasks = new(demand.Tasks)
 
+	shutdownPolicy, err := demand.ParseShutdownPolicy(st.shutdownPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("Bad value for MSS_SHUTDOWN_POLICY: %v", err)
+	}
+
 	// Get the tasks that have been configured by this user
 	switch st.config {
 	case "FILE":
-		return nil, fmt.Errorf("Config file not yet supported")
+		c = config.NewFileConfig(st.configFile)
 	case "SERVER":
 		c = config.NewServerConfig(st.microscalingAPI)
 	case "HARDCODED":
 		c = config.NewHardcodedConfig()
+	case "ANNOTATION":
+		if st.schedulerType != "KUBERNETES" {
+			return nil, fmt.Errorf("Annotation config not supported for scheduler: %s", st.schedulerType)
+		}
+
+		// Gets the task config from annotations on the k8s deployments
+		c = config.NewKubeAnnotationConfig(st.kubeConfig, kubeConfigNamespace(st))
+	case "POLICY":
+		if st.schedulerType != "KUBERNETES" {
+			return nil, fmt.Errorf("Policy config not supported for scheduler: %s", st.schedulerType)
+		}
+
+		// Gets the task config from MicroscalingPolicy custom resources
+		c = config.NewKubePolicyConfig(st.kubeConfig, kubeConfigNamespace(st))
 	case "LABEL":
 		switch st.schedulerType {
 		case "DOCKER":
@@ -152,6 +289,9 @@ func getTasks(st settings) (tasks *demand.Tasks, err error) {
 
 	for _, task := range t {
 		task.Env = globalEnv
+		if task.ShutdownPolicy == "" {
+			task.ShutdownPolicy = shutdownPolicy
+		}
 		log.Debugf("%+v", task)
 	}
 
@@ -164,11 +304,49 @@ func getTasks(st settings) (tasks *demand.Tasks, err error) {
 	return tasks, err
 }
 
+// kubeConfigNamespace is where we look for task config on Kubernetes, or empty for all namespaces
+func kubeConfigNamespace(st settings) string {
+	if st.kubeAllNS {
+		return ""
+	}
+
+	return st.kubeNamespace
+}
+
+// getConfigWatcher returns a watcher if the config can tell us as soon as it changes
+func getConfigWatcher(st settings) config.Watcher {
+	switch st.config {
+	case "POLICY":
+		return config.NewKubePolicyConfig(st.kubeConfig, kubeConfigNamespace(st))
+	}
+
+	return nil
+}
+
+// getElector returns nil if we don't need leader election
+func getElector(st settings) (leader.Elector, error) {
+	switch st.leaderElection {
+	case "":
+		return nil, nil
+	case leader.ConfigMapLock, leader.LeaseLock:
+		log.Infof("Electing a leader with %s lock %s/%s", strings.ToLower(st.leaderElection), st.kubeNamespace, st.leaderLockName)
+		e, err := leader.NewKubeElector(st.kubeConfig, st.kubeNamespace, st.leaderElection, st.leaderLockName, st.leaderIdentity,
+			time.Duration(st.leaderLease)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+
+		return e, nil
+	default:
+		return nil, fmt.Errorf("Bad value for MSS_LEADER_ELECTION: %s", st.leaderElection)
+	}
+}
+
 func getDemandEngine(st settings, ws *websocket.Conn) (e engine.Engine, err error) {
 	switch st.demandEngine {
 	case "LOCAL":
 		log.Info("Calculate demand locally")
-		e = localEngine.NewEngine()
+		e = localEngine.NewEngine(time.Duration(st.metricMaxAge) * time.Second)
 	case "SERVER":
 		log.Info("Get demand from server")
 		e = serverEngine.NewEngine(ws)
@@ -186,6 +364,19 @@ func getMonitors(st settings, ws *websocket.Conn) (m []monitor.Monitor) {
 		m = append(m, ms)
 	}
 
+	if strings.Contains(st.monitorTypes, "PROMETHEUS") {
+		log.Infof("Serving Prometheus metrics on %s/metrics", st.prometheusAddr)
+		mp := monitor.NewPrometheusMonitor(st.prometheusAddr)
+		m = append(m, mp)
+	}
+
+	// Policies get their status updated with the state of their tasks
+	if st.config == "POLICY" {
+		log.Info("Writing task state to MicroscalingPolicy status")
+		mk := monitor.NewKubePolicyMonitor(st.kubeConfig)
+		m = append(m, mk)
+	}
+
 	return
 }
 
@@ -197,3 +388,18 @@ func getEnvOrDefault(name string, defaultValue string) string {
 
 	return v
 }
+
+func getEnvIntOrDefault(name string, defaultValue int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Warningf("Bad value for %s, using default %d", name, defaultValue)
+		return defaultValue
+	}
+
+	return i
+}
@@ -32,7 +32,9 @@ func TestInitScheduler(t *testing.T) {
 		{sched: "ECS", pass: false},
 		{sched: "KUBERNETES", pass: true},
 		{sched: "MESOS", pass: false},
-		{sched: "NOMAD", pass: false},
+		{sched: "NOMAD", pass: true},
+		{sched: "PROCESS", pass: true},
+		{sched: "SWARM", pass: true},
 		{sched: "TOY", pass: true},
 		{sched: "BLAH", pass: false},
 	}
@@ -79,3 +81,65 @@ func TestInitConfig(t *testing.T) {
 	}
 
 }
+
+func TestShutdownPolicySetting(t *testing.T) {
+	tests := []struct {
+		sched  string
+		policy string
+	}{
+		{sched: "DOCKER", policy: "scale-to-zero"},
+		{sched: "KUBERNETES", policy: "leave-as-is"},
+		{sched: "MARATHON", policy: "leave-as-is"},
+	}
+
+	os.Unsetenv("MSS_SHUTDOWN_POLICY")
+	for _, test := range tests {
+		os.Setenv("MSS_SCHEDULER", test.sched)
+		st := getSettings()
+		if st.shutdownPolicy != test.policy {
+			t.Errorf("Expected %s to default to %s, got %s", test.sched, test.policy, st.shutdownPolicy)
+		}
+	}
+
+	os.Setenv("MSS_SHUTDOWN_POLICY", "scale-to-min")
+	st := getSettings()
+	if st.shutdownPolicy != "scale-to-min" {
+		t.Errorf("Expected the shutdown policy to be overridden")
+	}
+	os.Unsetenv("MSS_SHUTDOWN_POLICY")
+}
+
+func TestLeaderElectionSetting(t *testing.T) {
+	os.Unsetenv("MSS_LEADER_ELECTION")
+	st := getSettings()
+	if elector, err := getElector(st); elector != nil || err != nil {
+		t.Errorf("Expected no leader election by default")
+	}
+
+	os.Setenv("MSS_LEADER_ELECTION", "BLAH")
+	st = getSettings()
+	if _, err := getElector(st); err == nil {
+		t.Errorf("Expected an error for a bad lock type")
+	}
+	os.Unsetenv("MSS_LEADER_ELECTION")
+}
+
+func TestAgentIDSetting(t *testing.T) {
+	os.Unsetenv("MSS_AGENT_ID")
+	st := getSettings()
+	if st.agentID != constDefaultAgentID {
+		t.Errorf("Expected the default agent ID to stay the same across restarts, got %s", st.agentID)
+	}
+
+	hostname, _ := os.Hostname()
+	if st.leaderIdentity != hostname {
+		t.Errorf("Expected the leader identity to default to the hostname, got %s", st.leaderIdentity)
+	}
+
+	os.Setenv("MSS_AGENT_ID", "agent-a")
+	st = getSettings()
+	if st.agentID != "agent-a" || st.leaderIdentity != "agent-a" {
+		t.Errorf("Expected MSS_AGENT_ID to set both IDs, got %s and %s", st.agentID, st.leaderIdentity)
+	}
+	os.Unsetenv("MSS_AGENT_ID")
+}
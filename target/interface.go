@@ -9,6 +9,10 @@ type Target interface {
 	Meeting(int) bool
 	Exceeding(int) bool
 	Delta(int) int
+
+	// Update takes new settings from a target of the same type, keeping any state we hold. It returns false
+	// if the new target is a different type, in which case it should replace this one.
+	Update(Target) bool
 }
 
 var log = logging.MustGetLogger("msstarget")
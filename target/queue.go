@@ -63,6 +63,31 @@ func NewQueueLengthTarget(length int) *QueueLengthTarget {
 	}
 }
 
+// Gains are the constants for the PID controller
+type Gains struct {
+	KP float64
+	KI float64
+	KD float64
+}
+
+// Gains returns the constants the controller is using
+func (t *QueueLengthTarget) Gains() Gains {
+	return Gains{KP: t.kP, KI: t.kI, KD: t.kD}
+}
+
+// SetGains overrides the constants we got from the environment
+func (t *QueueLengthTarget) SetGains(g Gains) {
+	t.kP = g.KP
+	t.kI = g.KI
+	t.kD = g.KD
+	log.Debugf("[ql] set gains: kP = %f, kI = %f, kD = %f", t.kP, t.kI, t.kD)
+}
+
+// Value returns the queue length we're aiming for
+func (t *QueueLengthTarget) Value() int {
+	return t.length
+}
+
 // Meeting returns true if the target is currently met
 func (t *QueueLengthTarget) Meeting(current int) bool {
 	meeting := (current <= t.length)
@@ -141,3 +166,28 @@ func (t *QueueLengthTarget) Delta(currentLength int) (delta int) {
 	log.Debugf("[ql] => delta %d", delta)
 	return
 }
+
+// Update takes new settings from another queue length target, while keeping the controller state so that
+// we don't lose the error and velocity history
+func (t *QueueLengthTarget) Update(newTarget Target) bool {
+	n, ok := newTarget.(*QueueLengthTarget)
+	if !ok {
+		return false
+	}
+
+	t.length = n.length
+	t.minLength = n.minLength
+	t.kP = n.kP
+	t.kI = n.kI
+	t.kD = n.kD
+
+	// If the number of velocity samples has changed we need to start averaging again
+	if n.velSamples != t.velSamples {
+		t.vel = n.vel
+		t.velSamples = n.velSamples
+		t.startCount = 0
+	}
+
+	log.Debugf("[ql] updated: target %d, kP = %f, kI = %f, kD = %f", t.length, t.kP, t.kI, t.kD)
+	return true
+}
@@ -88,3 +88,42 @@ func TestQueue(t *testing.T) {
 		t.Fatalf("Bad delta (3)")
 	}
 }
+
+func TestQueueUpdate(t *testing.T) {
+	q := NewQueueLengthTarget(10)
+	q.Delta(20)
+	q.Delta(30)
+
+	cumErr := q.cumErr
+	lastLength := q.lastLength
+
+	if !q.Update(NewQueueLengthTarget(50)) {
+		t.Fatalf("Failed to update from a queue target")
+	}
+
+	if q.length != 50 || q.minLength != int(50*queueLengthExceedingPercent) {
+		t.Fatalf("Length not updated")
+	}
+
+	if q.cumErr != cumErr || q.lastLength != lastLength {
+		t.Fatalf("Controller state not preserved")
+	}
+
+	if q.Update(NewSimpleQueueLengthTarget(50)) {
+		t.Fatalf("Shouldn't update from a different type of target")
+	}
+}
+
+func TestQueueGains(t *testing.T) {
+	q := NewQueueLengthTarget(10)
+	q.SetGains(Gains{KP: 0.5, KI: 0.1, KD: 2})
+
+	if g := q.Gains(); g.KP != 0.5 || g.KI != 0.1 || g.KD != 2 {
+		t.Fatalf("Gains not set: %+v", g)
+	}
+
+	// With no velocity to start with, only the proportional and integral terms count
+	if delta := q.Delta(30); delta != 12 {
+		t.Fatalf("Expected delta 12, got %d", delta)
+	}
+}
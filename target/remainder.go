@@ -29,3 +29,14 @@ func (t *RemainderTarget) Delta(current int) (delta int) {
 	delta = t.maxContainers
 	return
 }
+
+// Update takes new settings from another remainder target
+func (t *RemainderTarget) Update(newTarget Target) bool {
+	n, ok := newTarget.(*RemainderTarget)
+	if !ok {
+		return false
+	}
+
+	t.maxContainers = n.maxContainers
+	return true
+}
@@ -23,3 +23,15 @@ func TestRemainder(t *testing.T) {
 		t.Fatalf("Remainder delta should always be maxContainers")
 	}
 }
+
+func TestRemainderUpdate(t *testing.T) {
+	r := NewRemainderTarget(100)
+
+	if !r.Update(NewRemainderTarget(20)) || r.maxContainers != 20 {
+		t.Fatalf("Failed to update max containers")
+	}
+
+	if r.Update(NewQueueLengthTarget(20)) {
+		t.Fatalf("Shouldn't update from a different type of target")
+	}
+}
@@ -16,6 +16,11 @@ func NewSimpleQueueLengthTarget(length int) *SimpleQueueLengthTarget {
 	}
 }
 
+// Value returns the queue length we're aiming for
+func (t *SimpleQueueLengthTarget) Value() int {
+	return t.length
+}
+
 // Meeting returns true if the target is currently met
 func (t *SimpleQueueLengthTarget) Meeting(current int) bool {
 	meeting := (current <= t.length)
@@ -49,3 +54,15 @@ func (t *SimpleQueueLengthTarget) Delta(currentLength int) (delta int) {
 	log.Debugf("[sql] delta %d", delta)
 	return
 }
+
+// Update takes new settings from another simple queue length target
+func (t *SimpleQueueLengthTarget) Update(newTarget Target) bool {
+	n, ok := newTarget.(*SimpleQueueLengthTarget)
+	if !ok {
+		return false
+	}
+
+	t.length = n.length
+	t.minLength = n.minLength
+	return true
+}
@@ -12,7 +12,7 @@ import (
 type Backoff struct {
 	sync.RWMutex
 	attempt, Factor int
-	waiting         bool
+	waiting, closed bool
 	Min, Max        time.Duration
 	Timer           *time.Timer
 }
@@ -47,6 +47,10 @@ func (b *Backoff) Backoff(c chan struct{}) error {
 	b.Lock()
 	defer b.Unlock()
 
+	if b.closed {
+		return fmt.Errorf("Backoff closed")
+	}
+
 	if b.waiting {
 		return fmt.Errorf("Already backing off")
 	}
@@ -62,12 +66,17 @@ func (b *Backoff) Backoff(c chan struct{}) error {
 
 	b.waiting = true
 	b.attempt++
-	b.Timer = time.NewTimer(duration)
+	timer := time.NewTimer(duration)
+	b.Timer = timer
 	go func() {
-		<-b.Timer.C
+		<-timer.C
 		log.Debug("Backff expired")
 		b.Lock()
 		defer b.Unlock()
+		// The channel may have been closed since the timer popped
+		if b.closed {
+			return
+		}
 		b.waiting = false
 		c <- struct{}{}
 	}()
@@ -86,3 +95,15 @@ func (b *Backoff) Stop() {
 	}
 	return
 }
+
+// Close stops the backoff timer for good, so we never send on the channel again. Call it before closing the channel.
+func (b *Backoff) Close() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.waiting {
+		b.Timer.Stop()
+		b.waiting = false
+	}
+	b.closed = true
+}
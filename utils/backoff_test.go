@@ -2,6 +2,7 @@ package utils
 
 import (
 	"testing"
+	"time"
 )
 
 func TestBackoff(t *testing.T) {
@@ -29,3 +30,29 @@ func TestBackoff(t *testing.T) {
 	}
 
 }
+
+func TestBackoffClose(t *testing.T) {
+	b := &Backoff{
+		Factor: 10,
+		Min:    10 * time.Millisecond,
+		Max:    time.Second,
+	}
+
+	c := make(chan struct{}, 1)
+	b.Backoff(c)
+	b.Close()
+	if b.Waiting() {
+		t.Fatal("Backoff unexpectedly waiting")
+	}
+
+	err := b.Backoff(c)
+	if err == nil {
+		t.Fatal("Expected an error backing off after close")
+	}
+
+	select {
+	case <-c:
+		t.Fatal("Unexpected send after close")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
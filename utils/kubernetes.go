@@ -35,3 +35,22 @@ func NewKubeClientset(kubeConfig string, namespace string) (*kubernetes.Clientse
 
 	return clientset, err
 }
+
+// KubePolicyAPIPath is where the MicroscalingPolicy custom resources are served
+const KubePolicyAPIPath = "/apis/microscaling.com/v1alpha1"
+
+// KubePolicyPath is the API path for a MicroscalingPolicy, or for the collection if the name is empty. If the
+// namespace is empty the collection covers all namespaces.
+func KubePolicyPath(namespace string, name string) string {
+	path := KubePolicyAPIPath
+	if namespace != "" {
+		path += "/namespaces/" + namespace
+	}
+
+	path += "/microscalingpolicies"
+	if name != "" {
+		path += "/" + name
+	}
+
+	return path
+}